@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats reports how a cache performed since it was created.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Len       int
+}
+
+// StatsReporter is implemented by caches keeping Stats.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+type lruEntry[T any] struct {
+	key    string
+	record cacheRecord[T]
+}
+
+type lruCache[T any] struct {
+	mtx        sync.Mutex
+	size       int
+	defaultTTL time.Duration
+	items      map[string]*list.Element
+	order      *list.List
+	stats      Stats
+}
+
+// NewLRUCache creates a cache holding at most size items. When full, adding an
+// item evicts the least recently used one. A defaultTTL of zero never expires
+// items.
+func NewLRUCache[T any](size int, defaultTTL time.Duration) Cache[T] {
+	return &lruCache[T]{
+		size:       max(size, 1),
+		defaultTTL: defaultTTL,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *lruCache[T]) Add(key string, value T) error {
+	return c.AddWithTTL(key, value, c.defaultTTL)
+}
+
+func (c *lruCache[T]) AddWithTTL(key string, value T, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	rec := cacheRecord[T]{
+		expiresAt: expiresAt,
+		value:     value,
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, found := c.items[key]; found {
+		e.Value.(*lruEntry[T]).record = rec
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[T]{key: key, record: rec})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+func (c *lruCache[T]) Get(key string) (T, bool, error) {
+	var value T
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	e, found := c.items[key]
+	if !found {
+		c.stats.Misses++
+		return value, false, nil
+	}
+	entry := e.Value.(*lruEntry[T])
+	if entry.record.IsExpired() {
+		c.remove(e)
+		c.stats.Misses++
+		return value, false, nil
+	}
+	c.order.MoveToFront(e)
+	c.stats.Hits++
+	return entry.record.value, true, nil
+}
+
+func (c *lruCache[T]) Delete(key string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, found := c.items[key]; found {
+		c.remove(e)
+	}
+	return nil
+}
+
+func (c *lruCache[T]) Stats() Stats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.stats
+	stats.Len = c.order.Len()
+	return stats
+}
+
+func (c *lruCache[T]) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.items, e.Value.(*lruEntry[T]).key)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LRU Cache", func() {
+	It("Should evict the least recently used item", func() {
+		c := NewLRUCache[string](2, 0)
+
+		Expect(c.Add("a", "1")).To(BeNil())
+		Expect(c.Add("b", "2")).To(BeNil())
+		_, found, _ := c.Get("a")
+		Expect(found).To(BeTrue())
+		Expect(c.Add("c", "3")).To(BeNil())
+
+		_, found, _ = c.Get("b")
+		Expect(found).To(BeFalse())
+		v, found, _ := c.Get("a")
+		Expect(found).To(BeTrue())
+		Expect(v).To(Equal("1"))
+		v, found, _ = c.Get("c")
+		Expect(found).To(BeTrue())
+		Expect(v).To(Equal("3"))
+
+		Expect(c.(StatsReporter).Stats()).To(Equal(Stats{Hits: 3, Misses: 1, Evictions: 1, Len: 2}))
+	})
+
+	It("Should NOT return expired or deleted items", func() {
+		c := NewLRUCache[string](10, time.Hour)
+
+		Expect(c.AddWithTTL("a", "1", time.Millisecond*100)).To(BeNil())
+		Expect(c.Add("b", "2")).To(BeNil())
+		time.Sleep(time.Millisecond * 200)
+
+		_, found, _ := c.Get("a")
+		Expect(found).To(BeFalse())
+		Expect(c.Delete("b")).To(BeNil())
+		_, found, _ = c.Get("b")
+		Expect(found).To(BeFalse())
+		Expect(c.(StatsReporter).Stats().Len).To(Equal(0))
+	})
+})
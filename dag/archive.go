@@ -0,0 +1,513 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/msaldanha/setinstone/resolver"
+	"github.com/msaldanha/setinstone/tsa"
+)
+
+// archiveVersion is the version of the manifest written by Export.
+const archiveVersion = 1
+
+// rootNodeName is the name, relative to the address namespace, resolving to
+// the root node.
+const rootNodeName = "shortcuts/root"
+
+// archiveManifest is the root block of an archive. It lists the blobs and
+// nodes of the archive, in the order they must be imported, and the resolver
+// names to restore, relative to the address namespace.
+type archiveManifest struct {
+	Version int               `json:"version"`
+	Address string            `json:"address"`
+	Root    string            `json:"root"`
+	Blobs   []archiveEntry    `json:"blobs,omitempty"`
+	Nodes   []archiveEntry    `json:"nodes"`
+	Names   map[string]string `json:"names"`
+}
+
+// archiveBlock is a block written to an archive.
+type archiveBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// archiveEntry maps the key of a node or blob in the data store to the CID of
+// its block in the archive.
+type archiveEntry struct {
+	Key string `json:"key"`
+	Cid string `json:"cid"`
+}
+
+// Export writes the whole DAG of addr to w as a CARv1 archive: every node of
+// every branch, the blobs they reference (data chunks and branch indexes) and
+// the resolver names of the root, of every branch head, of redactions and of
+// timestamp tokens, with the tokens. The chunks of redacted payloads are left
+// out. The root of the archive is a
+// manifest block describing its content. Use Import to restore it.
+func (da *Dag) Export(ctx context.Context, addr string, w io.Writer) error {
+	nodes := map[string]*Node{}
+	var keys []string
+	er := da.WalkAddress(ctx, addr, func(key string, node *Node) error {
+		nodes[key] = node
+		keys = append(keys, key)
+		return nil
+	})
+	if er != nil {
+		return da.translateError(er)
+	}
+
+	manifest := archiveManifest{
+		Version: archiveVersion,
+		Address: addr,
+		Root:    keys[0],
+		Names:   map[string]string{rootNodeName: keys[0]},
+	}
+	// Blocks are written in the order they are added, following the sorted
+	// nodes, so exporting the same DAG twice gives the same archive.
+	var blocks []archiveBlock
+	added := map[cid.Cid]bool{}
+	addBlock := func(key string, data []byte, codec uint64) (archiveEntry, error) {
+		c, er := archiveCid(data, codec)
+		if er != nil {
+			return archiveEntry{}, er
+		}
+		if !added[c] {
+			added[c] = true
+			blocks = append(blocks, archiveBlock{cid: c, data: data})
+		}
+		return archiveEntry{Key: key, Cid: c.String()}, nil
+	}
+	addBlob := func(key string) error {
+		data, er := da.readBlob(ctx, key)
+		if er != nil {
+			return er
+		}
+		entry, er := addBlock(key, data, cid.Raw)
+		if er != nil {
+			return er
+		}
+		manifest.Blobs = append(manifest.Blobs, entry)
+		return nil
+	}
+
+	for _, key := range sortNodesForImport(nodes) {
+		node := nodes[key]
+		data, er := da.readBlob(ctx, key)
+		if er != nil {
+			return er
+		}
+		codec := uint64(cid.DagCBOR)
+		if isJson(data) {
+			codec = cid.Raw
+		}
+		entry, er := addBlock(key, data, codec)
+		if er != nil {
+			return er
+		}
+		manifest.Nodes = append(manifest.Nodes, entry)
+
+		tombstoneKey, er := da.GetRedaction(ctx, key)
+		if er != nil {
+			return er
+		}
+		if tombstoneKey != "" {
+			manifest.Names[strings.Join([]string{"redactions", key}, "/")] = tombstoneKey
+		} else {
+			for _, chunk := range node.DataChunks {
+				if er := addBlob(chunk); er != nil {
+					return er
+				}
+			}
+		}
+
+		tokenKey, er := da.resolveManagedName(ctx, addr, da.getTimestampName(addr, key))
+		if er != nil && !errors.Is(er, resolver.ErrNotFound) {
+			return da.translateError(er)
+		}
+		if er == nil {
+			if er := addBlob(tokenKey); er != nil {
+				return er
+			}
+			manifest.Names[strings.Join([]string{"timestamps", key}, "/")] = tokenKey
+		}
+
+		branches, er := da.ListBranches(ctx, key)
+		if er != nil {
+			return er
+		}
+		for _, branch := range branches {
+			manifest.Names[strings.Join([]string{"shortcuts", key, branch.Name, "last"}, "/")] = branch.HeadKey
+		}
+		indexKey, _, er := da.getBranchIndex(ctx, node, key)
+		if er != nil {
+			return er
+		}
+		if indexKey != "" {
+			if er := addBlob(indexKey); er != nil {
+				return er
+			}
+			manifest.Names[strings.Join([]string{"indexes", key, "branches"}, "/")] = indexKey
+		}
+	}
+
+	data, er := json.Marshal(manifest)
+	if er != nil {
+		return er
+	}
+	manifestCid, er := archiveCid(data, cid.Raw)
+	if er != nil {
+		return er
+	}
+	car, er := storage.NewWritable(w, []cid.Cid{manifestCid}, carv2.WriteAsCarV1(true))
+	if er != nil {
+		return er
+	}
+	if er := car.Put(ctx, manifestCid.KeyString(), data); er != nil {
+		return er
+	}
+	for _, b := range blocks {
+		if er := car.Put(ctx, b.cid.KeyString(), b.data); er != nil {
+			return er
+		}
+	}
+	return car.Finalize()
+}
+
+// Import restores a DAG exported with Export, reading a CARv1 or CARv2
+// archive from r. Every node is verified, signature and chain links included,
+// before it is stored, and the resolver names are only restored once all of
+// them are stored, the root name last. The names of the root, of branch heads
+// and of redactions are recomputed from the imported nodes; the ones of the
+// archive must match them. Timestamp tokens and branch indexes are checked
+// against the nodes they belong to. Stored content must get the same key it
+// had when exported, otherwise ErrArchiveKeyMismatch is returned, as nodes
+// reference each other by key. The address must be managed by the resolver
+// and must not have a DAG yet. Returns the imported address.
+func (da *Dag) Import(ctx context.Context, r io.Reader) (string, error) {
+	br, er := carv2.NewBlockReader(r)
+	if er != nil {
+		return "", ErrInvalidArchive
+	}
+	if len(br.Roots) != 1 {
+		return "", ErrInvalidArchive
+	}
+	blocks := map[cid.Cid][]byte{}
+	for {
+		b, er := br.Next()
+		if errors.Is(er, io.EOF) {
+			break
+		}
+		if er != nil {
+			return "", ErrInvalidArchive
+		}
+		c, er := b.Cid().Prefix().Sum(b.RawData())
+		if er != nil || !c.Equals(b.Cid()) {
+			return "", ErrInvalidArchive
+		}
+		blocks[b.Cid()] = b.RawData()
+	}
+	getBlock := func(s string) ([]byte, error) {
+		c, er := cid.Parse(s)
+		if er != nil {
+			return nil, ErrInvalidArchive
+		}
+		data, ok := blocks[c]
+		if !ok {
+			return nil, ErrInvalidArchive
+		}
+		return data, nil
+	}
+
+	manifest := archiveManifest{}
+	data, er := getBlock(br.Roots[0].String())
+	if er != nil {
+		return "", er
+	}
+	if er := json.Unmarshal(data, &manifest); er != nil {
+		return "", ErrInvalidArchive
+	}
+	if manifest.Version != archiveVersion || len(manifest.Nodes) == 0 || manifest.Nodes[0].Key != manifest.Root {
+		return "", ErrInvalidArchive
+	}
+	root, _, _ := da.GetRoot(ctx, manifest.Address)
+	if root != nil {
+		return "", ErrDagAlreadyInitialized
+	}
+
+	blobs := map[string][]byte{}
+	for _, entry := range manifest.Blobs {
+		data, er := getBlock(entry.Cid)
+		if er != nil {
+			return "", er
+		}
+		key, _, er := da.dt.Put(ctx, data, nil)
+		if er != nil {
+			return "", da.translateError(er)
+		}
+		if key != entry.Key {
+			return "", ErrArchiveKeyMismatch
+		}
+		blobs[key] = data
+	}
+
+	nodes := map[string]*Node{}
+	keys := make([]string, 0, len(manifest.Nodes))
+	for i, entry := range manifest.Nodes {
+		data, er := getBlock(entry.Cid)
+		if er != nil {
+			return "", er
+		}
+		node, er := decodeNode(data)
+		if er != nil {
+			return "", ErrInvalidArchive
+		}
+		if node.Address != manifest.Address {
+			return "", ErrNodeAddressMismatch
+		}
+		var key string
+		if i == 0 {
+			key, er = da.importRootNode(ctx, node, data)
+		} else {
+			key, er = da.importNode(ctx, node, data)
+		}
+		if er != nil {
+			return "", da.translateError(er)
+		}
+		if key != entry.Key {
+			return "", ErrArchiveKeyMismatch
+		}
+		nodes[key] = node
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		for _, chunk := range nodes[key].DataChunks {
+			if data, ok := blobs[chunk]; ok {
+				if _, _, er := da.dt.Put(ctx, data, da.chunkPathFunc(manifest.Address)); er != nil {
+					return "", da.translateError(er)
+				}
+			}
+		}
+	}
+
+	values, er := da.importNames(manifest, keys, nodes, blobs)
+	if er != nil {
+		return "", er
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if name != rootNodeName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		er := da.resolver.Add(ctx, da.getName(manifest.Address, name), values[name])
+		if er != nil {
+			return "", da.translateError(er)
+		}
+	}
+	ordered := make([]*Node, 0, len(keys))
+	for _, key := range keys {
+		er := da.advanceClock(ctx, nodes[key], key)
+		if er != nil {
+			return "", da.translateError(er)
+		}
+		ordered = append(ordered, nodes[key])
+	}
+	er = da.addHeads(ctx, manifest.Address, keys, ordered)
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	er = da.resolver.Add(ctx, da.getName(manifest.Address, rootNodeName), values[rootNodeName])
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	return manifest.Address, nil
+}
+
+// importNames returns the resolver names to restore for the imported nodes,
+// keyed by name relative to the address namespace. keys lists the nodes in
+// import order, the root first. The names of the root, of branch heads and of
+// redactions are computed from the nodes, and the archive must list the same;
+// the other names of the archive are only kept once their target is checked.
+// Any other name makes the archive invalid.
+func (da *Dag) importNames(manifest archiveManifest, keys []string, nodes map[string]*Node, blobs map[string][]byte) (map[string]string, error) {
+	values := map[string]string{rootNodeName: keys[0]}
+	headSeqs := map[string]int64{}
+	setHead := func(rootKey, branch, key string, seq int64) {
+		name := strings.Join([]string{"shortcuts", rootKey, branch, "last"}, "/")
+		if current, ok := values[name]; ok && headSeqs[name] >= seq && current != rootKey {
+			return
+		}
+		values[name] = key
+		headSeqs[name] = seq
+	}
+	opened := map[string][]string{}
+	for i, key := range keys {
+		node := nodes[key]
+		if i == 0 {
+			setHead(key, node.Branch, key, 0)
+		} else {
+			setHead(node.BranchRoot, node.Branch, key, node.Seq)
+		}
+		for _, branch := range node.Branches {
+			setHead(key, branch, key, 0)
+		}
+		if node.IsBranchOpen() {
+			opened[node.BranchRoot] = append(opened[node.BranchRoot], node.Branch)
+		}
+		if node.IsTombstone() {
+			values[strings.Join([]string{"redactions", node.Redacts}, "/")] = key
+		}
+	}
+
+	for name, value := range manifest.Names {
+		if expected, ok := values[name]; ok {
+			if value != expected {
+				return nil, ErrInvalidArchive
+			}
+			continue
+		}
+		parts := strings.Split(name, "/")
+		switch {
+		case len(parts) == 2 && parts[0] == "timestamps":
+			if er := da.verifyArchiveToken(nodes[parts[1]], parts[1], blobs[value]); er != nil {
+				return nil, er
+			}
+		case len(parts) == 3 && parts[0] == "indexes" && parts[2] == "branches":
+			if er := verifyArchiveIndex(nodes[parts[1]], blobs[value], opened[parts[1]]); er != nil {
+				return nil, er
+			}
+			delete(opened, parts[1])
+		default:
+			return nil, ErrInvalidArchive
+		}
+		values[name] = value
+	}
+	if len(opened) > 0 {
+		// Branches opened at a node without the index listing them.
+		return nil, ErrInvalidArchive
+	}
+	return values, nil
+}
+
+// verifyArchiveToken checks data is a timestamp token countersigning the
+// imported node with the given key.
+func (da *Dag) verifyArchiveToken(node *Node, key string, data []byte) error {
+	if node == nil || data == nil {
+		return ErrInvalidArchive
+	}
+	token := &tsa.Token{}
+	if er := token.FromJson(data); er != nil {
+		return ErrInvalidArchive
+	}
+	if er := da.verifyTimestampToken(node, key, token); er != nil {
+		return ErrInvalidArchive
+	}
+	return nil
+}
+
+// verifyArchiveIndex checks data is the branch index of an imported node,
+// listing exactly the branches opened at it.
+func verifyArchiveIndex(node *Node, data []byte, opened []string) error {
+	if node == nil || data == nil {
+		return ErrInvalidArchive
+	}
+	var branches []string
+	if er := json.Unmarshal(data, &branches); er != nil {
+		return ErrInvalidArchive
+	}
+	sort.Strings(branches)
+	opened = slices.Sorted(slices.Values(opened))
+	if !slices.Equal(branches, opened) {
+		return ErrInvalidArchive
+	}
+	return nil
+}
+
+func (da *Dag) importRootNode(ctx context.Context, node *Node, data []byte) (string, error) {
+	if ok, er := da.verifyAddress(node); !ok {
+		return "", er
+	}
+	if !da.verifyTimeStamp(node) {
+		return "", ErrInvalidNodeTimestamp
+	}
+	if er := node.VerifySignature(); er != nil {
+		return "", er
+	}
+	return da.putNodeBytes(ctx, data, func(cid string) string {
+		return da.getName(node.Address, cid, "node")
+	})
+}
+
+func (da *Dag) importNode(ctx context.Context, node *Node, data []byte) (string, error) {
+	if er := da.VerifyNode(ctx, node, node.BranchRoot, false); er != nil {
+		return "", er
+	}
+	pathFunc, er := da.branchPathFunc(ctx, node, node.BranchRoot)
+	if er != nil {
+		return "", er
+	}
+	return da.putNodeBytes(ctx, data, pathFunc)
+}
+
+// readBlob returns the raw content stored under key.
+func (da *Dag) readBlob(ctx context.Context, key string) ([]byte, error) {
+	f, er := da.dt.Get(ctx, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	return da.readLimited(f)
+}
+
+// sortNodesForImport orders nodes so every node comes after the nodes it
+// references (Previous, BranchRoot, merge parents and redacted node) that are
+// part of the set. Ties are broken by key, so the order is deterministic.
+func sortNodesForImport(nodes map[string]*Node) []string {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]string, 0, len(nodes))
+	done := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		node, ok := nodes[key]
+		if !ok || done[key] {
+			return
+		}
+		done[key] = true
+		for _, dep := range append([]string{node.BranchRoot, node.Previous, node.Redacts}, node.Parents...) {
+			visit(dep)
+		}
+		sorted = append(sorted, key)
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	return sorted
+}
+
+func archiveCid(data []byte, codec uint64) (cid.Cid, error) {
+	return cid.Prefix{
+		Version:  1,
+		Codec:    codec,
+		MhType:   mh.SHA2_256,
+		MhLength: -1,
+	}.Sum(data)
+}
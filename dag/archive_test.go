@@ -0,0 +1,216 @@
+package dag_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	mh "github.com/multiformats/go-multihash"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/internal/util"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Archive", func() {
+	var da *dag.Dag
+	var ctx context.Context
+	var genesisAddr *address.Address
+	var genesisKey string
+
+	newDag := func() *dag.Dag {
+		res := resolver.NewLocalResolver()
+		_ = res.Manage(genesisAddr)
+		return dag.NewDag("test-ledger", datastore.NewLocalFileStore(), res,
+			dag.WithMaxInlineDataSize(1024), dag.WithDataChunkSize(300))
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var genesisNode *dag.Node
+		genesisNode, genesisAddr = CreateGenesisNode()
+		da = newDag()
+		var err error
+		genesisKey, err = da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should export and import every branch of a graph", func() {
+		payload := []byte(util.RandString(2000))
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = payload
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		headKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, nodeKey, defaultBranch, 3), genesisKey)
+		Expect(err).To(BeNil())
+
+		open := CreateNodeV2(genesisAddr, nodeKey, nodeKey, "drafts", 1)
+		open.Type = dag.NodeTypeBranchOpen
+		_ = open.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		openKey, err := da.CreateBranch(ctx, open)
+		Expect(err).To(BeNil())
+		draftKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, nodeKey, openKey, "drafts", 2), nodeKey)
+		Expect(err).To(BeNil())
+
+		buf := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, buf)).To(BeNil())
+
+		imported := newDag()
+		addr, err := imported.Import(ctx, bytes.NewReader(buf.Bytes()))
+		Expect(err).To(BeNil())
+		Expect(addr).To(Equal(genesisAddr.Address))
+
+		_, rootKey, err := imported.GetRoot(ctx, addr)
+		Expect(err).To(BeNil())
+		Expect(rootKey).To(Equal(genesisKey))
+		_, lastKey, err := imported.GetLast(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(lastKey).To(Equal(headKey))
+		branches, err := imported.ListBranches(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		Expect(branches).To(Equal([]dag.BranchInfo{{Name: "drafts", Root: nodeKey, HeadKey: draftKey, Length: 2}}))
+
+		stored, err := imported.Get(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		r, err := imported.OpenData(ctx, stored)
+		Expect(err).To(BeNil())
+		data, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(payload))
+
+		report, err := imported.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+
+		_, err = imported.Import(ctx, bytes.NewReader(buf.Bytes()))
+		Expect(err).To(Equal(dag.ErrDagAlreadyInitialized))
+	})
+
+	It("Should NOT import corrupted archives", func() {
+		_, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+		buf := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, buf)).To(BeNil())
+
+		corrupted := bytes.Clone(buf.Bytes())
+		corrupted[len(corrupted)-10] ^= 0xff
+		imported := newDag()
+		_, err = imported.Import(ctx, bytes.NewReader(corrupted))
+		Expect(err).To(Equal(dag.ErrInvalidArchive))
+
+		_, err = imported.Import(ctx, bytes.NewReader([]byte("not an archive")))
+		Expect(err).To(Equal(dag.ErrInvalidArchive))
+
+		_, _, err = imported.GetRoot(ctx, genesisAddr.Address)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Should export the same archive twice", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(2000))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+
+		first := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, first)).To(BeNil())
+		second := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, second)).To(BeNil())
+		Expect(second.Bytes()).To(Equal(first.Bytes()))
+	})
+
+	It("Should NOT import names the nodes do not back", func() {
+		nodeKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+		headKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, nodeKey, defaultBranch, 3), genesisKey)
+		Expect(err).To(BeNil())
+		buf := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, buf)).To(BeNil())
+
+		edits := []func(names map[string]string){
+			func(names map[string]string) {
+				names["shortcuts/"+genesisKey+"/"+defaultBranch+"/last"] = nodeKey
+			},
+			func(names map[string]string) {
+				names["shortcuts/"+nodeKey+"/other/last"] = headKey
+			},
+			func(names map[string]string) {
+				names["redactions/"+nodeKey] = headKey
+			},
+			func(names map[string]string) {
+				names["timestamps/"+nodeKey] = headKey
+			},
+			func(names map[string]string) {
+				names["indexes/"+nodeKey+"/branches"] = headKey
+			},
+			func(names map[string]string) {
+				names["../../other/dag/shortcuts/root"] = genesisKey
+			},
+		}
+		for _, edit := range edits {
+			imported := newDag()
+			_, err = imported.Import(ctx, bytes.NewReader(rewriteManifest(buf.Bytes(), edit)))
+			Expect(err).To(Equal(dag.ErrInvalidArchive))
+			_, _, err = imported.GetRoot(ctx, genesisAddr.Address)
+			Expect(err).NotTo(BeNil())
+		}
+
+		imported := newDag()
+		_, err = imported.Import(ctx, bytes.NewReader(rewriteManifest(buf.Bytes(), func(names map[string]string) {})))
+		Expect(err).To(BeNil())
+	})
+})
+
+// rewriteManifest returns a copy of archive with the names of its manifest
+// changed by edit.
+func rewriteManifest(archive []byte, edit func(names map[string]string)) []byte {
+	br, err := carv2.NewBlockReader(bytes.NewReader(archive))
+	Expect(err).To(BeNil())
+	others := map[cid.Cid][]byte{}
+	var manifest map[string]any
+	for {
+		b, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		Expect(err).To(BeNil())
+		if b.Cid().Equals(br.Roots[0]) {
+			Expect(json.Unmarshal(b.RawData(), &manifest)).To(BeNil())
+			continue
+		}
+		others[b.Cid()] = b.RawData()
+	}
+	names := map[string]string{}
+	for name, value := range manifest["names"].(map[string]any) {
+		names[name] = value.(string)
+	}
+	edit(names)
+	manifest["names"] = names
+	data, err := json.Marshal(manifest)
+	Expect(err).To(BeNil())
+	root, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}.Sum(data)
+	Expect(err).To(BeNil())
+
+	buf := &bytes.Buffer{}
+	car, err := storage.NewWritable(buf, []cid.Cid{root}, carv2.WriteAsCarV1(true))
+	Expect(err).To(BeNil())
+	Expect(car.Put(context.Background(), root.KeyString(), data)).To(BeNil())
+	for c, data := range others {
+		Expect(car.Put(context.Background(), c.KeyString(), data)).To(BeNil())
+	}
+	Expect(car.Finalize()).To(BeNil())
+	return buf.Bytes()
+}
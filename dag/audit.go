@@ -0,0 +1,136 @@
+package dag
+
+import (
+	"context"
+	"time"
+)
+
+// ChainViolation describes a problem found on a single node while auditing a
+// chain with VerifyChain.
+type ChainViolation struct {
+	Key string
+	Seq int64
+	Err error
+}
+
+// ChainReport is the result of auditing a branch with VerifyChain. Head is the
+// key the branch resolved to, Length the number of nodes walked excluding the
+// branch root, and Violations every problem found, from head to root.
+type ChainReport struct {
+	BranchRoot string
+	Branch     string
+	Head       string
+	Length     int
+	Violations []ChainViolation
+}
+
+// Valid reports whether the audited chain has no violations.
+func (r *ChainReport) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *ChainReport) add(key string, node *Node, er error) {
+	v := ChainViolation{Key: key, Err: er}
+	if node != nil {
+		v.Seq = node.Seq
+	}
+	r.Violations = append(r.Violations, v)
+}
+
+// VerifyChain audits a whole branch, walking from its resolved head back to the
+// branch root. Unlike VerifyNode, which only checks a node against its direct
+// predecessor at append time, it re-verifies every node fetched from the data
+// store:
+//   - signature and address/pubkey binding
+//   - all nodes belong to the same address, branch and BranchRoot
+//   - Seq is contiguous, following the same rules as VerifyNode
+//   - timestamps are valid and never decrease towards the head
+//
+// An error is returned only when the audit cannot start (e.g. the head cannot be
+// resolved); problems with the chain itself are listed in the report.
+func (da *Dag) VerifyChain(ctx context.Context, branchRootNodeKey, branch string) (*ChainReport, error) {
+	branchRoot, er := da.getNodeByKey(ctx, branchRootNodeKey)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if branchRoot == nil {
+		return nil, ErrBranchRootNotFound
+	}
+	head, headKey, er := da.GetLast(ctx, branchRootNodeKey, branch)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if head == nil {
+		return nil, ErrHeadNodeNotFound
+	}
+
+	report := &ChainReport{
+		BranchRoot: branchRootNodeKey,
+		Branch:     branch,
+		Head:       headKey,
+	}
+
+	key, node := headKey, head
+	for {
+		da.auditNode(report, key, node, branchRoot.Address)
+		if key == branchRootNodeKey {
+			break
+		}
+		report.Length++
+		if node.Branch != branch {
+			report.add(key, node, ErrInvalidBranch)
+		}
+		if node.BranchRoot != branchRootNodeKey {
+			report.add(key, node, ErrInvalidBranchRoot)
+		}
+		if node.Previous == "" {
+			report.add(key, node, ErrBranchRootNotFound)
+			break
+		}
+		previous, er := da.getNodeByKey(ctx, node.Previous)
+		if er != nil || previous == nil {
+			report.add(key, node, ErrPreviousNodeNotFound)
+			break
+		}
+		da.auditLink(report, key, node, previous, node.Previous == branchRootNodeKey)
+		key, node = node.Previous, previous
+	}
+
+	return report, nil
+}
+
+func (da *Dag) auditNode(report *ChainReport, key string, node *Node, addr string) {
+	if ok, er := da.verifyAddress(node); !ok {
+		report.add(key, node, er)
+	} else if node.Address != addr {
+		report.add(key, node, ErrNodeAddressMismatch)
+	}
+	if !da.verifyTimeStamp(node) {
+		report.add(key, node, ErrInvalidNodeTimestamp)
+	}
+	if er := node.VerifySignature(); er != nil {
+		report.add(key, node, er)
+	}
+}
+
+func (da *Dag) auditLink(report *ChainReport, key string, node, previous *Node, previousIsBranchRoot bool) {
+	if previousIsBranchRoot && (node.Branch != previous.Branch || node.IsBranchOpen()) {
+		if node.Seq != 1 {
+			report.add(key, node, ErrInvalidBranchSeq)
+		}
+	} else if node.Seq != previous.Seq+1 {
+		report.add(key, node, ErrInvalidBranchSeq)
+	}
+
+	ts, er := time.Parse(time.RFC3339, node.Timestamp)
+	if er != nil {
+		return
+	}
+	previousTs, er := time.Parse(time.RFC3339, previous.Timestamp)
+	if er != nil {
+		return
+	}
+	if ts.Before(previousTs) {
+		report.add(key, node, ErrNodeTimestampOutOfOrder)
+	}
+}
@@ -0,0 +1,113 @@
+package dag
+
+import (
+	"context"
+)
+
+// NodeBuilder builds the node at position index of a batch. It receives the
+// node the new one must follow, and its key, which is either the current
+// branch head or the node built at index-1. The returned node must be signed.
+type NodeBuilder func(index int, previous *Node, previousKey string) (*Node, error)
+
+// AppendBatch appends count nodes, built in order by build, to the branch
+// rooted at branchRootNodeKey. Every node is verified and stored, and only then
+// the branch head is moved, once, to the last node. If anything fails, the
+// head is left unchanged, so readers never see part of a batch. As Append, it
+// returns ErrConcurrentAppend if the head moved meanwhile. Returns the keys of
+// the appended nodes, in order.
+func (da *Dag) AppendBatch(ctx context.Context, branchRootNodeKey, branch string, count int, build NodeBuilder) ([]string, error) {
+	if branch == "" {
+		return nil, ErrInvalidBranch
+	}
+	branchRoot, er := da.getNodeByKey(ctx, branchRootNodeKey)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if branchRoot == nil {
+		return nil, ErrBranchRootNotFound
+	}
+	previous, headKey, er := da.GetLast(ctx, branchRootNodeKey, branch)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+
+	previousKey := headKey
+	keys := make([]string, 0, count)
+	nodes := make([]*Node, 0, count)
+	for i := 0; i < count; i++ {
+		node, er := build(i, previous, previousKey)
+		if er != nil {
+			return nil, er
+		}
+		er = da.verifyBatchNode(ctx, node, branchRootNodeKey, branch, i == 0, previous, previousKey)
+		if er != nil {
+			return nil, da.translateError(er)
+		}
+		key, er := da.storeNode(ctx, node, branchRootNodeKey)
+		if er != nil {
+			return nil, da.translateError(er)
+		}
+		keys = append(keys, key)
+		nodes = append(nodes, node)
+		previous, previousKey = node, key
+	}
+	if len(keys) == 0 {
+		return keys, nil
+	}
+
+	clockKey, er := da.claimClock(ctx, previous, previousKey)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	lastNodeName := da.getLastNodeName(branchRoot, branchRootNodeKey, branch)
+	er = da.resolver.CompareAndSwap(ctx, lastNodeName, headKey, previousKey)
+	if er != nil {
+		da.releaseClock(ctx, previous, previousKey, clockKey)
+		return nil, da.translateError(er)
+	}
+	er = da.addHeads(ctx, branchRoot.Address, keys, nodes)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	for i, node := range nodes {
+		er = da.addResolutionForNodeBranches(ctx, node, keys[i])
+		if er != nil {
+			return nil, da.translateError(er)
+		}
+		da.observe(ctx, node, keys[i])
+	}
+	er = da.countersignAppended(ctx, keys...)
+	if er != nil {
+		return keys, er
+	}
+	return keys, nil
+}
+
+// verifyBatchNode verifies a node of a batch. The first one must follow the
+// current branch head, the others the node before them in the batch, which is
+// stored but not yet the head.
+func (da *Dag) verifyBatchNode(ctx context.Context, node *Node, branchRootNodeKey, branch string, first bool,
+	previous *Node, previousKey string) error {
+	if node.IsBranchOpen() || node.IsTombstone() {
+		return ErrInvalidNodeType
+	}
+	if node.Branch != branch {
+		return ErrInvalidBranch
+	}
+	if first {
+		return da.VerifyNode(ctx, node, branchRootNodeKey, true)
+	}
+	if previous.IsBranchClose() {
+		return ErrBranchClosed
+	}
+	if node.Previous != previousKey {
+		return ErrPreviousNodeIsNotHead
+	}
+	if node.BranchRoot != branchRootNodeKey {
+		return ErrInvalidBranchRoot
+	}
+	if node.Seq != previous.Seq+1 {
+		return ErrInvalidBranchSeq
+	}
+	return da.VerifyNode(ctx, node, branchRootNodeKey, false)
+}
@@ -0,0 +1,212 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// BranchInfo describes a branch rooted at a node.
+type BranchInfo struct {
+	// Name is the branch name.
+	Name string `json:"name"`
+	// Root is the key of the node the branch is rooted at.
+	Root string `json:"root"`
+	// HeadKey is the key of the current branch head. It is Root when nothing
+	// was appended to the branch yet.
+	HeadKey string `json:"headKey"`
+	// Length is the number of nodes in the branch.
+	Length int64 `json:"length"`
+	// Closed tells whether the branch was closed by CloseBranch.
+	Closed bool `json:"closed"`
+}
+
+// CreateBranch stores a branch-open node, starting the branch node.Branch at
+// the node referenced by node.BranchRoot. The node must be of type
+// NodeTypeBranchOpen, have Seq 1 and reference the branch root as Previous.
+// Returns ErrBranchAlreadyExists if the branch is already declared or opened
+// at that node.
+func (da *Dag) CreateBranch(ctx context.Context, node *Node) (string, error) {
+	if !node.IsBranchOpen() {
+		return "", ErrInvalidNodeType
+	}
+	return da.Append(ctx, node, node.BranchRoot)
+}
+
+// CloseBranch appends a branch-close node to the branch node.Branch rooted at
+// branchRootNodeKey. Once closed, Append rejects new nodes for the branch with
+// ErrBranchClosed.
+func (da *Dag) CloseBranch(ctx context.Context, node *Node, branchRootNodeKey string) (string, error) {
+	if !node.IsBranchClose() {
+		return "", ErrInvalidNodeType
+	}
+	return da.Append(ctx, node, branchRootNodeKey)
+}
+
+// ListBranches returns the branches rooted at the node with the given key:
+// the ones declared in its Branches field followed by the ones opened later
+// with CreateBranch. Opened branches are only known for the addresses the
+// resolver manages.
+func (da *Dag) ListBranches(ctx context.Context, key string) ([]BranchInfo, error) {
+	root, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if root == nil {
+		return nil, ErrNodeNotFound
+	}
+	opened, er := da.getOpenedBranches(ctx, root, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	seen := map[string]bool{}
+	branches := []BranchInfo{}
+	for _, name := range append(append([]string{}, root.Branches...), opened...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		info, er := da.describeBranch(ctx, root, key, name)
+		if er != nil {
+			return nil, er
+		}
+		branches = append(branches, *info)
+	}
+	return branches, nil
+}
+
+// GetBranch describes the branch named branch rooted at the node with the
+// given key. Returns ErrInvalidBranch if there is no such branch.
+func (da *Dag) GetBranch(ctx context.Context, key, branch string) (*BranchInfo, error) {
+	root, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if root == nil {
+		return nil, ErrNodeNotFound
+	}
+	exists, er := da.branchExists(ctx, root, key, branch)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if !exists {
+		return nil, ErrInvalidBranch
+	}
+	return da.describeBranch(ctx, root, key, branch)
+}
+
+func (da *Dag) describeBranch(ctx context.Context, root *Node, key, branch string) (*BranchInfo, error) {
+	head, headKey, er := da.GetLast(ctx, key, branch)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	info := &BranchInfo{Name: branch, Root: key, HeadKey: headKey}
+	if head.Branch == branch {
+		info.Length = head.Seq
+	}
+	info.Closed = headKey != key && head.IsBranchClose()
+	return info, nil
+}
+
+// verifyBranchOpen checks a new branch-open node. The branch must not exist
+// yet at its root.
+func (da *Dag) verifyBranchOpen(ctx context.Context, node *Node, branchRootNodeKey string) error {
+	if node.BranchRoot != branchRootNodeKey || node.Previous != branchRootNodeKey {
+		return ErrInvalidBranchRoot
+	}
+	branchRoot, er := da.getNodeByKey(ctx, branchRootNodeKey)
+	if er != nil {
+		return da.translateError(er)
+	}
+	if branchRoot == nil {
+		return ErrBranchRootNotFound
+	}
+	exists, er := da.branchExists(ctx, branchRoot, branchRootNodeKey, node.Branch)
+	if er != nil {
+		return da.translateError(er)
+	}
+	if exists {
+		return ErrBranchAlreadyExists
+	}
+	return nil
+}
+
+// branchExists tells whether branch was declared by the node or opened at it.
+func (da *Dag) branchExists(ctx context.Context, node *Node, key, branch string) (bool, error) {
+	if da.hasBranch(node, branch) {
+		return true, nil
+	}
+	opened, er := da.getOpenedBranches(ctx, node, key)
+	if er != nil {
+		return false, er
+	}
+	for _, b := range opened {
+		if b == branch {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getOpenedBranches returns the names of the branches opened at the node with
+// the given key. They are kept in an index stored in the data store and
+// resolved by name, as the node itself cannot change once signed. Only the
+// resolver managing the address of the node keeps the index, so no opened
+// branch is returned for the nodes of other addresses.
+func (da *Dag) getOpenedBranches(ctx context.Context, node *Node, key string) ([]string, error) {
+	_, branches, er := da.getBranchIndex(ctx, node, key)
+	return branches, er
+}
+
+func (da *Dag) getBranchIndex(ctx context.Context, node *Node, key string) (string, []string, error) {
+	indexKey, er := da.resolveManagedName(ctx, node.Address, da.getBranchIndexName(node.Address, key))
+	if errors.Is(er, resolver.ErrNotFound) {
+		return "", nil, nil
+	}
+	if er != nil {
+		return "", nil, er
+	}
+	f, er := da.dt.Get(ctx, indexKey)
+	if er != nil {
+		return "", nil, er
+	}
+	data, er := da.readLimited(f)
+	if er != nil {
+		return "", nil, er
+	}
+	var branches []string
+	er = json.Unmarshal(data, &branches)
+	if er != nil {
+		return "", nil, er
+	}
+	return indexKey, branches, nil
+}
+
+// addOpenedBranch adds branch to the index of the node. The index is swapped
+// atomically, so of two concurrent openings only one claims the branch.
+func (da *Dag) addOpenedBranch(ctx context.Context, node *Node, key, branch string) error {
+	indexKey, branches, er := da.getBranchIndex(ctx, node, key)
+	if er != nil {
+		return er
+	}
+	for _, b := range branches {
+		if b == branch {
+			return ErrBranchAlreadyExists
+		}
+	}
+	data, er := json.Marshal(append(branches, branch))
+	if er != nil {
+		return er
+	}
+	newIndexKey, _, er := da.dt.Put(ctx, data, nil)
+	if er != nil {
+		return er
+	}
+	return da.resolver.CompareAndSwap(ctx, da.getBranchIndexName(node.Address, key), indexKey, newIndexKey)
+}
+
+func (da *Dag) getBranchIndexName(addr, nodeKey string) string {
+	return da.getName(addr, "indexes", nodeKey, "branches")
+}
@@ -0,0 +1,102 @@
+package dag_test
+
+import (
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/cache"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Node cache", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	appendNodes := func(da *dag.Dag, genesisKey string, genesisAddr *address.Address) {
+		prev := genesisKey
+		for seq := int64(2); seq <= 6; seq++ {
+			var err error
+			prev, err = da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, prev, defaultBranch, seq), genesisKey)
+			Expect(err).To(BeNil())
+		}
+	}
+
+	It("Should serve repeated reads from the cache", func() {
+		genesisNode, genesisAddr := CreateGenesisNode()
+		uncachedStore := &countingDataStore{DataStore: datastore.NewLocalFileStore()}
+		uncached, genesisKey := CreateRootedDag(genesisNode, genesisAddr, uncachedStore)
+		appendNodes(uncached, genesisKey, genesisAddr)
+		Expect(uncached.CacheStats()).To(Equal(cache.Stats{}))
+
+		cachedStore := &countingDataStore{DataStore: datastore.NewLocalFileStore()}
+		da, genesisKey := CreateRootedDag(genesisNode, genesisAddr, cachedStore,
+			dag.WithNodeCache(cache.NewLRUCache[*dag.Node](100, 0)))
+		appendNodes(da, genesisKey, genesisAddr)
+
+		Expect(cachedStore.gets).To(BeNumerically("<", uncachedStore.gets))
+		stats := da.CacheStats()
+		Expect(stats.Hits).To(BeNumerically(">", 0))
+		Expect(stats.Misses).To(BeNumerically(">", 0))
+	})
+
+	It("Should read nodes through a tiered data store", func() {
+		genesisNode, genesisAddr := CreateGenesisNode()
+		slow := &countingDataStore{DataStore: datastore.NewLocalFileStore()}
+		res := resolver.NewLocalResolver()
+		source, genesisKey := CreateRootedDagWithResolver(genesisNode, genesisAddr, slow, res)
+		appendNodes(source, genesisKey, genesisAddr)
+
+		tiered, err := datastore.NewTieredDataStore(datastore.NewLocalFileStore(), slow)
+		Expect(err).To(BeNil())
+		da := dag.NewDag("test-ledger", tiered, res)
+		_, lastKey, err := da.GetLast(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		readAll := func() {
+			nodes := 0
+			Expect(da.Walk(ctx, lastKey, func(key string, node *dag.Node) error {
+				nodes++
+				return nil
+			})).To(BeNil())
+			Expect(nodes).To(Equal(6))
+		}
+		readAll()
+		gets := slow.gets
+		readAll()
+		Expect(slow.gets).To(Equal(gets))
+	})
+
+	It("Should NOT let callers alter cached nodes", func() {
+		genesisNode, genesisAddr := CreateGenesisNode()
+		da, genesisKey := CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore(),
+			dag.WithNodeCache(cache.NewLRUCache[*dag.Node](100, 0)))
+
+		node, err := da.Get(ctx, genesisKey)
+		Expect(err).To(BeNil())
+		node.Branches[0] = "changed"
+		node.Data[0] ^= 0xff
+
+		node, err = da.Get(ctx, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(node).To(Equal(genesisNode))
+	})
+})
+
+// countingDataStore counts the reads made to the wrapped data store.
+type countingDataStore struct {
+	datastore.DataStore
+	gets int
+}
+
+func (c *countingDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	c.gets++
+	return c.DataStore.Get(ctx, key)
+}
@@ -0,0 +1,151 @@
+package dag
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+// InclusionProof shows that the node with key NodeKey is part of the branch
+// committed to by a checkpoint node. It is self contained: a light client that
+// trusts the checkpoint signature can verify it offline with Verify, without
+// fetching the rest of the branch.
+type InclusionProof struct {
+	// Checkpoint is the signed checkpoint node holding the Merkle root.
+	Checkpoint *Node `json:"checkpoint,omitempty"`
+	// NodeKey is the key of the node proven to be included.
+	NodeKey string `json:"nodeKey,omitempty"`
+	// Index is the position of the node among the leaves, that is its Seq-1.
+	Index int64 `json:"index"`
+	// Path holds the hex encoded sibling hashes from the leaf up to the root.
+	Path []string `json:"path,omitempty"`
+}
+
+// Verify checks that the checkpoint is a validly signed checkpoint node and
+// that the path leads from NodeKey to its Merkle root.
+func (p InclusionProof) Verify() error {
+	c := p.Checkpoint
+	if c == nil || !c.IsCheckpoint() || c.GetVersion() < NodeVersion2 {
+		return ErrInvalidInclusionProof
+	}
+	if ok, _ := address.IsValid(c.Address); !ok {
+		return ErrInvalidInclusionProof
+	}
+	if !address.MatchesPubKey(c.Address, c.PubKey) {
+		return ErrInvalidInclusionProof
+	}
+	if er := c.VerifySignature(); er != nil {
+		return ErrInvalidInclusionProof
+	}
+	root, er := hex.DecodeString(c.MerkleRoot)
+	if er != nil {
+		return ErrInvalidInclusionProof
+	}
+	path := make([][]byte, 0, len(p.Path))
+	for _, s := range p.Path {
+		h, er := hex.DecodeString(s)
+		if er != nil {
+			return ErrInvalidInclusionProof
+		}
+		path = append(path, h)
+	}
+	if !verifyMerklePath(p.Index, int64(c.Seq)-1, merkleLeafHash(p.NodeKey), path, root) {
+		return ErrInvalidInclusionProof
+	}
+	return nil
+}
+
+func (p InclusionProof) ToJson() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *InclusionProof) FromJson(js []byte) error {
+	return json.Unmarshal(js, p)
+}
+
+// MerkleRoot returns the hex encoded Merkle root of the first size nodes of a
+// branch, in sequence order, walking back from the node with key headKey,
+// which must have sequence size. It is the root a checkpoint appended after
+// headKey must commit to.
+func (da *Dag) MerkleRoot(ctx context.Context, headKey string, size int64) (string, error) {
+	keys, er := da.branchKeys(ctx, headKey, size)
+	if er != nil {
+		return "", er
+	}
+	return hex.EncodeToString(merkleRoot(keys)), nil
+}
+
+// ProveInclusion builds the proof that the node with key nodeKey is included
+// in the Merkle root of the checkpoint with key checkpointKey. Returns
+// ErrNodeNotInCheckpoint if the checkpoint does not cover the node.
+func (da *Dag) ProveInclusion(ctx context.Context, checkpointKey, nodeKey string) (*InclusionProof, error) {
+	checkpoint, er := da.getNodeByKey(ctx, checkpointKey)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if checkpoint == nil {
+		return nil, ErrNodeNotFound
+	}
+	if !checkpoint.IsCheckpoint() {
+		return nil, ErrInvalidCheckpoint
+	}
+	node, er := da.getNodeByKey(ctx, nodeKey)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if node == nil {
+		return nil, ErrNodeNotFound
+	}
+	keys, er := da.branchKeys(ctx, checkpoint.Previous, checkpoint.Seq-1)
+	if er != nil {
+		return nil, er
+	}
+	index := int(node.Seq) - 1
+	if index < 0 || index >= len(keys) || keys[index] != nodeKey {
+		return nil, ErrNodeNotInCheckpoint
+	}
+	proof := &InclusionProof{Checkpoint: checkpoint, NodeKey: nodeKey, Index: int64(index)}
+	for _, h := range merklePath(index, keys) {
+		proof.Path = append(proof.Path, hex.EncodeToString(h))
+	}
+	return proof, nil
+}
+
+// verifyCheckpoint recomputes the Merkle root a checkpoint commits to.
+func (da *Dag) verifyCheckpoint(ctx context.Context, node *Node) error {
+	root, er := da.MerkleRoot(ctx, node.Previous, node.Seq-1)
+	if er != nil {
+		return er
+	}
+	if root != node.MerkleRoot {
+		return ErrInvalidCheckpoint
+	}
+	return nil
+}
+
+// branchKeys returns the keys of the first size nodes of a branch, in
+// sequence order, walking back from headKey.
+func (da *Dag) branchKeys(ctx context.Context, headKey string, size int64) ([]string, error) {
+	if size < 0 {
+		return nil, ErrInvalidBranchSeq
+	}
+	keys := make([]string, size)
+	key := headKey
+	for seq := size; seq >= 1; seq-- {
+		node, er := da.getNodeByKey(ctx, key)
+		if er != nil {
+			return nil, da.translateError(er)
+		}
+		if node == nil {
+			return nil, ErrNodeNotFound
+		}
+		if node.Seq != seq {
+			return nil, ErrInvalidBranchSeq
+		}
+		keys[seq-1] = key
+		key = node.Previous
+	}
+	return keys, nil
+}
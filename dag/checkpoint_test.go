@@ -0,0 +1,130 @@
+package dag_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("Checkpoint", func() {
+	var da *dag.Dag
+	var ctx context.Context
+	var genesisAddr *address.Address
+	var keys []string
+	var head *dag.Node
+
+	appendNodes := func(count int) {
+		for i := 0; i < count; i++ {
+			seq := head.Seq + 1
+			node := CreateNodeV2(genesisAddr, keys[0], keys[len(keys)-1], defaultBranch, seq)
+			key, err := da.Append(ctx, node, keys[0])
+			Expect(err).To(BeNil())
+			keys = append(keys, key)
+			head = node
+		}
+	}
+
+	appendCheckpoint := func() (string, *dag.Node) {
+		root, err := da.MerkleRoot(ctx, keys[len(keys)-1], head.Seq)
+		Expect(err).To(BeNil())
+		checkpoint := CreateNodeV2(genesisAddr, keys[0], keys[len(keys)-1], defaultBranch, head.Seq+1)
+		checkpoint.Type = dag.NodeTypeCheckpoint
+		checkpoint.MerkleRoot = root
+		_ = checkpoint.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		key, err := da.Append(ctx, checkpoint, keys[0])
+		Expect(err).To(BeNil())
+		keys = append(keys, key)
+		head = checkpoint
+		return key, checkpoint
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var genesisNode *dag.Node
+		genesisNode, genesisAddr = CreateGenesisNode()
+		var genesisKey string
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore())
+		keys = []string{genesisKey}
+		head = genesisNode
+	})
+
+	It("Should prove inclusion of every node covered by a checkpoint", func() {
+		for _, count := range []int{0, 1, 2, 4, 6} {
+			appendNodes(count)
+			checkpointKey, _ := appendCheckpoint()
+			for i, key := range keys[:len(keys)-1] {
+				proof, err := da.ProveInclusion(ctx, checkpointKey, key)
+				Expect(err).To(BeNil())
+				Expect(proof.Index).To(Equal(int64(i)))
+				Expect(proof.Verify()).To(BeNil())
+
+				js, err := proof.ToJson()
+				Expect(err).To(BeNil())
+				decoded := dag.InclusionProof{}
+				Expect(decoded.FromJson(js)).To(BeNil())
+				Expect(decoded.Verify()).To(BeNil())
+			}
+		}
+	})
+
+	It("Should reject tampered proofs", func() {
+		appendNodes(6)
+		checkpointKey, _ := appendCheckpoint()
+
+		proof, err := da.ProveInclusion(ctx, checkpointKey, keys[3])
+		Expect(err).To(BeNil())
+
+		tampered := *proof
+		tampered.NodeKey = keys[4]
+		Expect(tampered.Verify()).To(Equal(dag.ErrInvalidInclusionProof))
+
+		tampered = *proof
+		tampered.Index = 4
+		Expect(tampered.Verify()).To(Equal(dag.ErrInvalidInclusionProof))
+
+		tampered = *proof
+		tampered.Path = tampered.Path[1:]
+		Expect(tampered.Verify()).To(Equal(dag.ErrInvalidInclusionProof))
+
+		checkpoint := *proof.Checkpoint
+		checkpoint.MerkleRoot = proof.Path[0]
+		tampered = *proof
+		tampered.Checkpoint = &checkpoint
+		Expect(tampered.Verify()).To(Equal(dag.ErrInvalidInclusionProof))
+	})
+
+	It("Should NOT prove nodes after the checkpoint", func() {
+		appendNodes(2)
+		checkpointKey, _ := appendCheckpoint()
+		appendNodes(1)
+
+		_, err := da.ProveInclusion(ctx, checkpointKey, keys[len(keys)-1])
+		Expect(err).To(Equal(dag.ErrNodeNotInCheckpoint))
+		_, err = da.ProveInclusion(ctx, keys[1], keys[0])
+		Expect(err).To(Equal(dag.ErrInvalidCheckpoint))
+	})
+
+	It("Should NOT register checkpoint with wrong Merkle root", func() {
+		appendNodes(3)
+		root, err := da.MerkleRoot(ctx, keys[len(keys)-2], head.Seq-1)
+		Expect(err).To(BeNil())
+
+		checkpoint := CreateNodeV2(genesisAddr, keys[0], keys[len(keys)-1], defaultBranch, head.Seq+1)
+		checkpoint.Type = dag.NodeTypeCheckpoint
+		checkpoint.MerkleRoot = root
+		_ = checkpoint.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, checkpoint, keys[0])
+		Expect(err).To(Equal(dag.ErrInvalidCheckpoint))
+
+		node := CreateNodeV2(genesisAddr, keys[0], keys[len(keys)-1], defaultBranch, head.Seq+1)
+		node.MerkleRoot = root
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, node, keys[0])
+		Expect(err).To(Equal(dag.ErrInvalidCheckpoint))
+	})
+})
@@ -0,0 +1,188 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// Every node of an address may carry a Lamport clock: a logical time greater
+// than the clock of every node it follows, Previous, merge Parents and the
+// node a tombstone Redacts, whatever their branch. The Dag also keeps the
+// latest clock of each address, and appended nodes must carry a clock past
+// it, so clocks strictly increase with every append to the address, on any of
+// its branches. Ordering the nodes of an address by Clock, ties broken by key,
+// is then a total order consistent with their causal history across branches.
+// Clocks are signed, so only v2 nodes can carry them. Nodes created before
+// clocks existed have none; once a node of an address carries a clock, every
+// node appended to it must carry one too.
+
+// MaxClock is the greatest clock a node can carry, as clocks are encoded as
+// signed integers.
+const MaxClock = math.MaxInt64
+
+// NextClock returns the clock of a node appended to its address: one past the
+// greatest of the address clock and the clocks of the nodes it follows, or 1
+// if none has a clock. Builders set it before signing, once Previous, Parents
+// and Redacts are set. Returns the error VerifyNode would if one of those
+// nodes is missing, and ErrInvalidClock once the clock reached MaxClock.
+func (da *Dag) NextClock(ctx context.Context, node *Node) (uint64, error) {
+	clock, er := da.predecessorsClock(ctx, node)
+	if er != nil {
+		return 0, er
+	}
+	_, addressClock, er := da.addressClock(ctx, node.Address)
+	if er != nil {
+		return 0, er
+	}
+	clock = max(clock, addressClock)
+	if clock >= MaxClock {
+		return 0, ErrInvalidClock
+	}
+	return clock + 1, nil
+}
+
+// predecessorsClock returns the greatest clock of the nodes node follows.
+func (da *Dag) predecessorsClock(ctx context.Context, node *Node) (uint64, error) {
+	var clock uint64
+	for _, predecessor := range clockPredecessors(node) {
+		n, er := da.getNodeByKey(ctx, predecessor.key)
+		if errors.Is(er, ErrNodeNotFound) || (er == nil && n == nil) {
+			return 0, predecessor.notFound
+		}
+		if er != nil {
+			return 0, da.translateError(er)
+		}
+		clock = max(clock, n.Clock)
+	}
+	return clock, nil
+}
+
+// verifyClock checks the node clock is greater than the clocks of the nodes it
+// follows, and is set if any of them has a clock. When mustBeNew is true, the
+// node is appended, so its clock must also be past the address clock. Nodes
+// replicated or imported are part of a history already written, and may come
+// after nodes with greater clocks. Clocks past MaxClock are rejected.
+func (da *Dag) verifyClock(ctx context.Context, node *Node, mustBeNew bool) error {
+	if node.Clock != 0 && node.GetVersion() < NodeVersion2 {
+		return ErrInvalidClock
+	}
+	if node.Clock > MaxClock {
+		return ErrInvalidClock
+	}
+	clock, er := da.predecessorsClock(ctx, node)
+	if er != nil {
+		return er
+	}
+	if mustBeNew {
+		_, addressClock, er := da.addressClock(ctx, node.Address)
+		if er != nil {
+			return er
+		}
+		clock = max(clock, addressClock)
+	}
+	if node.Clock == 0 && clock > 0 {
+		return ErrInvalidClock
+	}
+	if node.Clock != 0 && node.Clock <= clock {
+		return ErrInvalidClock
+	}
+	return nil
+}
+
+// addressClock returns the key and clock of the node holding the latest clock
+// of addr, or an empty key and 0 if no node of addr has a clock yet.
+func (da *Dag) addressClock(ctx context.Context, addr string) (string, uint64, error) {
+	key, er := da.resolveManagedName(ctx, addr, da.getClockName(addr))
+	if errors.Is(er, resolver.ErrNotFound) {
+		return "", 0, nil
+	}
+	if er != nil {
+		return "", 0, da.translateError(er)
+	}
+	node, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return "", 0, da.translateError(er)
+	}
+	if node == nil {
+		return "", 0, ErrNodeNotFound
+	}
+	return key, node.Clock, nil
+}
+
+// claimClock makes the appended node with the given key the latest clock of
+// its address, before the branch head is moved to it. Returns the key of the
+// node that held the clock, to give it back with releaseClock if the append
+// fails. When another append claimed the same or a later clock since the node
+// was verified, ErrConcurrentAppend is returned.
+func (da *Dag) claimClock(ctx context.Context, node *Node, key string) (string, error) {
+	current, clock, er := da.addressClock(ctx, node.Address)
+	if er != nil || node.Clock == 0 {
+		return current, er
+	}
+	if clock >= node.Clock {
+		return "", ErrConcurrentAppend
+	}
+	er = da.resolver.CompareAndSwap(ctx, da.getClockName(node.Address), current, key)
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	return current, nil
+}
+
+// releaseClock gives the address clock claimed by the node with the given key
+// back to the node that held it, unless a later append claimed it meanwhile.
+// The first clock of an address has no node to go back to and stays claimed.
+func (da *Dag) releaseClock(ctx context.Context, node *Node, key, previous string) {
+	if node.Clock == 0 || previous == "" {
+		return
+	}
+	_ = da.resolver.CompareAndSwap(ctx, da.getClockName(node.Address), key, previous)
+}
+
+// advanceClock makes the node with the given key the latest clock of its
+// address if its clock is past the current one. Used for nodes that are
+// stored without being appended, such as root, replicated and imported nodes.
+func (da *Dag) advanceClock(ctx context.Context, node *Node, key string) error {
+	if node.Clock == 0 {
+		return nil
+	}
+	for {
+		current, clock, er := da.addressClock(ctx, node.Address)
+		if er != nil {
+			return er
+		}
+		if clock >= node.Clock {
+			return nil
+		}
+		er = da.resolver.CompareAndSwap(ctx, da.getClockName(node.Address), current, key)
+		if !errors.Is(er, resolver.ErrValueChanged) {
+			return da.translateError(er)
+		}
+	}
+}
+
+func (da *Dag) getClockName(addr string) string {
+	return da.getName(addr, "clock")
+}
+
+type clockPredecessor struct {
+	key      string
+	notFound error
+}
+
+func clockPredecessors(node *Node) []clockPredecessor {
+	var predecessors []clockPredecessor
+	if node.Previous != "" {
+		predecessors = append(predecessors, clockPredecessor{node.Previous, ErrPreviousNodeNotFound})
+	}
+	for _, key := range node.Parents {
+		predecessors = append(predecessors, clockPredecessor{key, ErrMergeParentNotFound})
+	}
+	if node.Redacts != "" {
+		predecessors = append(predecessors, clockPredecessor{node.Redacts, ErrInvalidTombstone})
+	}
+	return predecessors
+}
@@ -0,0 +1,100 @@
+package dag_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("Clock", func() {
+	var ctx context.Context
+	var da *dag.Dag
+	var genesisAddr *address.Address
+	var genesisKey string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var genesisNode *dag.Node
+		genesisNode, genesisAddr = CreateGenesisNode()
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore())
+	})
+
+	It("Should start clocks on nodes following unclocked ones", func() {
+		clock, err := da.NextClock(ctx, CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, 0))
+		Expect(err).To(BeNil())
+		Expect(clock).To(Equal(uint64(1)))
+
+		key, err := da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, 0), genesisKey)
+		Expect(err).To(BeNil())
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 1), genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should require clocks greater than the ones of the nodes followed", func() {
+		key, err := da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, 5), genesisKey)
+		Expect(err).To(BeNil())
+
+		next, err := da.NextClock(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 0))
+		Expect(err).To(BeNil())
+		Expect(next).To(Equal(uint64(6)))
+
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 5), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 0), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 9), genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should require clocks past the latest clock of the address", func() {
+		node := CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, 1)
+		node.Branches = []string{"side"}
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		key, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		side := CreateNodeV2(genesisAddr, key, key, "side", 1)
+		side.Clock = 2
+		_ = side.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, side, key)
+		Expect(err).To(BeNil())
+
+		next, err := da.NextClock(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 0))
+		Expect(err).To(BeNil())
+		Expect(next).To(Equal(uint64(3)))
+
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 2), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+		_, err = da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 3), genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should NOT accept clocks past the maximum", func() {
+		_, err := da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, dag.MaxClock+1), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+
+		key, err := da.Append(ctx, CreateNodeWithClock(genesisAddr, genesisKey, genesisKey, 2, dag.MaxClock), genesisKey)
+		Expect(err).To(BeNil())
+		stored, err := da.Get(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(stored.Clock).To(Equal(uint64(dag.MaxClock)))
+		_, err = da.NextClock(ctx, CreateNodeWithClock(genesisAddr, genesisKey, key, 3, 0))
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+	})
+
+	It("Should NOT accept clocks on v1 nodes", func() {
+		node := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Clock = 1
+		_, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidClock))
+	})
+
+	It("Should return ErrPreviousNodeNotFound for unknown predecessors", func() {
+		_, err := da.NextClock(ctx, CreateNodeWithClock(genesisAddr, genesisKey, "unknown", 2, 0))
+		Expect(err).To(Equal(dag.ErrPreviousNodeNotFound))
+	})
+})
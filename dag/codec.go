@@ -0,0 +1,288 @@
+package dag
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// ToCbor serializes the node as DAG-CBOR. Keys referencing other nodes, like
+// Previous and BranchRoot, are written as IPLD links when they hold a CID so
+// IPFS can traverse the timeline natively. Keys that are not CIDs (e.g. the
+// ones produced by local data stores) are written as plain strings.
+func (m *Node) ToCbor() ([]byte, error) {
+	n, er := qp.BuildMap(basicnode.Prototype.Any, -1, func(ma datamodel.MapAssembler) {
+		if m.Version != 0 {
+			qp.MapEntry(ma, "version", qp.Int(int64(m.Version)))
+		}
+		if m.Type != "" {
+			qp.MapEntry(ma, "type", qp.String(m.Type))
+		}
+		if m.Seq != 0 {
+			qp.MapEntry(ma, "seq", qp.Int(m.Seq))
+		}
+		if m.Clock != 0 {
+			qp.MapEntry(ma, "clock", qp.Int(int64(m.Clock)))
+		}
+		if m.Timestamp != "" {
+			qp.MapEntry(ma, "timestamp", qp.String(m.Timestamp))
+		}
+		if m.Address != "" {
+			qp.MapEntry(ma, "address", qp.String(m.Address))
+		}
+		if m.Previous != "" {
+			qp.MapEntry(ma, "previous", keyAssembler(m.Previous))
+		}
+		if m.Branch != "" {
+			qp.MapEntry(ma, "branch", qp.String(m.Branch))
+		}
+		if m.BranchRoot != "" {
+			qp.MapEntry(ma, "branchRoot", keyAssembler(m.BranchRoot))
+		}
+		if len(m.Properties) > 0 {
+			qp.MapEntry(ma, "properties", qp.Map(int64(len(m.Properties)), func(ma datamodel.MapAssembler) {
+				for k, v := range m.Properties {
+					qp.MapEntry(ma, k, qp.String(v))
+				}
+			}))
+		}
+		if len(m.Branches) > 0 {
+			qp.MapEntry(ma, "branches", qp.List(int64(len(m.Branches)), func(la datamodel.ListAssembler) {
+				for _, b := range m.Branches {
+					qp.ListEntry(la, qp.String(b))
+				}
+			}))
+		}
+		if len(m.Parents) > 0 {
+			qp.MapEntry(ma, "parents", qp.List(int64(len(m.Parents)), func(la datamodel.ListAssembler) {
+				for _, p := range m.Parents {
+					qp.ListEntry(la, keyAssembler(p))
+				}
+			}))
+		}
+		if len(m.Skips) > 0 {
+			qp.MapEntry(ma, "skips", qp.List(int64(len(m.Skips)), func(la datamodel.ListAssembler) {
+				for _, s := range m.Skips {
+					qp.ListEntry(la, keyAssembler(s))
+				}
+			}))
+		}
+		if m.MerkleRoot != "" {
+			qp.MapEntry(ma, "merkleRoot", qp.String(m.MerkleRoot))
+		}
+		if m.Redacts != "" {
+			qp.MapEntry(ma, "redacts", keyAssembler(m.Redacts))
+		}
+		if len(m.Data) > 0 {
+			qp.MapEntry(ma, "data", qp.Bytes(m.Data))
+		}
+		if m.DataHash != "" {
+			qp.MapEntry(ma, "dataHash", qp.String(m.DataHash))
+		}
+		if m.DataSize != 0 {
+			qp.MapEntry(ma, "dataSize", qp.Int(m.DataSize))
+		}
+		if len(m.DataChunks) > 0 {
+			qp.MapEntry(ma, "dataChunks", qp.List(int64(len(m.DataChunks)), func(la datamodel.ListAssembler) {
+				for _, c := range m.DataChunks {
+					qp.ListEntry(la, keyAssembler(c))
+				}
+			}))
+		}
+		if m.PubKey != "" {
+			qp.MapEntry(ma, "pubKey", qp.String(m.PubKey))
+		}
+		if m.Signature != "" {
+			qp.MapEntry(ma, "signature", qp.String(m.Signature))
+		}
+	})
+	if er != nil {
+		return nil, er
+	}
+	var buf bytes.Buffer
+	er = dagcbor.Encode(n, &buf)
+	if er != nil {
+		return nil, er
+	}
+	return buf.Bytes(), nil
+}
+
+// FromCbor deserializes a DAG-CBOR encoded node produced by ToCbor.
+func (m *Node) FromCbor(b []byte) error {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	er := dagcbor.Decode(nb, bytes.NewReader(b))
+	if er != nil {
+		return er
+	}
+	n := nb.Build()
+	if n.Kind() != datamodel.Kind_Map {
+		return ErrInvalidNodeEncoding
+	}
+	it := n.MapIterator()
+	for !it.Done() {
+		k, v, er := it.Next()
+		if er != nil {
+			return er
+		}
+		name, er := k.AsString()
+		if er != nil {
+			return er
+		}
+		er = m.setCborField(name, v)
+		if er != nil {
+			return fmt.Errorf("%w: field %s: %s", ErrInvalidNodeEncoding, name, er)
+		}
+	}
+	return nil
+}
+
+func (m *Node) setCborField(name string, v datamodel.Node) error {
+	var er error
+	switch name {
+	case "version":
+		var i int64
+		i, er = v.AsInt()
+		m.Version = int32(i)
+	case "type":
+		m.Type, er = v.AsString()
+	case "seq":
+		m.Seq, er = v.AsInt()
+	case "clock":
+		var i int64
+		i, er = v.AsInt()
+		if er == nil && i < 0 {
+			er = fmt.Errorf("negative clock %d", i)
+		}
+		m.Clock = uint64(i)
+	case "timestamp":
+		m.Timestamp, er = v.AsString()
+	case "address":
+		m.Address, er = v.AsString()
+	case "previous":
+		m.Previous, er = keyFromNode(v)
+	case "branch":
+		m.Branch, er = v.AsString()
+	case "branchRoot":
+		m.BranchRoot, er = keyFromNode(v)
+	case "properties":
+		m.Properties = make(map[string]string, v.Length())
+		it := v.MapIterator()
+		for it != nil && !it.Done() {
+			pk, pv, er := it.Next()
+			if er != nil {
+				return er
+			}
+			key, er := pk.AsString()
+			if er != nil {
+				return er
+			}
+			m.Properties[key], er = pv.AsString()
+			if er != nil {
+				return er
+			}
+		}
+	case "branches":
+		m.Branches, er = stringsFromNode(v)
+	case "parents":
+		m.Parents, er = keysFromNode(v)
+	case "skips":
+		m.Skips, er = keysFromNode(v)
+	case "merkleRoot":
+		m.MerkleRoot, er = v.AsString()
+	case "redacts":
+		m.Redacts, er = keyFromNode(v)
+	case "data":
+		m.Data, er = v.AsBytes()
+	case "dataHash":
+		m.DataHash, er = v.AsString()
+	case "dataSize":
+		m.DataSize, er = v.AsInt()
+	case "dataChunks":
+		m.DataChunks, er = keysFromNode(v)
+	case "pubKey":
+		m.PubKey, er = v.AsString()
+	case "signature":
+		m.Signature, er = v.AsString()
+	}
+	return er
+}
+
+// decodeNode decodes a stored node. Nodes were originally stored as JSON, so
+// both encodings are accepted.
+func decodeNode(b []byte) (*Node, error) {
+	n := &Node{}
+	if isJson(b) {
+		return n, n.FromJson(b)
+	}
+	return n, n.FromCbor(b)
+}
+
+func isJson(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '{'
+}
+
+// keyAssembler writes a node key as a link when it is a CID in its canonical
+// string form, preserving the exact key that was signed.
+func keyAssembler(key string) qp.Assemble {
+	c, er := cid.Parse(key)
+	if er != nil || c.String() != key {
+		return qp.String(key)
+	}
+	return qp.Link(cidlink.Link{Cid: c})
+}
+
+func keyFromNode(v datamodel.Node) (string, error) {
+	if v.Kind() != datamodel.Kind_Link {
+		return v.AsString()
+	}
+	l, er := v.AsLink()
+	if er != nil {
+		return "", er
+	}
+	cl, ok := l.(cidlink.Link)
+	if !ok {
+		return "", ErrInvalidNodeEncoding
+	}
+	return cl.Cid.String(), nil
+}
+
+func keysFromNode(v datamodel.Node) ([]string, error) {
+	result := make([]string, 0, v.Length())
+	it := v.ListIterator()
+	for it != nil && !it.Done() {
+		_, item, er := it.Next()
+		if er != nil {
+			return nil, er
+		}
+		key, er := keyFromNode(item)
+		if er != nil {
+			return nil, er
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+func stringsFromNode(v datamodel.Node) ([]string, error) {
+	result := make([]string, 0, v.Length())
+	it := v.ListIterator()
+	for it != nil && !it.Done() {
+		_, item, er := it.Next()
+		if er != nil {
+			return nil, er
+		}
+		s, er := item.AsString()
+		if er != nil {
+			return nil, er
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package dag_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Codec", func() {
+	const prevCid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	const rootCid = "bafyreigdmqpykrgxyaxtlafqpqhzrb7qy2rh75nldvfd4tucqmqqme5yje"
+
+	addr, _ := address.NewAddressWithKeys()
+
+	It("Should round trip a node through DAG-CBOR", func() {
+		n := CreateNodeV2(addr, rootCid, prevCid, defaultBranch, 2)
+		n.Properties = map[string]string{"a": "1", "b": "2"}
+		n.Branches = []string{"likes", "comments"}
+		n.Clock = 7
+
+		b, err := n.ToCbor()
+		Expect(err).To(BeNil())
+
+		decoded := &dag.Node{}
+		err = decoded.FromCbor(b)
+		Expect(err).To(BeNil())
+		Expect(decoded).To(Equal(n))
+	})
+
+	It("Should write CID keys as IPLD links", func() {
+		n := CreateNodeV2(addr, rootCid, prevCid, defaultBranch, 2)
+		b, err := n.ToCbor()
+		Expect(err).To(BeNil())
+
+		nb := basicnode.Prototype.Any.NewBuilder()
+		Expect(dagcbor.Decode(nb, bytes.NewReader(b))).To(BeNil())
+		decoded := nb.Build()
+
+		previous, err := decoded.LookupByString("previous")
+		Expect(err).To(BeNil())
+		Expect(previous.Kind()).To(Equal(datamodel.Kind_Link))
+		branchRoot, err := decoded.LookupByString("branchRoot")
+		Expect(err).To(BeNil())
+		Expect(branchRoot.Kind()).To(Equal(datamodel.Kind_Link))
+	})
+
+	It("Should keep non CID keys as strings", func() {
+		n := CreateNodeV2(addr, "somekey", "otherkey", defaultBranch, 2)
+		b, err := n.ToCbor()
+		Expect(err).To(BeNil())
+
+		decoded := &dag.Node{}
+		Expect(decoded.FromCbor(b)).To(BeNil())
+		Expect(decoded.Previous).To(Equal("otherkey"))
+		Expect(decoded.BranchRoot).To(Equal("somekey"))
+		Expect(decoded.VerifySignature()).To(BeNil())
+	})
+
+	It("Should read legacy JSON nodes", func() {
+		ctx := context.Background()
+		lts := datastore.NewLocalFileStore()
+		da := dag.NewDag("test-ledger", lts, resolver.NewLocalResolver())
+
+		n := CreateNode(addr, "somekey", "otherkey", defaultBranch, 2)
+		js, err := n.ToJson()
+		Expect(err).To(BeNil())
+		key, _, err := lts.Put(ctx, js, nil)
+		Expect(err).To(BeNil())
+
+		legacy, err := da.Get(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(legacy).To(Equal(n))
+	})
+})
@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"io"
+	"iter"
 	"strings"
 	"time"
 
+	"github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
 	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/cache"
 	"github.com/msaldanha/setinstone/datastore"
 	"github.com/msaldanha/setinstone/resolver"
+	"github.com/msaldanha/setinstone/tsa"
 )
 
 // DagInterface defines the public operations available to interact with a DAG of nodes.
@@ -20,7 +26,35 @@ type DagInterface interface {
 	GetRoot(ctx context.Context, addr string) (*Node, string, error)
 	Get(ctx context.Context, key string) (*Node, error)
 	Append(ctx context.Context, node *Node, branchRootNodeKey string) (string, error)
+	AppendBatch(ctx context.Context, branchRootNodeKey, branch string, count int, build NodeBuilder) ([]string, error)
 	VerifyNode(ctx context.Context, node *Node, branchRootNodeKey string, isNew bool) error
+	VerifyChain(ctx context.Context, branchRootNodeKey, branch string) (*ChainReport, error)
+	SeekSeq(ctx context.Context, fromKey string, seq int64) (*Node, string, error)
+	MerkleRoot(ctx context.Context, headKey string, size int64) (string, error)
+	NextClock(ctx context.Context, node *Node) (uint64, error)
+	ProveInclusion(ctx context.Context, checkpointKey, nodeKey string) (*InclusionProof, error)
+	PrepareData(ctx context.Context, node *Node) error
+	PrepareDataFrom(ctx context.Context, node *Node, r io.Reader) error
+	OpenData(ctx context.Context, node *Node) (io.ReadCloser, error)
+	InlineData(ctx context.Context, node *Node) ([]byte, error)
+	CreateBranch(ctx context.Context, node *Node) (string, error)
+	CloseBranch(ctx context.Context, node *Node, branchRootNodeKey string) (string, error)
+	ListBranches(ctx context.Context, key string) ([]BranchInfo, error)
+	GetBranch(ctx context.Context, key, branch string) (*BranchInfo, error)
+	Redact(ctx context.Context, node *Node, branchRootNodeKey string) (string, error)
+	Countersign(ctx context.Context, key string, authority tsa.Authority) (*tsa.Token, error)
+	GetTimestampToken(ctx context.Context, key string) (*tsa.Token, error)
+	GetRedaction(ctx context.Context, key string) (string, error)
+	WalkAddress(ctx context.Context, addr string, fn WalkFunc) error
+	Walk(ctx context.Context, fromKey string, fn WalkFunc, options ...WalkOption) error
+	WalkKeys(ctx context.Context, rootKey string, fn func(key string) error) error
+	NodeLinks(ctx context.Context, addr string) iter.Seq2[datastore.Link, error]
+	Heads(ctx context.Context, addr string) ([]string, error)
+	MissingNodes(ctx context.Context, addr string, heads []string) ([]string, error)
+	GetNodeBytes(ctx context.Context, key string) ([]byte, error)
+	PutNodeBytes(ctx context.Context, key string, data []byte) error
+	Export(ctx context.Context, addr string, w io.Writer) error
+	Import(ctx context.Context, r io.Reader) (string, error)
 	Manage(addr *address.Address) error
 }
 
@@ -28,9 +62,18 @@ type DagInterface interface {
 // datastore and resolves human-readable names using a Resolver in the provided
 // namespace.
 type Dag struct {
-	nameSpace string
-	dt        datastore.DataStore
-	resolver  resolver.Resolver
+	nameSpace           string
+	maxInlineDataSize   int
+	dataChunkSize       int
+	maxNodeSize         int64
+	dt                  datastore.DataStore
+	resolver            resolver.Resolver
+	equivocations       *equivocationDetector
+	equivocationHandler EquivocationHandler
+	rules               []ValidationRule
+	timestampAuthority  tsa.Authority
+	nodeCache           cache.Cache[*Node]
+	logger              *zap.Logger
 }
 
 var _ DagInterface = (*Dag)(nil)
@@ -40,10 +83,25 @@ var _ DagInterface = (*Dag)(nil)
 //   - nameSpace: logical namespace used to build resolver names
 //   - dt: implementation of DataStore used to persist and fetch nodes
 //   - resolver: implementation used to Resolve/Add names
+//   - options: optional settings, see DagOption
 //
 // Returns a Dag instance.
-func NewDag(nameSpace string, dt datastore.DataStore, resolver resolver.Resolver) *Dag {
-	return &Dag{nameSpace: nameSpace, dt: dt, resolver: resolver}
+func NewDag(nameSpace string, dt datastore.DataStore, resolver resolver.Resolver, options ...DagOption) *Dag {
+	d := &Dag{
+		nameSpace:     nameSpace,
+		dt:            dt,
+		resolver:      resolver,
+		equivocations: newEquivocationDetector(),
+		logger:        zap.NewNop(),
+
+		maxInlineDataSize: DefaultMaxInlineDataSize,
+		dataChunkSize:     DefaultDataChunkSize,
+		maxNodeSize:       DefaultMaxNodeSize,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
 }
 
 // SetRoot initializes a DAG for the given address with the provided root node.
@@ -70,7 +128,9 @@ func (da *Dag) SetRoot(ctx context.Context, rootNode *Node) (string, error) {
 
 // Append verifies and stores a new node as the next element of a branch that
 // is rooted at branchRootNodeKey. It also updates resolver shortcuts for the
-// branch head. Returns the persisted node key.
+// branch head. The head only moves if it still is node.Previous; when another
+// append won the race, ErrConcurrentAppend is returned and the caller can
+// retry on top of the new head. Returns the persisted node key.
 func (da *Dag) Append(ctx context.Context, node *Node, branchRootNodeKey string) (string, error) {
 	if er := da.VerifyNode(ctx, node, branchRootNodeKey, true); er != nil {
 		return "", da.translateError(er)
@@ -101,6 +161,7 @@ func (da *Dag) GetLast(ctx context.Context, branchRootNodeKey, branch string) (*
 	if er != nil {
 		return nil, "", da.translateError(er)
 	}
+	da.observeRead(ctx, fromTipTx, key)
 	return fromTipTx, key, nil
 }
 
@@ -120,19 +181,40 @@ func (da *Dag) GetRoot(ctx context.Context, addr string) (*Node, string, error)
 
 // Get fetches and deserializes a node by its storage key.
 func (da *Dag) Get(ctx context.Context, key string) (*Node, error) {
-	return da.getNodeByKey(ctx, key)
+	n, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return nil, er
+	}
+	da.observeRead(ctx, n, key)
+	return n, nil
 }
 
 // VerifyNode validates a node before it is appended or accepted.
 // It checks:
 //   - Address is valid and matches the public key
-//   - Timestamp is RFC3339-formatted
+//   - Timestamp is RFC3339-formatted and not before the previous node Timestamp
 //   - Seq is non-zero and consistent with the previous node and branch rules
-//   - Signature is valid
+//   - Version is supported (v1 and v2) and the signature is valid for it
 //   - Branch is specified and, when mustBeNew is true, exists under the branch root
+//   - For merge nodes, every parent exists, is distinct from Previous and
+//     belongs to the same address
+//   - Type is known; typed nodes must be v2
+//   - Skip pointers, when present, are the ones derived from the previous node
+//   - Checkpoints commit to the Merkle root of all the branch nodes before them
+//   - Tombstones redact an existing node of the same address, which is not a
+//     tombstone itself and, when mustBeNew is true, was not redacted yet
+//   - Clock, if set, is greater than the clocks of the nodes the node follows,
+//     and, when mustBeNew is true, than the address clock; it is set if any of
+//     them has one
+//   - Every rule registered with WithValidationRules accepts the node; the
+//     first rejection is returned as a *RuleViolationError
+//   - Payloads are either inline or referenced by a v2 node through their hash,
+//     size and chunks; chunks are not fetched
 //
 // When mustBeNew is true, it also verifies that the previous node is the current
-// branch head and enforces sequencing constraints for branch changes.
+// branch head, that the branch was not closed, and enforces sequencing
+// constraints for branch changes. Branch-open nodes must instead start a branch
+// that does not exist yet at their branch root.
 func (da *Dag) VerifyNode(ctx context.Context, node *Node, branchRootNodeKey string, mustBeNew bool) error {
 	if ok, er := da.verifyAddress(node); !ok {
 		return da.translateError(er)
@@ -149,6 +231,12 @@ func (da *Dag) VerifyNode(ctx context.Context, node *Node, branchRootNodeKey str
 	if node.Branch == "" {
 		return ErrInvalidBranch
 	}
+	if er := da.verifyType(node); er != nil {
+		return er
+	}
+	if er := da.verifyData(node); er != nil {
+		return er
+	}
 
 	previous, er := da.getNodeByKey(ctx, node.Previous)
 	if errors.Is(er, ErrNodeNotFound) {
@@ -160,6 +248,36 @@ func (da *Dag) VerifyNode(ctx context.Context, node *Node, branchRootNodeKey str
 	if previous == nil {
 		return ErrPreviousNodeNotFound
 	}
+	if er := da.verifyTimestampOrder(node, previous); er != nil {
+		return er
+	}
+	if node.IsMerge() {
+		if er := da.verifyParents(ctx, node); er != nil {
+			return er
+		}
+	}
+	if er := da.verifySkips(node, previous); er != nil {
+		return er
+	}
+	if node.IsCheckpoint() {
+		if er := da.verifyCheckpoint(ctx, node); er != nil {
+			return er
+		}
+	}
+	if node.IsTombstone() {
+		if er := da.verifyTombstone(ctx, node, mustBeNew); er != nil {
+			return er
+		}
+	}
+	if er := da.verifyClock(ctx, node, mustBeNew); er != nil {
+		return er
+	}
+	if er := da.verifyRules(ctx, node, previous); er != nil {
+		return er
+	}
+	if mustBeNew && node.IsBranchOpen() {
+		return da.verifyBranchOpen(ctx, node, branchRootNodeKey)
+	}
 	if mustBeNew {
 		branchRoot, er := da.getNodeByKey(ctx, branchRootNodeKey)
 		if er != nil {
@@ -168,7 +286,11 @@ func (da *Dag) VerifyNode(ctx context.Context, node *Node, branchRootNodeKey str
 		if branchRoot == nil {
 			return ErrBranchRootNotFound
 		}
-		if !da.hasBranch(branchRoot, node.Branch) {
+		exists, er := da.branchExists(ctx, branchRoot, branchRootNodeKey, node.Branch)
+		if er != nil {
+			return da.translateError(er)
+		}
+		if !exists {
 			return ErrInvalidBranch
 		}
 		branchHead, branchHeadKey, er := da.GetLast(ctx, branchRootNodeKey, node.Branch)
@@ -178,6 +300,9 @@ func (da *Dag) VerifyNode(ctx context.Context, node *Node, branchRootNodeKey str
 		if branchHead == nil {
 			return ErrHeadNodeNotFound
 		}
+		if branchHeadKey != branchRootNodeKey && branchHead.IsBranchClose() {
+			return ErrBranchClosed
+		}
 		if branchHeadKey != node.Previous {
 			return ErrPreviousNodeIsNotHead
 		}
@@ -198,6 +323,74 @@ func (da *Dag) Manage(addr *address.Address) error {
 	return da.resolver.Manage(addr)
 }
 
+// observe feeds a verified and stored node, and its key, to the equivocation
+// detector and notifies the registered handler when it conflicts with a node
+// seen before. Only nodes that were verified and stored are observed, so a
+// rejected append followed by a corrected one for the same position is not
+// reported.
+func (da *Dag) observe(ctx context.Context, node *Node, key string) {
+	seenKey := da.equivocations.observe(node, key)
+	if seenKey == "" {
+		return
+	}
+	seen, er := da.getNodeByKey(ctx, seenKey)
+	if er != nil || seen == nil {
+		da.equivocations.replace(node, key)
+		return
+	}
+	proof := EquivocationProof{First: seen, Second: node}
+	if proof.Verify() == nil && da.equivocationHandler != nil {
+		da.equivocationHandler(proof)
+	}
+}
+
+// observeRead observes a node read from the data store, which may not have
+// been stored through this Dag, e.g. fetched from the network. Its signature
+// is only verified the first time it is seen for its position, so reading an
+// observed node again costs a lookup.
+func (da *Dag) observeRead(ctx context.Context, node *Node, key string) {
+	if node == nil || da.equivocations.seen(node, key) || node.VerifySignature() != nil {
+		return
+	}
+	da.observe(ctx, node, key)
+}
+
+// verifyType checks the node type. Types are only signed by v2 nodes.
+func (da *Dag) verifyType(node *Node) error {
+	if node.MerkleRoot != "" && !node.IsCheckpoint() {
+		return ErrInvalidCheckpoint
+	}
+	if node.Redacts != "" && !node.IsTombstone() {
+		return ErrInvalidTombstone
+	}
+	switch node.Type {
+	case "":
+		return nil
+	case NodeTypeBranchOpen:
+		if node.Seq != 1 {
+			return ErrInvalidBranchSeq
+		}
+		if node.BranchRoot == "" || node.Previous != node.BranchRoot {
+			return ErrInvalidBranchRoot
+		}
+	case NodeTypeBranchClose:
+	case NodeTypeCheckpoint:
+		if node.MerkleRoot == "" {
+			return ErrInvalidCheckpoint
+		}
+	case NodeTypeTombstone:
+		if node.Redacts == "" || len(node.Data) > 0 || node.HasExternalData() {
+			return ErrInvalidTombstone
+		}
+	default:
+		return ErrInvalidNodeType
+	}
+	if node.GetVersion() < NodeVersion2 {
+		return ErrInvalidNodeType
+	}
+	return nil
+}
+
 func (da *Dag) verifyTimeStamp(node *Node) bool {
 	_, er := time.Parse(time.RFC3339, node.Timestamp)
 	if er != nil {
@@ -206,6 +399,32 @@ func (da *Dag) verifyTimeStamp(node *Node) bool {
 	return true
 }
 
+// verifyParents checks the extra parents of a merge node. Merges are only
+// allowed on v2 nodes, whose signature covers the parents.
+func (da *Dag) verifyParents(ctx context.Context, node *Node) error {
+	if node.GetVersion() < NodeVersion2 {
+		return ErrInvalidMergeNode
+	}
+	seen := map[string]bool{node.Previous: true}
+	for _, key := range node.Parents {
+		if key == "" || seen[key] {
+			return ErrInvalidMergeNode
+		}
+		seen[key] = true
+		parent, er := da.getNodeByKey(ctx, key)
+		if errors.Is(er, ErrNodeNotFound) || (er == nil && parent == nil) {
+			return ErrMergeParentNotFound
+		}
+		if er != nil {
+			return da.translateError(er)
+		}
+		if parent.Address != node.Address {
+			return ErrInvalidMergeNode
+		}
+	}
+	return nil
+}
+
 func (da *Dag) findPrevious(ctx context.Context, node *Node) (*Node, error) {
 	return da.getNodeByKey(ctx, node.Previous)
 }
@@ -240,22 +459,28 @@ func (da *Dag) saveNode(ctx context.Context, node *Node, branchRootNodeKey strin
 		return "", ErrBranchRootNotFound
 	}
 
-	fullPath, er := da.getFullPath(ctx, branchRootNodeKey)
-
-	data, er := node.ToJson()
+	key, er := da.storeNode(ctx, node, branchRootNodeKey)
 	if er != nil {
 		return "", da.translateError(er)
 	}
-	key, _, er := da.dt.Put(ctx, data, func(cid string) string {
-		return strings.Join([]string{fullPath, "branches", node.Branch, cid, "node"}, "/")
-	})
+
+	expectedHead := node.Previous
+	if node.IsBranchOpen() {
+		er = da.addOpenedBranch(ctx, branchRoot, branchRootNodeKey, node.Branch)
+		if er != nil {
+			return "", da.translateError(er)
+		}
+		expectedHead = ""
+	}
+
+	clockKey, er := da.claimClock(ctx, node, key)
 	if er != nil {
 		return "", da.translateError(er)
 	}
-
 	lastNodeName := da.getLastNodeName(branchRoot, branchRootNodeKey, node.Branch)
-	er = da.resolver.Add(ctx, lastNodeName, key)
+	er = da.resolver.CompareAndSwap(ctx, lastNodeName, expectedHead, key)
 	if er != nil {
+		da.releaseClock(ctx, node, key, clockKey)
 		return "", da.translateError(er)
 	}
 
@@ -263,31 +488,79 @@ func (da *Dag) saveNode(ctx context.Context, node *Node, branchRootNodeKey strin
 	if er != nil {
 		return "", da.translateError(er)
 	}
+	er = da.addHeads(ctx, node.Address, []string{key}, []*Node{node})
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	da.observe(ctx, node, key)
+
+	if node.IsTombstone() {
+		er = da.applyRedaction(ctx, node, key)
+		if er != nil {
+			return "", da.translateError(er)
+		}
+		da.releaseChunks(ctx, node)
+	}
+
+	er = da.countersignAppended(ctx, key)
+	if er != nil {
+		return key, er
+	}
 
 	return key, nil
 }
 
-func (da *Dag) saveRootNode(ctx context.Context, node *Node) (string, error) {
-	data, er := node.ToJson()
+// storeNode stores a node under the path of its branch, without updating any
+// resolver name.
+func (da *Dag) storeNode(ctx context.Context, node *Node, branchRootNodeKey string) (string, error) {
+	pathFunc, er := da.branchPathFunc(ctx, node, branchRootNodeKey)
 	if er != nil {
-		return "", da.translateError(er)
+		return "", er
 	}
+	return da.putNode(ctx, node, pathFunc)
+}
 
-	key, _, er := da.dt.Put(ctx, data, func(cid string) string {
+// branchPathFunc returns the function building the path a node is stored
+// under, inside the path of its branch root.
+func (da *Dag) branchPathFunc(ctx context.Context, node *Node, branchRootNodeKey string) (datastore.PathFunc, error) {
+	fullPath, er := da.getFullPath(ctx, branchRootNodeKey)
+	if er != nil {
+		return nil, er
+	}
+	return func(cid string) string {
+		return strings.Join([]string{fullPath, "branches", node.Branch, cid, "node"}, "/")
+	}, nil
+}
+
+func (da *Dag) saveRootNode(ctx context.Context, node *Node) (string, error) {
+	key, er := da.putNode(ctx, node, func(cid string) string {
 		return da.getName(node.Address, cid, "node")
 	})
 	if er != nil {
 		return "", da.translateError(er)
 	}
 
+	rootName := da.getRootNodeName(node.Address)
+	er = da.resolver.CompareAndSwap(ctx, rootName, "", key)
+	if errors.Is(er, resolver.ErrValueChanged) {
+		return "", ErrDagAlreadyInitialized
+	}
+	if er != nil {
+		return "", da.translateError(er)
+	}
+
 	lastNodeName := da.getLastNodeName(node, key, node.Branch)
 	er = da.resolver.Add(ctx, lastNodeName, key)
 	if er != nil {
 		return "", da.translateError(er)
 	}
 
-	rootName := da.getRootNodeName(node.Address)
-	er = da.resolver.Add(ctx, rootName, key)
+	er = da.advanceClock(ctx, node, key)
+	if er != nil {
+		return "", da.translateError(er)
+	}
+
+	er = da.addHeads(ctx, node.Address, []string{key}, []*Node{node})
 	if er != nil {
 		return "", da.translateError(er)
 	}
@@ -300,6 +573,27 @@ func (da *Dag) saveRootNode(ctx context.Context, node *Node) (string, error) {
 	return key, nil
 }
 
+// putNode stores the node encoded as DAG-CBOR. When the data store supports
+// native blocks the node is stored as one, letting IPFS follow its links.
+func (da *Dag) putNode(ctx context.Context, node *Node, pathFunc datastore.PathFunc) (string, error) {
+	data, er := node.ToCbor()
+	if er != nil {
+		return "", er
+	}
+	return da.putNodeBytes(ctx, data, pathFunc)
+}
+
+// putNodeBytes stores an already encoded node. Only DAG-CBOR nodes are stored
+// as native blocks; nodes in the original JSON encoding are kept as files.
+func (da *Dag) putNodeBytes(ctx context.Context, data []byte, pathFunc datastore.PathFunc) (string, error) {
+	if bp, ok := da.dt.(datastore.BlockPutter); ok && !isJson(data) {
+		key, _, er := bp.PutBlock(ctx, data, cid.DagCBOR, pathFunc)
+		return key, er
+	}
+	key, _, er := da.dt.Put(ctx, data, pathFunc)
+	return key, er
+}
+
 func (da *Dag) addResolutionForNodeBranches(ctx context.Context, node *Node, key string) error {
 	for _, branch := range node.Branches {
 		lastNodeName := da.getLastNodeName(node, key, branch)
@@ -320,34 +614,48 @@ func (da *Dag) hasBranch(p *Node, branch string) bool {
 	return false
 }
 
+// CacheStats returns the hit and miss counts of the node cache set with
+// WithNodeCache. They are zero if there is no cache or it keeps no stats.
+func (da *Dag) CacheStats() cache.Stats {
+	if r, ok := da.nodeCache.(cache.StatsReporter); ok {
+		return r.Stats()
+	}
+	return cache.Stats{}
+}
+
+// getNodeByKey returns the node stored under key, from the node cache if
+// there is one.
 func (da *Dag) getNodeByKey(ctx context.Context, key string) (*Node, error) {
+	if da.nodeCache == nil || key == "" {
+		return da.readNode(ctx, key)
+	}
+	if n, found, _ := da.nodeCache.Get(key); found {
+		return n.Clone(), nil
+	}
+	n, er := da.readNode(ctx, key)
+	if er != nil || n == nil {
+		return n, er
+	}
+	_ = da.nodeCache.Add(key, n.Clone())
+	return n, nil
+}
+
+func (da *Dag) readNode(ctx context.Context, key string) (*Node, error) {
 	f, er := da.dt.Get(ctx, key)
 	if er != nil {
 		return nil, da.translateError(er)
 	}
 
-	var json []byte
-	const NBUF = 512
-	var buf [NBUF]byte
-	for {
-		nr, er := f.Read(buf[:])
-		if nr > 0 {
-			json = append(json, buf[0:nr]...)
-		}
-		if er == io.EOF {
-			break
-		}
-		if er != nil {
-			return nil, da.translateError(er)
-		}
+	data, er := da.readLimited(f)
+	if er != nil {
+		return nil, da.translateError(er)
 	}
 
-	if len(json) == 0 {
+	if len(data) == 0 {
 		return nil, nil
 	}
 
-	n := &Node{}
-	er = n.FromJson(json)
+	n, er := decodeNode(data)
 	if er != nil {
 		return nil, da.translateError(er)
 	}
@@ -373,6 +681,18 @@ func (da *Dag) resolveNodeKey(ctx context.Context, name string) (string, error)
 	return resolved, nil
 }
 
+// resolveManagedName resolves a name the Dag keeps about the nodes of addr
+// besides its shortcuts, such as indexes, clocks, redactions and timestamps.
+// Those names are only kept for the addresses the resolver manages, so for
+// other addresses resolver.ErrNotFound is returned without resolving name,
+// which could otherwise wait on the network for a name nobody has.
+func (da *Dag) resolveManagedName(ctx context.Context, addr, name string) (string, error) {
+	if !da.resolver.IsManaged(addr) {
+		return "", resolver.ErrNotFound
+	}
+	return da.resolveNodeKey(ctx, name)
+}
+
 func (da *Dag) getRootNodeName(addr string) string {
 	return da.getName(addr, "shortcuts", "root")
 }
@@ -385,10 +705,30 @@ func (da *Dag) getName(addr string, parts ...string) string {
 	return "/" + addr + "/" + da.nameSpace + "/dag/" + strings.Join(parts, "/")
 }
 
+// readLimited reads a node, or another blob the Dag stores, from r. Reading
+// stops past the configured limit (see WithMaxNodeSize), failing with
+// ErrNodeTooLarge, so a corrupt or malicious store can't make the Dag buffer
+// arbitrarily large content.
+func (da *Dag) readLimited(r io.Reader) ([]byte, error) {
+	if da.maxNodeSize <= 0 {
+		return io.ReadAll(r)
+	}
+	data, er := io.ReadAll(io.LimitReader(r, da.maxNodeSize+1))
+	if er != nil {
+		return nil, er
+	}
+	if int64(len(data)) > da.maxNodeSize {
+		return nil, ErrNodeTooLarge
+	}
+	return data, nil
+}
+
 func (da *Dag) translateError(er error) error {
 	switch {
 	case errors.Is(er, datastore.ErrNotFound):
 		return ErrNodeNotFound
+	case errors.Is(er, resolver.ErrValueChanged):
+		return ErrConcurrentAppend
 	}
 	return er
 }
@@ -2,6 +2,7 @@ package dag_test
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -124,7 +125,7 @@ var _ = Describe("Dag", func() {
 		// create main branch
 		prev := genesisKey
 		for x := 1; x <= 4; x++ {
-			n := CreateNode(gAddr, genesisKey, prev, defaultBranch, g.Seq+int32(x))
+			n := CreateNode(gAddr, genesisKey, prev, defaultBranch, g.Seq+int64(x))
 			nodeKey, err := da.Append(ctx, n, genesisKey)
 			Expect(err).To(BeNil())
 			prev = nodeKey
@@ -139,7 +140,7 @@ var _ = Describe("Dag", func() {
 		prev = nodeWithBranchesKey
 		var lastMainBranch *dag.Node
 		for x := 1; x <= 5; x++ {
-			n := CreateNode(gAddr, genesisKey, prev, defaultBranch, nodeWithBranches.Seq+int32(x))
+			n := CreateNode(gAddr, genesisKey, prev, defaultBranch, nodeWithBranches.Seq+int64(x))
 			nodeKey, err := da.Append(ctx, n, genesisKey)
 			Expect(err).To(BeNil())
 			prev = nodeKey
@@ -150,7 +151,7 @@ var _ = Describe("Dag", func() {
 		prev = nodeWithBranchesKey
 		var lastLikes *dag.Node
 		for x := 1; x <= 5; x++ {
-			n := CreateNode(gAddr, nodeWithBranchesKey, prev, "likes", int32(x))
+			n := CreateNode(gAddr, nodeWithBranchesKey, prev, "likes", int64(x))
 			nodeKey, err := da.Append(ctx, n, nodeWithBranchesKey)
 			Expect(err).To(BeNil())
 			prev = nodeKey
@@ -161,7 +162,7 @@ var _ = Describe("Dag", func() {
 		prev = nodeWithBranchesKey
 		var lastComments *dag.Node
 		for x := 1; x <= 5; x++ {
-			n := CreateNode(gAddr, nodeWithBranchesKey, prev, "comments", int32(x))
+			n := CreateNode(gAddr, nodeWithBranchesKey, prev, "comments", int64(x))
 			nodeKey, err := da.Append(ctx, n, nodeWithBranchesKey)
 			Expect(err).To(BeNil())
 			prev = nodeKey
@@ -191,28 +192,246 @@ var _ = Describe("Dag", func() {
 		//                      |
 		//                      n branch seq for this node should be 5
 
-		Expect(nodeWithBranches.Seq).To(Equal(int32(6)))
+		Expect(nodeWithBranches.Seq).To(Equal(int64(6)))
 
 		n, _, err := da.GetLast(ctx, nodeWithBranchesKey, "likes")
 		Expect(err).To(BeNil())
 		Expect(n).NotTo(BeNil())
 		Expect(n).To(Equal(lastLikes))
-		Expect(n.Seq).To(Equal(int32(5)))
+		Expect(n.Seq).To(Equal(int64(5)))
 
 		n, _, err = da.GetLast(ctx, nodeWithBranchesKey, "comments")
 		Expect(err).To(BeNil())
 		Expect(n).NotTo(BeNil())
 		Expect(n).To(Equal(lastComments))
-		Expect(n.Seq).To(Equal(int32(5)))
+		Expect(n.Seq).To(Equal(int64(5)))
 
 		n, _, err = da.GetLast(ctx, genesisKey, g.Branch)
 		Expect(err).To(BeNil())
 		Expect(n).NotTo(BeNil())
 		Expect(n).To(Equal(lastMainBranch))
-		Expect(n.Seq).To(Equal(int32(11)))
+		Expect(n.Seq).To(Equal(int64(11)))
 
 	})
 
+	It("Should add v2 nodes after a v1 root", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, genesisNode.Seq+1)
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+
+		node2, err := da.Get(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		Expect(node2).To(Equal(node))
+		Expect(node2.Version).To(Equal(dag.NodeVersion2))
+	})
+
+	It("Should NOT register v2 node moved to another branch root", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		node := CreateNodeV2(genesisAddr, "otherroot", genesisKey, defaultBranch, genesisNode.Seq+1)
+		t := *node
+		t.BranchRoot = genesisKey
+		_, err = da.Append(ctx, &t, genesisKey)
+		Expect(err).To(Equal(dag.ErrNodeSignatureDoesNotMatch))
+	})
+
+	It("Should add merge node joining another branch", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		branches := CreateNodeWithBranches(genesisAddr, genesisKey, genesisKey, []string{"drafts"}, defaultBranch, 2)
+		branchesKey, err := da.Append(ctx, branches, genesisKey)
+		Expect(err).To(BeNil())
+
+		draft := CreateNodeV2(genesisAddr, branchesKey, branchesKey, "drafts", 1)
+		draftKey, err := da.Append(ctx, draft, branchesKey)
+		Expect(err).To(BeNil())
+
+		merge := CreateNodeV2(genesisAddr, genesisKey, branchesKey, defaultBranch, 3)
+		merge.Parents = []string{draftKey}
+		_ = merge.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		mergeKey, err := da.Append(ctx, merge, genesisKey)
+		Expect(err).To(BeNil())
+
+		stored, err := da.Get(ctx, mergeKey)
+		Expect(err).To(BeNil())
+		Expect(stored.Parents).To(Equal([]string{draftKey}))
+		Expect(stored.IsMerge()).To(BeTrue())
+	})
+
+	It("Should NOT register invalid merge nodes", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		merge := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		merge.Parents = []string{"missing"}
+		_ = merge.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, merge, genesisKey)
+		Expect(err).To(Equal(dag.ErrMergeParentNotFound))
+
+		merge.Parents = []string{genesisKey}
+		_ = merge.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, merge, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidMergeNode))
+
+		other, otherAddr := CreateGenesisNode()
+		_ = res.Manage(otherAddr)
+		otherKey, err := da.SetRoot(ctx, other)
+		Expect(err).To(BeNil())
+		merge.Parents = []string{otherKey}
+		_ = merge.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, merge, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidMergeNode))
+
+		v1 := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		v1.Parents = []string{otherKey}
+		_, err = da.Append(ctx, v1, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidMergeNode))
+	})
+
+	It("Should open, list and close branches", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+		nodeKey, err := da.Append(ctx, CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+
+		open := CreateNodeV2(genesisAddr, nodeKey, nodeKey, "drafts", 1)
+		open.Type = dag.NodeTypeBranchOpen
+		_ = open.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		openKey, err := da.CreateBranch(ctx, open)
+		Expect(err).To(BeNil())
+
+		_, err = da.CreateBranch(ctx, open)
+		Expect(err).To(Equal(dag.ErrBranchAlreadyExists))
+
+		draftKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, nodeKey, openKey, "drafts", 2), nodeKey)
+		Expect(err).To(BeNil())
+
+		_, err = da.Append(ctx, CreateNodeV2(genesisAddr, nodeKey, nodeKey, "other", 1), nodeKey)
+		Expect(err).To(Equal(dag.ErrInvalidBranch))
+
+		branches, err := da.ListBranches(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		Expect(branches).To(Equal([]dag.BranchInfo{{Name: "drafts", Root: nodeKey, HeadKey: draftKey, Length: 2}}))
+
+		closeNode := CreateNodeV2(genesisAddr, nodeKey, draftKey, "drafts", 3)
+		closeNode.Type = dag.NodeTypeBranchClose
+		_ = closeNode.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		closeKey, err := da.CloseBranch(ctx, closeNode, nodeKey)
+		Expect(err).To(BeNil())
+
+		_, err = da.Append(ctx, CreateNodeV2(genesisAddr, nodeKey, closeKey, "drafts", 4), nodeKey)
+		Expect(err).To(Equal(dag.ErrBranchClosed))
+
+		info, err := da.GetBranch(ctx, nodeKey, "drafts")
+		Expect(err).To(BeNil())
+		Expect(*info).To(Equal(dag.BranchInfo{Name: "drafts", Root: nodeKey, HeadKey: closeKey, Length: 3, Closed: true}))
+
+		report, err := da.VerifyChain(ctx, nodeKey, "drafts")
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+	})
+
+	It("Should NOT register typed v1 nodes", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		open := CreateNode(genesisAddr, genesisKey, genesisKey, "drafts", 1)
+		open.Type = dag.NodeTypeBranchOpen
+		_ = open.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.CreateBranch(ctx, open)
+		Expect(err).To(Equal(dag.ErrInvalidNodeType))
+
+		unknown := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		unknown.Type = "unknown"
+		_ = unknown.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, unknown, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidNodeType))
+	})
+
+	It("Should NOT move the head when another node was appended concurrently", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		racing := &racingResolver{Resolver: res}
+		da = dag.NewDag("test-ledger", lts, racing)
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		winner := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		loser := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		var winnerKey string
+		racing.beforeSwap = func() {
+			racing.beforeSwap = nil
+			winnerKey, err = da.Append(ctx, winner, genesisKey)
+			Expect(err).To(BeNil())
+		}
+
+		_, err = da.Append(ctx, loser, genesisKey)
+		Expect(err).To(Equal(dag.ErrConcurrentAppend))
+
+		_, headKey, err := da.GetLast(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(headKey).To(Equal(winnerKey))
+	})
+
+	It("Should verify skip pointers and seek by seq", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		genesisKey, err := da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		keys := []string{genesisKey}
+		previous := genesisNode
+		for seq := int64(2); seq <= 20; seq++ {
+			node := CreateNodeV2(genesisAddr, genesisKey, keys[len(keys)-1], defaultBranch, seq)
+			node.Skips = dag.ComputeSkips(previous, keys[len(keys)-1], seq)
+			_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+			key, err := da.Append(ctx, node, genesisKey)
+			Expect(err).To(BeNil())
+			keys = append(keys, key)
+			previous = node
+		}
+		Expect(previous.Skips).To(Equal([]string{keys[17], keys[15], keys[15], keys[15]}))
+
+		for seq := int64(1); seq <= 20; seq++ {
+			node, key, err := da.SeekSeq(ctx, keys[19], seq)
+			Expect(err).To(BeNil())
+			Expect(key).To(Equal(keys[seq-1]))
+			Expect(node.Seq).To(Equal(seq))
+		}
+
+		bad := CreateNodeV2(genesisAddr, genesisKey, keys[19], defaultBranch, 21)
+		bad.Skips = []string{keys[0]}
+		_ = bad.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, bad, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidSkips))
+	})
+
 	It("Should NOT register node with invalid address", func() {
 		mockCtrl := gomock.NewController(GinkgoT())
 		defer mockCtrl.Finish()
@@ -321,6 +540,103 @@ var _ = Describe("Dag", func() {
 	})
 })
 
+var _ = Describe("Dag chain audit", func() {
+	var da *dag.Dag
+	var ctx context.Context
+	var lts datastore.DataStore
+	var res resolver.Resolver
+	var genesisNode *dag.Node
+	var genesisAddr *address.Address
+	var genesisKey string
+	var keys []string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		lts = datastore.NewLocalFileStore()
+		res = resolver.NewLocalResolver()
+		genesisNode, genesisAddr = CreateGenesisNode()
+		_ = res.Manage(genesisAddr)
+		da = dag.NewDag("test-ledger", lts, res)
+
+		var err error
+		genesisKey, err = da.SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+		keys = []string{genesisKey}
+		for x := 2; x <= 5; x++ {
+			n := CreateNodeV2(genesisAddr, genesisKey, keys[len(keys)-1], defaultBranch, int64(x))
+			key, err := da.Append(ctx, n, genesisKey)
+			Expect(err).To(BeNil())
+			keys = append(keys, key)
+		}
+	})
+
+	forceHead := func(n *dag.Node) string {
+		b, err := n.ToCbor()
+		Expect(err).To(BeNil())
+		key, _, err := lts.Put(ctx, b, nil)
+		Expect(err).To(BeNil())
+		name := "/" + genesisAddr.Address + "/test-ledger/dag/shortcuts/" + genesisKey + "/" + defaultBranch + "/last"
+		Expect(res.Add(ctx, name, key)).To(BeNil())
+		return key
+	}
+
+	It("Should report a valid chain", func() {
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+		Expect(report.Head).To(Equal(keys[len(keys)-1]))
+		Expect(report.Length).To(Equal(4))
+	})
+
+	It("Should report a gap in the sequence", func() {
+		n := CreateNodeV2(genesisAddr, genesisKey, keys[len(keys)-1], defaultBranch, 7)
+		key := forceHead(n)
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeFalse())
+		Expect(report.Violations).To(HaveLen(1))
+		Expect(report.Violations[0].Key).To(Equal(key))
+		Expect(report.Violations[0].Err).To(Equal(dag.ErrInvalidBranchSeq))
+	})
+
+	It("Should report tampered nodes, wrong branch roots and timestamps out of order", func() {
+		n := CreateNodeV2(genesisAddr, "otherroot", keys[len(keys)-1], defaultBranch, 6)
+		n.Timestamp = "2000-01-01T00:00:00Z"
+		n.Data = []byte("tampered")
+		key := forceHead(n)
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		var errs []error
+		for _, v := range report.Violations {
+			Expect(v.Key).To(Equal(key))
+			errs = append(errs, v.Err)
+		}
+		Expect(errs).To(ConsistOf(dag.ErrNodeSignatureDoesNotMatch, dag.ErrInvalidBranchRoot,
+			dag.ErrNodeTimestampOutOfOrder))
+	})
+
+	It("Should report nodes from another address", func() {
+		other, _ := address.NewAddressWithKeys()
+		n := CreateNodeV2(other, genesisKey, keys[len(keys)-1], defaultBranch, 6)
+		key := forceHead(n)
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Violations).To(ConsistOf(dag.ChainViolation{Key: key, Seq: 6, Err: dag.ErrNodeAddressMismatch}))
+	})
+
+	It("Should report missing previous nodes", func() {
+		n := CreateNodeV2(genesisAddr, genesisKey, "missing", defaultBranch, 6)
+		key := forceHead(n)
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Violations).To(ConsistOf(dag.ChainViolation{Key: key, Seq: 6, Err: dag.ErrPreviousNodeNotFound}))
+	})
+})
+
 func CreateGenesisNode() (*dag.Node, *address.Address) {
 	addr, _ := address.NewAddressWithKeys()
 
@@ -334,7 +650,7 @@ func CreateGenesisNode() (*dag.Node, *address.Address) {
 	return genesisNode, addr
 }
 
-func CreateNode(addr *address.Address, keyRoot, prev string, branch string, seq int32) *dag.Node {
+func CreateNode(addr *address.Address, keyRoot, prev string, branch string, seq int64) *dag.Node {
 	node := &dag.Node{}
 
 	if prev != "" {
@@ -355,7 +671,58 @@ func CreateNode(addr *address.Address, keyRoot, prev string, branch string, seq
 	return node
 }
 
-func CreateNodeWithBranches(addr *address.Address, keyRoot, prev string, branches []string, branch string, seq int32) *dag.Node {
+func CreateNodeV2(addr *address.Address, keyRoot, prev string, branch string, seq int64) *dag.Node {
+	node := CreateNode(addr, keyRoot, prev, branch, seq)
+	node.Version = dag.NodeVersion2
+	_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+	return node
+}
+
+// CreateNodeWithClock creates a v2 node on the default branch carrying clock.
+func CreateNodeWithClock(addr *address.Address, keyRoot, prev string, seq int64, clock uint64) *dag.Node {
+	node := CreateNodeV2(addr, keyRoot, prev, defaultBranch, seq)
+	node.Clock = clock
+	_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+	return node
+}
+
+// CreateNodeAt creates a v2 node on the default branch dated ts.
+func CreateNodeAt(addr *address.Address, keyRoot, prev string, seq int64, ts time.Time) *dag.Node {
+	node := CreateNodeV2(addr, keyRoot, prev, defaultBranch, seq)
+	node.Timestamp = ts.UTC().Format(time.RFC3339)
+	_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+	return node
+}
+
+// CreateTombstone creates a tombstone on the default branch redacting the node
+// with key redacts.
+func CreateTombstone(addr *address.Address, keyRoot, prev, redacts string, seq int64) *dag.Node {
+	node := CreateNodeV2(addr, keyRoot, prev, defaultBranch, seq)
+	node.Type = dag.NodeTypeTombstone
+	node.Redacts = redacts
+	node.Data = nil
+	_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+	return node
+}
+
+// CreateRootedDag creates a Dag over store, whose local resolver manages
+// addr, and sets genesisNode as its root. Returns the Dag and the root key.
+func CreateRootedDag(genesisNode *dag.Node, addr *address.Address, store datastore.DataStore, options ...dag.DagOption) (*dag.Dag, string) {
+	return CreateRootedDagWithResolver(genesisNode, addr, store, resolver.NewLocalResolver(), options...)
+}
+
+// CreateRootedDagWithResolver creates a Dag as CreateRootedDag does, with res
+// as resolver.
+func CreateRootedDagWithResolver(genesisNode *dag.Node, addr *address.Address, store datastore.DataStore,
+	res resolver.Resolver, options ...dag.DagOption) (*dag.Dag, string) {
+	ExpectWithOffset(1, res.Manage(addr)).To(BeNil())
+	da := dag.NewDag("test-ledger", store, res, options...)
+	key, err := da.SetRoot(context.Background(), genesisNode)
+	ExpectWithOffset(1, err).To(BeNil())
+	return da, key
+}
+
+func CreateNodeWithBranches(addr *address.Address, keyRoot, prev string, branches []string, branch string, seq int64) *dag.Node {
 	node := &dag.Node{}
 
 	if prev != "" {
@@ -385,3 +752,41 @@ func BuildNode(node *dag.Node, addr *address.Address) *dag.Node {
 
 	return node
 }
+
+// racingResolver runs beforeSwap right before a compare-and-swap, simulating
+// another writer that gets in between verification and the head update.
+type racingResolver struct {
+	resolver.Resolver
+	beforeSwap func()
+}
+
+func (r *racingResolver) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	if r.beforeSwap != nil {
+		r.beforeSwap()
+	}
+	return r.Resolver.CompareAndSwap(ctx, name, expected, value)
+}
+
+// remoteResolver resolves the names of the addresses it doesn't manage as the
+// IPFS resolver does: names the owner has are answered, and queries for other
+// names go unanswered until they time out.
+type remoteResolver struct {
+	resolver.Resolver
+	owner      resolver.Resolver
+	unanswered int
+}
+
+func (r *remoteResolver) Resolve(ctx context.Context, name string) (string, error) {
+	if r.IsManaged(strings.Split(name, "/")[1]) {
+		return r.Resolver.Resolve(ctx, name)
+	}
+	value, err := r.owner.Resolve(ctx, name)
+	if err == nil {
+		return value, nil
+	}
+	r.unanswered++
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	return "", ctx.Err()
+}
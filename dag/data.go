@@ -0,0 +1,248 @@
+package dag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+const (
+	// DefaultMaxInlineDataSize is the largest payload kept inline in a node.
+	DefaultMaxInlineDataSize = 256 * 1024
+	// DefaultDataChunkSize is the size of the blobs larger payloads are split
+	// into.
+	DefaultDataChunkSize = 256 * 1024
+	// DefaultMaxNodeSize is the largest encoded node read from the data store.
+	// It leaves room for inline payloads, of v1 nodes in particular; see
+	// WithMaxNodeSize to raise it, or to read nodes of any size.
+	DefaultMaxNodeSize = 4 * 1024 * 1024
+)
+
+// PrepareData moves the payload of a v2 node to separate chunk blobs when it
+// is larger than the configured inline limit (see WithMaxInlineDataSize). The
+// node then carries the SHA-256 hash and size of the payload, which are
+// signed, and the keys of the chunks, which are not: they only locate the
+// content, which is checked against the hash when read. v1 nodes can't
+// reference chunks, so their payload is left inline. It must be called before
+// the node is signed.
+func (da *Dag) PrepareData(ctx context.Context, node *Node) error {
+	if node.GetVersion() < NodeVersion2 || da.maxInlineDataSize <= 0 || len(node.Data) <= da.maxInlineDataSize {
+		return nil
+	}
+	chunks := []string{}
+	for offset := 0; offset < len(node.Data); offset += da.dataChunkSize {
+		end := min(offset+da.dataChunkSize, len(node.Data))
+		key, _, er := da.dt.Put(ctx, node.Data[offset:end], da.chunkPathFunc(node.Address))
+		if er != nil {
+			return da.translateError(er)
+		}
+		chunks = append(chunks, key)
+	}
+	hash := sha256.Sum256(node.Data)
+	node.DataHash = hex.EncodeToString(hash[:])
+	node.DataSize = int64(len(node.Data))
+	node.DataChunks = chunks
+	node.Data = nil
+	return nil
+}
+
+// PrepareDataFrom sets the payload of a node to the content read from r,
+// which is kept inline or split in chunks as PrepareData does. Chunks are
+// stored as they are read, streamed to data stores supporting it (see
+// datastore.StreamPutter), so a large payload is never held in memory. It
+// must be called before the node is signed.
+func (da *Dag) PrepareDataFrom(ctx context.Context, node *Node, r io.Reader) error {
+	if node.GetVersion() < NodeVersion2 || da.maxInlineDataSize <= 0 {
+		data, er := io.ReadAll(r)
+		if er != nil {
+			return er
+		}
+		node.Data = data
+		return nil
+	}
+	head, er := io.ReadAll(io.LimitReader(r, int64(da.maxInlineDataSize)+1))
+	if er != nil {
+		return er
+	}
+	if len(head) <= da.maxInlineDataSize {
+		node.Data = head
+		return nil
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	br := bufio.NewReader(io.TeeReader(io.MultiReader(bytes.NewReader(head), r), io.MultiWriter(hash, counter)))
+	chunks := []string{}
+	for {
+		if _, er := br.Peek(1); er == io.EOF {
+			break
+		} else if er != nil {
+			return er
+		}
+		key, er := da.putChunk(ctx, node.Address, io.LimitReader(br, int64(da.dataChunkSize)))
+		if er != nil {
+			return da.translateError(er)
+		}
+		chunks = append(chunks, key)
+	}
+	node.DataHash = hex.EncodeToString(hash.Sum(nil))
+	node.DataSize = counter.n
+	node.DataChunks = chunks
+	node.Data = nil
+	return nil
+}
+
+func (da *Dag) putChunk(ctx context.Context, addr string, r io.Reader) (string, error) {
+	if sp, ok := da.dt.(datastore.StreamPutter); ok {
+		key, _, er := sp.PutReader(ctx, r, da.chunkPathFunc(addr))
+		return key, er
+	}
+	data, er := io.ReadAll(r)
+	if er != nil {
+		return "", er
+	}
+	key, _, er := da.dt.Put(ctx, data, da.chunkPathFunc(addr))
+	return key, er
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// OpenData returns a reader over the payload of a node. Inline payloads are
+// read from the node itself; chunked ones are fetched lazily, one chunk at a
+// time, and the reader fails with ErrDataHashMismatch at the end if the
+// content does not match the signed hash and size.
+func (da *Dag) OpenData(ctx context.Context, node *Node) (io.ReadCloser, error) {
+	if !node.HasExternalData() {
+		return io.NopCloser(bytes.NewReader(node.Data)), nil
+	}
+	expected, er := hex.DecodeString(node.DataHash)
+	if er != nil {
+		return nil, ErrInvalidNodeData
+	}
+	return &chunkReader{
+		ctx:      ctx,
+		da:       da,
+		chunks:   node.DataChunks,
+		size:     node.DataSize,
+		expected: expected,
+		hash:     sha256.New(),
+	}, nil
+}
+
+// InlineData returns the payload of a node when it is no larger than the
+// inline limit (see WithMaxInlineDataSize), reading its chunks if it has
+// some, e.g. when a peer with a lower limit wrote it, so small payloads can
+// be returned along with their node. Larger payloads are left to OpenData,
+// and nil is returned for them.
+func (da *Dag) InlineData(ctx context.Context, node *Node) ([]byte, error) {
+	if !node.HasExternalData() {
+		return node.Data, nil
+	}
+	if da.maxInlineDataSize > 0 && node.DataSize > int64(da.maxInlineDataSize) {
+		return nil, nil
+	}
+	r, er := da.OpenData(ctx, node)
+	if er != nil {
+		return nil, er
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// verifyData checks the payload fields of a node: a node either carries its
+// payload inline or, from v2 on, references it by hash, size and chunks.
+func (da *Dag) verifyData(node *Node) error {
+	if !node.HasExternalData() {
+		if node.DataSize != 0 || len(node.DataChunks) > 0 {
+			return ErrInvalidNodeData
+		}
+		return nil
+	}
+	if node.GetVersion() < NodeVersion2 || len(node.Data) > 0 || node.DataSize <= 0 || len(node.DataChunks) == 0 {
+		return ErrInvalidNodeData
+	}
+	if b, er := hex.DecodeString(node.DataHash); er != nil || len(b) != sha256.Size {
+		return ErrInvalidNodeData
+	}
+	return nil
+}
+
+// chunkReader reads the chunks of a payload in order, hashing them as they
+// are read.
+type chunkReader struct {
+	ctx      context.Context
+	da       *Dag
+	chunks   []string
+	current  io.Reader
+	read     int64
+	size     int64
+	expected []byte
+	hash     hash.Hash
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, r.finish()
+			}
+			f, er := r.da.dt.Get(r.ctx, r.chunks[0])
+			if er != nil {
+				return 0, r.da.translateError(er)
+			}
+			r.chunks = r.chunks[1:]
+			r.current = f
+		}
+		n, er := r.current.Read(p)
+		if n > 0 {
+			r.hash.Write(p[:n])
+			r.read += int64(n)
+			if r.read > r.size {
+				return 0, ErrDataHashMismatch
+			}
+			return n, nil
+		}
+		if er == io.EOF {
+			r.closeCurrent()
+			continue
+		}
+		if er != nil {
+			return 0, er
+		}
+	}
+}
+
+// closeCurrent closes the reader of the current chunk, when the data store
+// returned one that can be closed, e.g. to release a file or a fetch.
+func (r *chunkReader) closeCurrent() {
+	if c, ok := r.current.(io.Closer); ok {
+		_ = c.Close()
+	}
+	r.current = nil
+}
+
+func (r *chunkReader) finish() error {
+	if r.read != r.size || !bytes.Equal(r.hash.Sum(nil), r.expected) {
+		return ErrDataHashMismatch
+	}
+	return io.EOF
+}
+
+func (r *chunkReader) Close() error {
+	r.chunks = nil
+	r.closeCurrent()
+	return nil
+}
@@ -0,0 +1,161 @@
+package dag_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/internal/util"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Chunked data", func() {
+	var da *dag.Dag
+	var ctx context.Context
+	var genesisAddr *address.Address
+	var genesisKey string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var genesisNode *dag.Node
+		genesisNode, genesisAddr = CreateGenesisNode()
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore(),
+			dag.WithMaxInlineDataSize(1024), dag.WithDataChunkSize(300))
+	})
+
+	It("Should store large payloads in chunks and read them lazily", func() {
+		payload := []byte(util.RandString(5000))
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = payload
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		Expect(node.Data).To(BeEmpty())
+		Expect(node.DataSize).To(Equal(int64(5000)))
+		Expect(node.DataChunks).To(HaveLen(17))
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+
+		key, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+
+		stored, err := da.Get(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(stored.Data).To(BeEmpty())
+
+		r, err := da.OpenData(ctx, stored)
+		Expect(err).To(BeNil())
+		data, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(payload))
+		Expect(r.Close()).To(BeNil())
+	})
+
+	It("Should prepare payloads read from a reader as PrepareData does", func() {
+		payload := []byte(util.RandString(5000))
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = payload
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+
+		streamed := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		Expect(da.PrepareDataFrom(ctx, streamed, bytes.NewReader(payload))).To(BeNil())
+		Expect(streamed.Data).To(BeEmpty())
+		Expect(streamed.DataHash).To(Equal(node.DataHash))
+		Expect(streamed.DataSize).To(Equal(node.DataSize))
+		Expect(streamed.DataChunks).To(Equal(node.DataChunks))
+
+		Expect(da.PrepareDataFrom(ctx, streamed, bytes.NewReader([]byte("inline")))).To(BeNil())
+		Expect(streamed.Data).To(Equal([]byte("inline")))
+	})
+
+	It("Should NOT read nodes larger than the maximum size", func() {
+		genesisNode, genesisAddr := CreateGenesisNode()
+		store := datastore.NewLocalFileStore()
+		res := resolver.NewLocalResolver()
+		_ = res.Manage(genesisAddr)
+		genesisKey, err := dag.NewDag("test-ledger", store, res).SetRoot(ctx, genesisNode)
+		Expect(err).To(BeNil())
+
+		_, err = dag.NewDag("test-ledger", store, res, dag.WithMaxNodeSize(100)).Get(ctx, genesisKey)
+		Expect(err).To(Equal(dag.ErrNodeTooLarge))
+		_, err = dag.NewDag("test-ledger", store, res, dag.WithMaxNodeSize(0)).Get(ctx, genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should read nodes up to the default maximum size", func() {
+		node := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = bytes.Repeat([]byte("a"), 2*1024*1024)
+		Expect(node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())).To(BeNil())
+		key, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+
+		read, err := da.Get(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(read.Data).To(Equal(node.Data))
+
+		large := CreateNode(genesisAddr, genesisKey, key, defaultBranch, 3)
+		large.Data = bytes.Repeat([]byte("a"), dag.DefaultMaxNodeSize)
+		Expect(large.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())).To(BeNil())
+		largeKey, err := da.Append(ctx, large, genesisKey)
+		Expect(err).To(BeNil())
+		_, err = da.Get(ctx, largeKey)
+		Expect(err).To(Equal(dag.ErrNodeTooLarge))
+	})
+
+	It("Should keep small payloads inline", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte("small")
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		Expect(node.Data).To(Equal([]byte("small")))
+		Expect(node.HasExternalData()).To(BeFalse())
+
+		data, err := da.InlineData(ctx, node)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal([]byte("small")))
+
+		large := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		large.Data = []byte(util.RandString(2000))
+		Expect(da.PrepareData(ctx, large)).To(BeNil())
+		data, err = da.InlineData(ctx, large)
+		Expect(err).To(BeNil())
+		Expect(data).To(BeNil())
+	})
+
+	It("Should keep the payload of v1 nodes inline", func() {
+		node := CreateNode(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		Expect(node.Data).To(HaveLen(256))
+		Expect(node.DataHash).To(BeEmpty())
+
+		r, err := da.OpenData(ctx, node)
+		Expect(err).To(BeNil())
+		data, _ := io.ReadAll(r)
+		Expect(data).To(Equal(node.Data))
+	})
+
+	It("Should fail reading chunks not matching the hash", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(2000))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+
+		node.DataChunks[0], node.DataChunks[1] = node.DataChunks[1], node.DataChunks[0]
+		r, err := da.OpenData(ctx, node)
+		Expect(err).To(BeNil())
+		_, err = io.Copy(io.Discard, r)
+		Expect(err).To(Equal(dag.ErrDataHashMismatch))
+	})
+
+	It("Should NOT register node with both inline and chunked data", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = bytes.Repeat([]byte("a"), 2000)
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		node.Data = []byte("inline")
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+
+		_, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidNodeData))
+	})
+})
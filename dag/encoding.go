@@ -0,0 +1,91 @@
+package dag
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Field tags used by the NodeVersion2 signing encoding. Tags are written in
+// ascending order and must never be renumbered, otherwise existing signatures
+// would no longer verify. New fields get new tags.
+const (
+	fieldVersion = iota + 1
+	fieldSeq
+	fieldTimestamp
+	fieldAddress
+	fieldPrevious
+	fieldBranch
+	fieldBranchRoot
+	fieldProperties
+	fieldBranches
+	fieldData
+	fieldPubKey
+	// Optional fields below are only written when set, so adding them does
+	// not change the signed bytes of nodes that do not use them.
+	fieldParents
+	fieldType
+	fieldSkips
+	fieldMerkleRoot
+	fieldDataHash
+	fieldDataSize
+	fieldRedacts
+	fieldClock
+)
+
+// signingEncoder builds an unambiguous byte representation of a node. Every
+// field is written as tag, length and value, all lengths being uvarint encoded,
+// so distinct field values can never produce the same output.
+type signingEncoder struct {
+	buf []byte
+}
+
+func newSigningEncoder() *signingEncoder {
+	return &signingEncoder{}
+}
+
+func (e *signingEncoder) bytes() []byte {
+	return e.buf
+}
+
+func (e *signingEncoder) writeBytes(tag uint64, value []byte) {
+	e.buf = binary.AppendUvarint(e.buf, tag)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *signingEncoder) writeString(tag uint64, value string) {
+	e.writeBytes(tag, []byte(value))
+}
+
+func (e *signingEncoder) writeUint(tag uint64, value uint64) {
+	e.writeBytes(tag, binary.AppendUvarint(nil, value))
+}
+
+func (e *signingEncoder) writeStrings(tag uint64, values []string) {
+	var value []byte
+	value = binary.AppendUvarint(value, uint64(len(values)))
+	for _, v := range values {
+		value = appendLengthPrefixed(value, []byte(v))
+	}
+	e.writeBytes(tag, value)
+}
+
+func (e *signingEncoder) writeMap(tag uint64, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var value []byte
+	value = binary.AppendUvarint(value, uint64(len(keys)))
+	for _, k := range keys {
+		value = appendLengthPrefixed(value, []byte(k))
+		value = appendLengthPrefixed(value, []byte(values[k]))
+	}
+	e.writeBytes(tag, value)
+}
+
+func appendLengthPrefixed(buf []byte, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
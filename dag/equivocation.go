@@ -0,0 +1,164 @@
+package dag
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/cache"
+	"github.com/msaldanha/setinstone/event"
+)
+
+// EquivocationEvent is the event name used to broadcast equivocation proofs
+// through an event.Manager.
+const EquivocationEvent = "DAG.EQUIVOCATION"
+
+// observedNodesTTL bounds how long a node is remembered for equivocation
+// detection.
+const observedNodesTTL = time.Hour
+
+// observedNodesSize bounds the number of branch positions remembered for
+// equivocation detection.
+const observedNodesSize = 100_000
+
+// EquivocationHandler is called with every equivocation proof found by a Dag.
+type EquivocationHandler func(proof EquivocationProof)
+
+// EquivocationProof holds two different nodes signed by the same address for
+// the same position (BranchRoot, Branch and Seq) of a branch. It is self
+// contained and anyone can verify it offline with Verify.
+type EquivocationProof struct {
+	First  *Node `json:"first,omitempty"`
+	Second *Node `json:"second,omitempty"`
+}
+
+// Verify checks that both nodes are validly signed by the same address, claim
+// the same branch position and differ in their signed content.
+func (p EquivocationProof) Verify() error {
+	if p.First == nil || p.Second == nil {
+		return ErrInvalidEquivocationProof
+	}
+	for _, n := range []*Node{p.First, p.Second} {
+		if ok, _ := address.IsValid(n.Address); !ok {
+			return ErrInvalidEquivocationProof
+		}
+		if !address.MatchesPubKey(n.Address, n.PubKey) {
+			return ErrInvalidEquivocationProof
+		}
+		if er := n.VerifySignature(); er != nil {
+			return ErrInvalidEquivocationProof
+		}
+	}
+	if equivocationCoordinates(p.First) != equivocationCoordinates(p.Second) {
+		return ErrInvalidEquivocationProof
+	}
+	// v1 signatures do not cover BranchRoot, so v1 nodes only conflict when
+	// they also extend the same previous node.
+	if (p.First.GetVersion() < NodeVersion2 || p.Second.GetVersion() < NodeVersion2) &&
+		p.First.Previous != p.Second.Previous {
+		return ErrInvalidEquivocationProof
+	}
+	first, _ := p.First.GetBytesForSigning()
+	second, _ := p.Second.GetBytesForSigning()
+	if bytes.Equal(first, second) {
+		return ErrInvalidEquivocationProof
+	}
+	return nil
+}
+
+// Bytes returns the JSON encoding of the proof, allowing it to be used as a
+// message payload.
+func (p EquivocationProof) Bytes() []byte {
+	b, _ := p.ToJson()
+	return b
+}
+
+func (p EquivocationProof) ToJson() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *EquivocationProof) FromJson(js []byte) error {
+	return json.Unmarshal(js, p)
+}
+
+// BroadcastEquivocations returns an EquivocationHandler that publishes every
+// proof as an EquivocationEvent through evm.
+func BroadcastEquivocations(evm event.Manager, logger *zap.Logger) EquivocationHandler {
+	logger = logger.Named("Equivocation")
+	return func(proof EquivocationProof) {
+		data, er := proof.ToJson()
+		if er != nil {
+			logger.Error("Failed to serialize equivocation proof", zap.Error(er))
+			return
+		}
+		er = evm.Emit(EquivocationEvent, data)
+		if er != nil {
+			logger.Error("Failed to broadcast equivocation proof", zap.Error(er))
+		}
+	}
+}
+
+// OnEquivocation subscribes to EquivocationEvent on evm and calls handler with
+// every received proof that verifies. Invalid proofs are ignored.
+func OnEquivocation(evm event.Manager, handler EquivocationHandler) *event.Subscription {
+	return evm.On(EquivocationEvent, func(ev event.Event) {
+		proof := EquivocationProof{}
+		if er := proof.FromJson(ev.Data()); er != nil {
+			return
+		}
+		if er := proof.Verify(); er != nil {
+			return
+		}
+		handler(proof)
+	})
+}
+
+// equivocationDetector remembers the key of the signed node seen for each
+// branch position, so a different one showing up for the same position can be
+// reported. Only keys are kept: the node seen first is read back from the data
+// store when a proof has to be built.
+type equivocationDetector struct {
+	observed cache.Cache[string]
+}
+
+func newEquivocationDetector() *equivocationDetector {
+	return &equivocationDetector{
+		observed: cache.NewLRUCache[string](observedNodesSize, observedNodesTTL),
+	}
+}
+
+// observe records that node is stored under key, unless another node was seen
+// for its position, whose key is then returned.
+func (e *equivocationDetector) observe(node *Node, key string) string {
+	coordinates := equivocationCoordinates(node)
+	seen, found, _ := e.observed.Get(coordinates)
+	if found && seen != key {
+		return seen
+	}
+	if !found {
+		_ = e.observed.Add(coordinates, key)
+	}
+	return ""
+}
+
+// seen reports whether node, stored under key, is the one seen for its
+// position.
+func (e *equivocationDetector) seen(node *Node, key string) bool {
+	seen, found, _ := e.observed.Get(equivocationCoordinates(node))
+	return found && seen == key
+}
+
+// replace records that node, stored under key, is the one seen for its
+// position.
+func (e *equivocationDetector) replace(node *Node, key string) {
+	_ = e.observed.Add(equivocationCoordinates(node), key)
+}
+
+func equivocationCoordinates(n *Node) string {
+	return strings.Join([]string{n.Address, n.BranchRoot, n.Branch, strconv.Itoa(int(n.Seq))}, "/")
+}
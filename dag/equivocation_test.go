@@ -0,0 +1,158 @@
+package dag_test
+
+import (
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/event"
+)
+
+var _ = Describe("Equivocation", func() {
+	var da *dag.Dag
+	var ctx context.Context
+	var store datastore.DataStore
+	var genesisNode *dag.Node
+	var genesisAddr *address.Address
+	var genesisKey string
+	var proofs []dag.EquivocationProof
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		proofs = nil
+		genesisNode, genesisAddr = CreateGenesisNode()
+		store = datastore.NewLocalFileStore()
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, store,
+			dag.WithEquivocationHandler(func(proof dag.EquivocationProof) {
+				proofs = append(proofs, proof)
+			}))
+	})
+
+	It("Should detect two signed nodes for the same position", func() {
+		first := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		_, err := da.Append(ctx, first, genesisKey)
+		Expect(err).To(BeNil())
+
+		// Another replica of the graph accepts a conflicting node.
+		replica, _ := CreateRootedDag(genesisNode, genesisAddr, store)
+		second := conflicting(genesisAddr, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2))
+		secondKey, err := replica.Append(ctx, second, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(proofs).To(BeEmpty())
+
+		_, err = da.Get(ctx, secondKey)
+		Expect(err).To(BeNil())
+
+		Expect(proofs).To(HaveLen(1))
+		Expect(proofs[0].First).To(Equal(first))
+		Expect(proofs[0].Second).To(Equal(second))
+		Expect(proofs[0].Verify()).To(BeNil())
+	})
+
+	It("Should detect conflicting nodes received from peers", func() {
+		first := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		_, err := da.Append(ctx, first, genesisKey)
+		Expect(err).To(BeNil())
+
+		peerStore := datastore.NewLocalFileStore()
+		peer, _ := CreateRootedDag(genesisNode, genesisAddr, peerStore)
+		second := conflicting(genesisAddr, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2))
+		secondKey, err := peer.Append(ctx, second, genesisKey)
+		Expect(err).To(BeNil())
+		f, err := peerStore.Get(ctx, secondKey)
+		Expect(err).To(BeNil())
+		data, err := io.ReadAll(f)
+		Expect(err).To(BeNil())
+
+		Expect(da.PutNodeBytes(ctx, secondKey, data)).To(BeNil())
+		Expect(proofs).To(HaveLen(1))
+		Expect(proofs[0].Second).To(Equal(second))
+	})
+
+	It("Should NOT report nodes that were not appended", func() {
+		rejected := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		rejected.Previous = "unknown"
+		_ = rejected.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err := da.Append(ctx, rejected, genesisKey)
+		Expect(err).NotTo(BeNil())
+
+		retry := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		_, err = da.Append(ctx, retry, genesisKey)
+		Expect(err).To(BeNil())
+
+		conflicting := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		_, err = da.Append(ctx, conflicting, genesisKey)
+		Expect(err).To(Equal(dag.ErrPreviousNodeIsNotHead))
+
+		Expect(proofs).To(BeEmpty())
+	})
+
+	It("Should NOT report the same node seen twice", func() {
+		n := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		key, err := da.Append(ctx, n, genesisKey)
+		Expect(err).To(BeNil())
+		_, err = da.Get(ctx, key)
+		Expect(err).To(BeNil())
+		_, _, err = da.GetLast(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+
+		Expect(proofs).To(BeEmpty())
+	})
+
+	It("Should verify proofs offline", func() {
+		first := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		second := conflicting(genesisAddr, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2))
+		proof := dag.EquivocationProof{First: first, Second: second}
+		Expect(proof.Verify()).To(BeNil())
+
+		js, err := proof.ToJson()
+		Expect(err).To(BeNil())
+		decoded := dag.EquivocationProof{}
+		Expect(decoded.FromJson(js)).To(BeNil())
+		Expect(decoded.Verify()).To(BeNil())
+
+		Expect(dag.EquivocationProof{First: first, Second: first}.Verify()).To(Equal(dag.ErrInvalidEquivocationProof))
+
+		other := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 3)
+		Expect(dag.EquivocationProof{First: first, Second: other}.Verify()).To(Equal(dag.ErrInvalidEquivocationProof))
+
+		tampered := *second
+		tampered.Data = []byte("tampered")
+		Expect(dag.EquivocationProof{First: first, Second: &tampered}.Verify()).To(Equal(dag.ErrInvalidEquivocationProof))
+
+		otherAddr, _ := address.NewAddressWithKeys()
+		foreign := CreateNodeV2(otherAddr, genesisKey, genesisKey, defaultBranch, 2)
+		Expect(dag.EquivocationProof{First: first, Second: foreign}.Verify()).To(Equal(dag.ErrInvalidEquivocationProof))
+	})
+
+	It("Should broadcast proofs through the event manager", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		proof := dag.EquivocationProof{
+			First:  CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2),
+			Second: CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2),
+		}
+		data, _ := proof.ToJson()
+
+		evm := event.NewMockManager(mockCtrl)
+		evm.EXPECT().Emit(dag.EquivocationEvent, data).Return(nil)
+
+		dag.BroadcastEquivocations(evm, zap.NewNop())(proof)
+	})
+})
+
+// conflicting changes node, signed again, so it conflicts with a node created
+// the same way.
+func conflicting(addr *address.Address, node *dag.Node) *dag.Node {
+	node.Properties = map[string]string{"conflicting": "true"}
+	_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+	return node
+}
@@ -20,4 +20,41 @@ var (
 	ErrUnableToDecodeNodePubKey    = errors.New("unable to decode node pubkey")
 	ErrUnableToDecodeNodeHash      = errors.New("unable to decode node hash")
 	ErrNodeSignatureDoesNotMatch   = errors.New("node signature does not match")
+	ErrUnsupportedNodeVersion      = errors.New("unsupported node version")
+	ErrInvalidNodeEncoding         = errors.New("invalid node encoding")
+	ErrInvalidBranchRoot           = errors.New("invalid branch root")
+	ErrNodeAddressMismatch         = errors.New("node address does not match chain address")
+	ErrNodeTimestampOutOfOrder     = errors.New("node timestamp is earlier than previous node")
+	ErrInvalidEquivocationProof    = errors.New("invalid equivocation proof")
+	ErrInvalidMergeNode            = errors.New("invalid merge node")
+	ErrMergeParentNotFound         = errors.New("merge parent node not found")
+	ErrInvalidNodeType             = errors.New("invalid node type")
+	ErrBranchAlreadyExists         = errors.New("branch already exists")
+	ErrBranchClosed                = errors.New("branch is closed")
+	ErrInvalidSkips                = errors.New("invalid skip pointers")
+	ErrInvalidCheckpoint           = errors.New("invalid checkpoint")
+	ErrNodeNotInCheckpoint         = errors.New("node not covered by checkpoint")
+	ErrInvalidInclusionProof       = errors.New("invalid inclusion proof")
+	ErrInvalidNodeData             = errors.New("invalid node data")
+	ErrDataHashMismatch            = errors.New("data does not match its hash")
+	ErrInvalidTombstone            = errors.New("invalid tombstone")
+	ErrNodeAlreadyRedacted         = errors.New("node already redacted")
+	ErrDataRedacted                = errors.New("data was redacted")
+	ErrDataTooLarge                = errors.New("data too large")
+	ErrPropertyNotAllowed          = errors.New("property not allowed")
+	ErrClockSkew                   = errors.New("node timestamp too far in the future")
+	ErrRateLimited                 = errors.New("node appended too soon after previous node")
+	ErrInvalidTimestampToken       = errors.New("invalid timestamp token")
+	ErrNodeAlreadyCountersigned    = errors.New("node already countersigned")
+	ErrInvalidArchive              = errors.New("invalid archive")
+	ErrArchiveKeyMismatch          = errors.New("archive content does not match its key")
+	ErrInvalidClock                = errors.New("invalid node clock")
+	ErrNodeKeyMismatch             = errors.New("node stored under an unexpected key")
+	ErrNodeTooLarge                = errors.New("node exceeds the maximum size")
+	// ErrConcurrentAppend is returned when the branch head moved while a node
+	// was being appended. It is retryable: rebuild the node on the new head.
+	ErrConcurrentAppend = errors.New("concurrent append: branch head moved")
+	// ErrStopWalk can be returned by the function called by Walk to end the
+	// walk early. Walk then returns nil.
+	ErrStopWalk = errors.New("stop walk")
 )
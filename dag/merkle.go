@@ -0,0 +1,99 @@
+package dag
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Merkle trees committed to by checkpoint nodes follow RFC 6962: leaves and
+// inner nodes are hashed with distinct prefixes, so a leaf can never be passed
+// off as an inner node, and unbalanced trees split at the largest power of two
+// smaller than the number of leaves.
+
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+func merkleLeafHash(key string) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write([]byte(key))
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleRoot returns the root hash of the tree whose leaves are the hashes of
+// keys, in order.
+func merkleRoot(keys []string) []byte {
+	switch len(keys) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return merkleLeafHash(keys[0])
+	}
+	k := merkleSplit(len(keys))
+	return merkleNodeHash(merkleRoot(keys[:k]), merkleRoot(keys[k:]))
+}
+
+// merklePath returns the audit path of the leaf at index, from the leaf up to
+// the root.
+func merklePath(index int, keys []string) [][]byte {
+	if len(keys) <= 1 {
+		return nil
+	}
+	k := merkleSplit(len(keys))
+	if index < k {
+		return append(merklePath(index, keys[:k]), merkleRoot(keys[k:]))
+	}
+	return append(merklePath(index-k, keys[k:]), merkleRoot(keys[:k]))
+}
+
+// merkleRootFromPath recomputes the root of a tree of size leaves from the
+// leaf at index and its audit path, as described in RFC 9162, section 2.1.3.2.
+func merkleRootFromPath(index, size int64, leaf []byte, path [][]byte) ([]byte, bool) {
+	if index < 0 || index >= size {
+		return nil, false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return nil, false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return r, sn == 0
+}
+
+func verifyMerklePath(index, size int64, leaf []byte, path [][]byte, root []byte) bool {
+	r, ok := merkleRootFromPath(index, size, leaf, path)
+	return ok && bytes.Equal(r, root)
+}
+
+// merkleSplit returns the largest power of two smaller than n, n > 1.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
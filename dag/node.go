@@ -5,13 +5,44 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"slices"
 	"strconv"
 
 	"github.com/msaldanha/setinstone/crypto"
 )
 
+const (
+	// NodeVersion1 is the original node format. Its signed bytes are a plain
+	// concatenation of some of the node fields. Nodes without an explicit
+	// Version are treated as NodeVersion1.
+	NodeVersion1 int32 = 1
+	// NodeVersion2 signs a length-prefixed encoding of every semantic field of
+	// the node, including BranchRoot and PubKey.
+	NodeVersion2 int32 = 2
+	// CurrentNodeVersion is the version assigned to nodes created by NewNode.
+	CurrentNodeVersion = NodeVersion2
+)
+
+const (
+	// NodeTypeBranchOpen marks a node that opens a new branch starting at the
+	// node referenced by its BranchRoot (and Previous).
+	NodeTypeBranchOpen = "branch-open"
+	// NodeTypeBranchClose marks the final node of a branch. Nothing can be
+	// appended to a branch after it.
+	NodeTypeBranchClose = "branch-close"
+	// NodeTypeCheckpoint marks a node committing, through MerkleRoot, to every
+	// node of its branch before it.
+	NodeTypeCheckpoint = "checkpoint"
+	// NodeTypeTombstone marks a node redacting the payload of the earlier node
+	// referenced by its Redacts field.
+	NodeTypeTombstone = "tombstone"
+)
+
 type Node struct {
-	Seq        int32             `json:"seq,omitempty"`
+	Version    int32             `json:"version,omitempty"`
+	Type       string            `json:"type,omitempty"`
+	Seq        int64             `json:"seq,omitempty"`
+	Clock      uint64            `json:"clock,omitempty"`
 	Timestamp  string            `json:"timestamp,omitempty"`
 	Address    string            `json:"address,omitempty"`
 	Previous   string            `json:"previous,omitempty"`
@@ -19,16 +50,92 @@ type Node struct {
 	BranchRoot string            `json:"branchRoot,omitempty"`
 	Properties map[string]string `json:"properties,omitempty"`
 	Branches   []string          `json:"branches,omitempty"`
+	Parents    []string          `json:"parents,omitempty"`
+	Skips      []string          `json:"skips,omitempty"`
+	MerkleRoot string            `json:"merkleRoot,omitempty"`
+	Redacts    string            `json:"redacts,omitempty"`
 	Data       []byte            `json:"data,omitempty"`
+	DataHash   string            `json:"dataHash,omitempty"`
+	DataSize   int64             `json:"dataSize,omitempty"`
+	DataChunks []string          `json:"dataChunks,omitempty"`
 	PubKey     string            `json:"pubKey,omitempty"`
 	Signature  string            `json:"signature,omitempty"`
 }
 
+// IsMerge reports whether the node joins other heads besides Previous.
+func (m *Node) IsMerge() bool {
+	return len(m.Parents) > 0
+}
+
 func NewNode() *Node {
-	return &Node{}
+	return &Node{Version: CurrentNodeVersion}
+}
+
+// IsBranchOpen reports whether the node opens a branch.
+func (m *Node) IsBranchOpen() bool {
+	return m.Type == NodeTypeBranchOpen
+}
+
+// IsBranchClose reports whether the node closes its branch.
+func (m *Node) IsBranchClose() bool {
+	return m.Type == NodeTypeBranchClose
+}
+
+// IsCheckpoint reports whether the node is a checkpoint.
+func (m *Node) IsCheckpoint() bool {
+	return m.Type == NodeTypeCheckpoint
+}
+
+// IsTombstone reports whether the node redacts another node.
+func (m *Node) IsTombstone() bool {
+	return m.Type == NodeTypeTombstone
+}
+
+// HasExternalData reports whether the payload of the node is stored in
+// separate chunks instead of Data.
+func (m *Node) HasExternalData() bool {
+	return m.DataHash != ""
+}
+
+// Clone returns a deep copy of the node.
+func (m *Node) Clone() *Node {
+	c := *m
+	if m.Properties != nil {
+		c.Properties = make(map[string]string, len(m.Properties))
+		for k, v := range m.Properties {
+			c.Properties[k] = v
+		}
+	}
+	c.Branches = slices.Clone(m.Branches)
+	c.Parents = slices.Clone(m.Parents)
+	c.Skips = slices.Clone(m.Skips)
+	c.Data = slices.Clone(m.Data)
+	c.DataChunks = slices.Clone(m.DataChunks)
+	return &c
+}
+
+// GetVersion returns the format version of the node. Nodes created before
+// versioning was introduced have no Version and are reported as NodeVersion1.
+func (m *Node) GetVersion() int32 {
+	if m.Version == 0 {
+		return NodeVersion1
+	}
+	return m.Version
 }
 
+// GetBytesForSigning returns the canonical bytes covered by the node
+// signature. The encoding depends on the node version.
 func (m *Node) GetBytesForSigning() ([]byte, error) {
+	switch m.GetVersion() {
+	case NodeVersion1:
+		return m.getBytesForSigningV1(), nil
+	case NodeVersion2:
+		return m.getBytesForSigningV2(), nil
+	}
+	return nil, ErrUnsupportedNodeVersion
+}
+
+func (m *Node) getBytesForSigningV1() []byte {
 	var result []byte
 	result = append(result, []byte(strconv.Itoa(int(m.Seq)))...)
 	result = append(result, []byte(m.Timestamp)...)
@@ -38,11 +145,54 @@ func (m *Node) GetBytesForSigning() ([]byte, error) {
 	result = append(result, getMapBytes(m.Properties)...)
 	result = append(result, getSliceBytes(m.Branches)...)
 	result = append(result, m.Data...)
-	return result, nil
+	return result
+}
+
+func (m *Node) getBytesForSigningV2() []byte {
+	e := newSigningEncoder()
+	e.writeUint(fieldVersion, uint64(m.Version))
+	e.writeUint(fieldSeq, uint64(m.Seq))
+	e.writeString(fieldTimestamp, m.Timestamp)
+	e.writeString(fieldAddress, m.Address)
+	e.writeString(fieldPrevious, m.Previous)
+	e.writeString(fieldBranch, m.Branch)
+	e.writeString(fieldBranchRoot, m.BranchRoot)
+	e.writeMap(fieldProperties, m.Properties)
+	e.writeStrings(fieldBranches, m.Branches)
+	e.writeBytes(fieldData, m.Data)
+	e.writeString(fieldPubKey, m.PubKey)
+	if len(m.Parents) > 0 {
+		e.writeStrings(fieldParents, m.Parents)
+	}
+	if m.Type != "" {
+		e.writeString(fieldType, m.Type)
+	}
+	if len(m.Skips) > 0 {
+		e.writeStrings(fieldSkips, m.Skips)
+	}
+	if m.MerkleRoot != "" {
+		e.writeString(fieldMerkleRoot, m.MerkleRoot)
+	}
+	// Chunk keys are not signed: they only locate the payload, which is
+	// checked against the signed hash and size when read.
+	if m.DataHash != "" {
+		e.writeString(fieldDataHash, m.DataHash)
+		e.writeUint(fieldDataSize, uint64(m.DataSize))
+	}
+	if m.Redacts != "" {
+		e.writeString(fieldRedacts, m.Redacts)
+	}
+	if m.Clock != 0 {
+		e.writeUint(fieldClock, m.Clock)
+	}
+	return e.bytes()
 }
 
 func (m *Node) Sign(privateKey *ecdsa.PrivateKey) error {
-	data, _ := m.GetBytesForSigning()
+	data, er := m.GetBytesForSigning()
+	if er != nil {
+		return er
+	}
 	hash := sha256.Sum256(data)
 	s, er := crypto.Sign(hash[:], privateKey)
 	if er != nil {
@@ -64,7 +214,10 @@ func (m *Node) VerifySignature() error {
 		return ErrUnableToDecodeNodePubKey
 	}
 
-	data, _ := m.GetBytesForSigning()
+	data, er := m.GetBytesForSigning()
+	if er != nil {
+		return er
+	}
 	hash := sha256.Sum256(data)
 	if !VerifySignature(sign, pubKey, hash[:]) {
 		return ErrNodeSignatureDoesNotMatch
@@ -0,0 +1,67 @@
+package dag_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+)
+
+var _ = Describe("Node", func() {
+	addr, _ := address.NewAddressWithKeys()
+
+	It("Should default new nodes to the current version", func() {
+		n := dag.NewNode()
+		Expect(n.Version).To(Equal(dag.CurrentNodeVersion))
+		Expect((&dag.Node{}).GetVersion()).To(Equal(dag.NodeVersion1))
+	})
+
+	It("Should produce distinct v2 signing bytes when field boundaries move", func() {
+		n1 := &dag.Node{Version: dag.NodeVersion2, Branch: "ab", BranchRoot: "c"}
+		n2 := &dag.Node{Version: dag.NodeVersion2, Branch: "a", BranchRoot: "bc"}
+		b1, err := n1.GetBytesForSigning()
+		Expect(err).To(BeNil())
+		b2, err := n2.GetBytesForSigning()
+		Expect(err).To(BeNil())
+		Expect(b1).NotTo(Equal(b2))
+
+		n1 = &dag.Node{Previous: "ab", Branch: "c"}
+		n2 = &dag.Node{Previous: "a", Branch: "bc"}
+		b1, _ = n1.GetBytesForSigning()
+		b2, _ = n2.GetBytesForSigning()
+		Expect(b1).To(Equal(b2))
+	})
+
+	It("Should cover BranchRoot and PubKey in v2 signatures", func() {
+		n := CreateNodeV2(addr, "root", "prev", defaultBranch, 2)
+		Expect(n.VerifySignature()).To(BeNil())
+
+		t := *n
+		t.BranchRoot = "other"
+		Expect(t.VerifySignature()).To(Equal(dag.ErrNodeSignatureDoesNotMatch))
+
+		other, _ := address.NewAddressWithKeys()
+		t = *n
+		t.PubKey = other.Keys.PublicKey
+		Expect(t.VerifySignature()).To(Equal(dag.ErrNodeSignatureDoesNotMatch))
+	})
+
+	It("Should cover Clock in v2 signatures", func() {
+		n := CreateNodeV2(addr, "root", "prev", defaultBranch, 2)
+		n.Clock = 5
+		Expect(n.Sign(addr.Keys.ToEcdsaPrivateKey())).To(BeNil())
+		Expect(n.VerifySignature()).To(BeNil())
+
+		t := *n
+		t.Clock = 6
+		Expect(t.VerifySignature()).To(Equal(dag.ErrNodeSignatureDoesNotMatch))
+	})
+
+	It("Should reject unsupported versions", func() {
+		n := CreateNodeV2(addr, "root", "prev", defaultBranch, 2)
+		n.Version = 99
+		Expect(n.Sign(addr.Keys.ToEcdsaPrivateKey())).To(Equal(dag.ErrUnsupportedNodeVersion))
+		Expect(n.VerifySignature()).To(Equal(dag.ErrUnsupportedNodeVersion))
+	})
+})
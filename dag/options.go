@@ -0,0 +1,100 @@
+package dag
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/cache"
+	"github.com/msaldanha/setinstone/tsa"
+)
+
+// DagOption configures optional behaviour of a Dag created with NewDag.
+type DagOption func(*Dag)
+
+// WithLogger sets the logger of the Dag, used for failures that don't fail
+// the operation reporting them, such as removing the chunks of a redacted
+// payload.
+func WithLogger(logger *zap.Logger) DagOption {
+	return func(d *Dag) {
+		d.logger = logger.Named("Dag")
+	}
+}
+
+// WithEquivocationHandler registers a handler called every time the Dag finds
+// two conflicting signed nodes for the same position of a branch.
+func WithEquivocationHandler(handler EquivocationHandler) DagOption {
+	return func(d *Dag) {
+		d.equivocationHandler = handler
+	}
+}
+
+// WithValidationRules adds rules run by VerifyNode, in the given order, on
+// every node appended or verified. See ValidationRule.
+func WithValidationRules(rules ...ValidationRule) DagOption {
+	return func(d *Dag) {
+		d.rules = append(d.rules, rules...)
+	}
+}
+
+// WithMaxFutureSkew rejects nodes dated more than skew ahead of the local
+// clock with ErrClockSkew, registering the MaxClockSkew rule. Zero, the
+// default, accepts any future timestamp.
+func WithMaxFutureSkew(skew time.Duration) DagOption {
+	return func(d *Dag) {
+		if skew > 0 {
+			d.rules = append(d.rules, MaxClockSkew(skew))
+		}
+	}
+}
+
+// WithTimestampAuthority has every appended node countersigned by authority,
+// see Countersign. If countersigning fails the node stays appended, and the
+// error is returned together with its key.
+func WithTimestampAuthority(authority tsa.Authority) DagOption {
+	return func(d *Dag) {
+		d.timestampAuthority = authority
+	}
+}
+
+// WithNodeCache keeps decoded nodes in c, sparing a data store read and a
+// decode every time a node is read again. Nodes are immutable, so entries
+// never go stale; c should be size bounded, e.g. cache.NewLRUCache. Cached
+// nodes are copied in and out, so callers can't alter them. See CacheStats.
+func WithNodeCache(c cache.Cache[*Node]) DagOption {
+	return func(d *Dag) {
+		d.nodeCache = c
+	}
+}
+
+// WithMaxInlineDataSize sets the largest payload, in bytes, kept inline in a
+// node by PrepareData, and returned along with its node by InlineData. Larger
+// payloads are stored in chunks and read through OpenData. Zero or less keeps
+// every payload inline.
+func WithMaxInlineDataSize(size int) DagOption {
+	return func(d *Dag) {
+		d.maxInlineDataSize = size
+	}
+}
+
+// WithDataChunkSize sets the size, in bytes, of the chunks payloads larger
+// than the inline limit are split into.
+func WithDataChunkSize(size int) DagOption {
+	return func(d *Dag) {
+		if size > 0 {
+			d.dataChunkSize = size
+		}
+	}
+}
+
+// WithMaxNodeSize sets the largest encoded node, in bytes, read from the data
+// store; larger ones fail with ErrNodeTooLarge. The default is
+// DefaultMaxNodeSize. v2 payloads are kept in chunks, but v1 nodes carry
+// theirs inline, so the limit must leave room for the largest v1 payload
+// stored. Zero or less reads nodes of any size, however large a store or
+// peer makes them.
+func WithMaxNodeSize(size int64) DagOption {
+	return func(d *Dag) {
+		d.maxNodeSize = size
+	}
+}
@@ -0,0 +1,221 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// chunksPrefix is the data store path the links of addresses to the chunks
+// they use are under, see getChunkPath.
+const chunksPrefix = "/.chunks"
+
+// Redact appends a tombstone node to the branch node.Branch rooted at
+// branchRootNodeKey, redacting the payload of the node referenced by
+// node.Redacts. The node must be of type NodeTypeTombstone and carry no
+// payload itself.
+//
+// Once the tombstone is stored, the redacted node is reported by GetRedaction
+// and the chunks of its payload are removed from the data store, unless other
+// nodes, of this address or another one, still use them or they are pinned;
+// failing to remove them doesn't fail the redaction. The redacted node itself
+// is kept: its signature covers the hash of a chunked payload, so it and the
+// chain going through it still verify. An inline payload, of a v1 node or a
+// payload under the inline limit (see PrepareData), is part of the stored node
+// and can't be removed without changing its key; the tombstone drops it for
+// readers, which are expected to hide the payload of redacted nodes.
+func (da *Dag) Redact(ctx context.Context, node *Node, branchRootNodeKey string) (string, error) {
+	if !node.IsTombstone() {
+		return "", ErrInvalidNodeType
+	}
+	return da.Append(ctx, node, branchRootNodeKey)
+}
+
+// GetRedaction returns the key of the tombstone redacting the node with the
+// given key, or an empty string if the node was not redacted. Redactions are
+// recorded by the resolver managing the address of the node, so the nodes of
+// other addresses, such as followed graphs, are reported as not redacted.
+func (da *Dag) GetRedaction(ctx context.Context, key string) (string, error) {
+	node, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	if node == nil {
+		return "", ErrNodeNotFound
+	}
+	tombstoneKey, er := da.resolveManagedName(ctx, node.Address, da.getRedactionName(node.Address, key))
+	if errors.Is(er, resolver.ErrNotFound) {
+		return "", nil
+	}
+	if er != nil {
+		return "", da.translateError(er)
+	}
+	return tombstoneKey, nil
+}
+
+// verifyTombstone checks the node redacted by a tombstone. It must be a node
+// of the same address and not a tombstone itself.
+func (da *Dag) verifyTombstone(ctx context.Context, node *Node, mustBeNew bool) error {
+	target, er := da.getNodeByKey(ctx, node.Redacts)
+	if errors.Is(er, ErrNodeNotFound) || (er == nil && target == nil) {
+		return ErrInvalidTombstone
+	}
+	if er != nil {
+		return da.translateError(er)
+	}
+	if target.Address != node.Address || target.IsTombstone() {
+		return ErrInvalidTombstone
+	}
+	if !mustBeNew {
+		return nil
+	}
+	tombstoneKey, er := da.GetRedaction(ctx, node.Redacts)
+	if er != nil {
+		return er
+	}
+	if tombstoneKey != "" {
+		return ErrNodeAlreadyRedacted
+	}
+	return nil
+}
+
+// applyRedaction records that the node referenced by a stored tombstone is
+// redacted.
+func (da *Dag) applyRedaction(ctx context.Context, node *Node, key string) error {
+	er := da.resolver.CompareAndSwap(ctx, da.getRedactionName(node.Address, node.Redacts), "", key)
+	if errors.Is(er, resolver.ErrValueChanged) {
+		return ErrNodeAlreadyRedacted
+	}
+	return er
+}
+
+// releaseChunks removes the chunks of the payload redacted by a stored
+// tombstone. Chunks are content addressed, so other nodes, of this or other
+// addresses, may use the same chunk: a chunk still referenced by a node of the
+// address that is not redacted is kept, and otherwise the link of the address
+// to it (see getChunkPath) is removed. The chunk itself is only removed once
+// no address links it and it isn't pinned (see datastore.Pinner). Chunks of
+// data stores unable to link content are kept. The redaction is recorded
+// already, and readers refuse the payload, so failures are only logged.
+func (da *Dag) releaseChunks(ctx context.Context, node *Node) {
+	logger := da.logger.With(zap.String("redacts", node.Redacts))
+	target, er := da.getNodeByKey(ctx, node.Redacts)
+	if er != nil || len(target.DataChunks) == 0 {
+		return
+	}
+	linker, ok := da.dt.(datastore.PathLinker)
+	if !ok {
+		return
+	}
+	shared, er := da.sharedChunks(ctx, node.Address)
+	if er != nil {
+		logger.Error("Failed to find the chunks still referenced", zap.Error(er))
+		return
+	}
+	pinned := map[string]bool{}
+	if pinner, ok := da.dt.(datastore.Pinner); ok {
+		pins, er := pinner.Pins(ctx)
+		if er != nil {
+			logger.Error("Failed to list pins", zap.Error(er))
+			return
+		}
+		for _, pin := range pins {
+			pinned[pin] = true
+		}
+	}
+	for _, chunk := range target.DataChunks {
+		if shared[chunk] {
+			continue
+		}
+		if er := da.releaseChunk(ctx, linker, node.Address, chunk, pinned[chunk]); er != nil {
+			logger.Error("Failed to release chunk", zap.String("chunk", chunk), zap.Error(er))
+		}
+	}
+}
+
+// releaseChunk removes the link of addr to chunk and, unless the chunk is
+// pinned or linked by another address, the chunk. Chunks addr never linked
+// are kept, as nothing tells whether another address uses them.
+func (da *Dag) releaseChunk(ctx context.Context, linker datastore.PathLinker, addr, chunk string, pinned bool) error {
+	p := da.getChunkPath(chunk, addr)
+	linked := false
+	referenced := false
+	for link, er := range linker.Paths(ctx, path.Join(chunksPrefix, chunk)) {
+		if er != nil {
+			return er
+		}
+		if link.Key != chunk {
+			continue
+		}
+		if link.Path == p {
+			linked = true
+		} else {
+			referenced = true
+		}
+	}
+	if !linked {
+		return nil
+	}
+	if er := linker.Unlink(ctx, p); er != nil && !errors.Is(er, datastore.ErrNotFound) {
+		return er
+	}
+	if referenced || pinned {
+		return nil
+	}
+	er := da.dt.Remove(ctx, chunk, nil)
+	if errors.Is(er, datastore.ErrNotFound) {
+		return nil
+	}
+	return er
+}
+
+// sharedChunks returns the chunks referenced by the nodes of addr that are not
+// redacted, which a redaction must keep.
+func (da *Dag) sharedChunks(ctx context.Context, addr string) (map[string]bool, error) {
+	redacted := map[string]bool{}
+	chunks := map[string][]string{}
+	er := da.WalkAddress(ctx, addr, func(key string, node *Node) error {
+		if node.IsTombstone() {
+			redacted[node.Redacts] = true
+		}
+		if len(node.DataChunks) > 0 {
+			chunks[key] = node.DataChunks
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, er
+	}
+	shared := map[string]bool{}
+	for key, keys := range chunks {
+		if redacted[key] {
+			continue
+		}
+		for _, chunk := range keys {
+			shared[chunk] = true
+		}
+	}
+	return shared, nil
+}
+
+func (da *Dag) getRedactionName(addr, nodeKey string) string {
+	return da.getName(addr, "redactions", nodeKey)
+}
+
+// getChunkPath returns the data store path addr links chunk at. Paths start
+// with the chunk, so the addresses using a chunk can be listed.
+func (da *Dag) getChunkPath(chunk, addr string) string {
+	return path.Join(chunksPrefix, chunk, addr, da.nameSpace)
+}
+
+// chunkPathFunc returns the PathFunc linking the chunks stored for addr.
+func (da *Dag) chunkPathFunc(addr string) datastore.PathFunc {
+	return func(chunk string) string {
+		return da.getChunkPath(chunk, addr)
+	}
+}
@@ -0,0 +1,214 @@
+package dag_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/internal/util"
+)
+
+var _ = Describe("Redaction", func() {
+	var da *dag.Dag
+	var store datastore.DataStore
+	var ctx context.Context
+	var genesisAddr *address.Address
+	var genesisKey string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var genesisNode *dag.Node
+		genesisNode, genesisAddr = CreateGenesisNode()
+		store = datastore.NewLocalFileStore()
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, store,
+			dag.WithMaxInlineDataSize(100), dag.WithDataChunkSize(300))
+	})
+
+	It("Should drop redacted payloads and keep the chain verifiable", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(2000))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+
+		tombstoneKey, err := da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3), genesisKey)
+		Expect(err).To(BeNil())
+
+		redaction, err := da.GetRedaction(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		Expect(redaction).To(Equal(tombstoneKey))
+		redaction, err = da.GetRedaction(ctx, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(redaction).To(BeEmpty())
+
+		stored, err := da.Get(ctx, nodeKey)
+		Expect(err).To(BeNil())
+		r, err := da.OpenData(ctx, stored)
+		Expect(err).To(BeNil())
+		_, err = io.ReadAll(r)
+		Expect(err).To(Equal(dag.ErrNodeNotFound))
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, tombstoneKey, nodeKey, 4), genesisKey)
+		Expect(err).To(Equal(dag.ErrNodeAlreadyRedacted))
+	})
+
+	It("Should redact small payloads kept inline", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte("small")
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(node.HasExternalData()).To(BeFalse())
+
+		tombstoneKey, err := da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3), genesisKey)
+		Expect(err).To(BeNil())
+		Expect(da.GetRedaction(ctx, nodeKey)).To(Equal(tombstoneKey))
+
+		report, err := da.VerifyChain(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+	})
+
+	It("Should keep chunks shared with payloads not redacted", func() {
+		payload := []byte(util.RandString(2000))
+		shared := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		shared.Data = payload
+		Expect(da.PrepareData(ctx, shared)).To(BeNil())
+		_ = shared.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		sharedKey, err := da.Append(ctx, shared, genesisKey)
+		Expect(err).To(BeNil())
+		node := CreateNodeV2(genesisAddr, genesisKey, sharedKey, defaultBranch, 3)
+		node.Data = append(bytes.Clone(payload), []byte("more")...)
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(node.DataChunks[0]).To(Equal(shared.DataChunks[0]))
+
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 4), genesisKey)
+		Expect(err).To(BeNil())
+
+		r, err := da.OpenData(ctx, shared)
+		Expect(err).To(BeNil())
+		data, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(payload))
+		r, err = da.OpenData(ctx, node)
+		Expect(err).To(BeNil())
+		_, err = io.ReadAll(r)
+		Expect(err).To(Equal(dag.ErrNodeNotFound))
+	})
+
+	It("Should keep chunks other graphs use", func() {
+		payload := []byte(util.RandString(2000))
+		otherGenesis, otherAddr := CreateGenesisNode()
+		other, otherGenesisKey := CreateRootedDag(otherGenesis, otherAddr, store,
+			dag.WithMaxInlineDataSize(100), dag.WithDataChunkSize(300))
+		otherNode := CreateNodeV2(otherAddr, otherGenesisKey, otherGenesisKey, defaultBranch, 2)
+		otherNode.Data = payload
+		Expect(other.PrepareData(ctx, otherNode)).To(BeNil())
+		_ = otherNode.Sign(otherAddr.Keys.ToEcdsaPrivateKey())
+		_, err := other.Append(ctx, otherNode, otherGenesisKey)
+		Expect(err).To(BeNil())
+
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = bytes.Clone(payload)
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(node.DataChunks).To(Equal(otherNode.DataChunks))
+
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3), genesisKey)
+		Expect(err).To(BeNil())
+
+		r, err := other.OpenData(ctx, otherNode)
+		Expect(err).To(BeNil())
+		data, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(payload))
+	})
+
+	It("Should keep pinned chunks", func() {
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(200))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(store.(datastore.Pinner).Pin(ctx, node.DataChunks[0])).To(BeNil())
+
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3), genesisKey)
+		Expect(err).To(BeNil())
+
+		Expect(store.(datastore.ExtendedDataStore).Has(ctx, node.DataChunks[0])).To(BeTrue())
+	})
+
+	It("Should redact even if chunks can't be removed", func() {
+		local := datastore.NewLocalFileStore()
+		genesisNode, addr := CreateGenesisNode()
+		da, rootKey := CreateRootedDag(genesisNode, addr, unremovableStore{local, local.(datastore.PathLinker)},
+			dag.WithMaxInlineDataSize(100))
+		node := CreateNodeV2(addr, rootKey, rootKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(200))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(addr.Keys.ToEcdsaPrivateKey())
+		nodeKey, err := da.Append(ctx, node, rootKey)
+		Expect(err).To(BeNil())
+
+		tombstoneKey, err := da.Redact(ctx, CreateTombstone(addr, rootKey, nodeKey, nodeKey, 3), rootKey)
+		Expect(err).To(BeNil())
+		Expect(da.GetRedaction(ctx, nodeKey)).To(Equal(tombstoneKey))
+	})
+
+	It("Should NOT register invalid tombstones", func() {
+		nodeKey, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, "missing", 3), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidTombstone))
+
+		withData := CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3)
+		withData.Data = []byte("data")
+		_ = withData.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Redact(ctx, withData, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidTombstone))
+
+		untyped := CreateNodeV2(genesisAddr, genesisKey, nodeKey, defaultBranch, 3)
+		untyped.Redacts = nodeKey
+		_ = untyped.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, untyped, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidTombstone))
+		_, err = da.Redact(ctx, untyped, genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidNodeType))
+
+		tombstoneKey, err := da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, nodeKey, nodeKey, 3), genesisKey)
+		Expect(err).To(BeNil())
+		_, err = da.Redact(ctx, CreateTombstone(genesisAddr, genesisKey, tombstoneKey, tombstoneKey, 4), genesisKey)
+		Expect(err).To(Equal(dag.ErrInvalidTombstone))
+	})
+})
+
+// unremovableStore fails to remove content, as a data store does for pinned
+// content.
+type unremovableStore struct {
+	datastore.DataStore
+	datastore.PathLinker
+}
+
+func (unremovableStore) Remove(ctx context.Context, key string, pathFunc datastore.PathFunc) error {
+	return errors.New("pinned")
+}
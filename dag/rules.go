@@ -0,0 +1,143 @@
+package dag
+
+import (
+	"context"
+	"time"
+)
+
+// ValidationRule is an application defined check run by VerifyNode on every
+// node appended or verified, after the built-in checks passed. Rules are
+// registered with WithValidationRules.
+type ValidationRule interface {
+	// Name identifies the rule in the RuleViolationError returned when it
+	// rejects a node.
+	Name() string
+	// Validate returns an error if the node is not acceptable. previous is the
+	// node referenced by node.Previous, already verified to exist.
+	Validate(ctx context.Context, node, previous *Node) error
+}
+
+// RuleViolationError is returned by VerifyNode when a ValidationRule rejects a
+// node. It wraps the error returned by the rule.
+type RuleViolationError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleViolationError) Error() string {
+	return "validation rule " + e.Rule + " failed: " + e.Err.Error()
+}
+
+func (e *RuleViolationError) Unwrap() error {
+	return e.Err
+}
+
+// NewRule returns a ValidationRule with the given name running fn.
+func NewRule(name string, fn func(ctx context.Context, node, previous *Node) error) ValidationRule {
+	return funcRule{name: name, fn: fn}
+}
+
+type funcRule struct {
+	name string
+	fn   func(ctx context.Context, node, previous *Node) error
+}
+
+func (r funcRule) Name() string {
+	return r.name
+}
+
+func (r funcRule) Validate(ctx context.Context, node, previous *Node) error {
+	return r.fn(ctx, node, previous)
+}
+
+// MaxDataSize rejects nodes whose payload, inline or chunked, is larger than
+// size bytes with ErrDataTooLarge.
+func MaxDataSize(size int64) ValidationRule {
+	return NewRule("max-data-size", func(ctx context.Context, node, previous *Node) error {
+		dataSize := int64(len(node.Data))
+		if node.HasExternalData() {
+			dataSize = node.DataSize
+		}
+		if dataSize > size {
+			return ErrDataTooLarge
+		}
+		return nil
+	})
+}
+
+// AllowedPropertyKeys rejects nodes with Properties keys not in keys with
+// ErrPropertyNotAllowed.
+func AllowedPropertyKeys(keys ...string) ValidationRule {
+	allowed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		allowed[k] = true
+	}
+	return NewRule("allowed-property-keys", func(ctx context.Context, node, previous *Node) error {
+		for k := range node.Properties {
+			if !allowed[k] {
+				return ErrPropertyNotAllowed
+			}
+		}
+		return nil
+	})
+}
+
+// MaxClockSkew rejects nodes whose Timestamp is more than skew ahead of the
+// local clock with ErrClockSkew.
+func MaxClockSkew(skew time.Duration) ValidationRule {
+	return NewRule("max-clock-skew", func(ctx context.Context, node, previous *Node) error {
+		ts, er := time.Parse(time.RFC3339, node.Timestamp)
+		if er != nil {
+			return ErrInvalidNodeTimestamp
+		}
+		if ts.After(time.Now().Add(skew)) {
+			return ErrClockSkew
+		}
+		return nil
+	})
+}
+
+// MinInterval limits the rate at which an address appends to a branch: nodes
+// whose Timestamp is less than interval after the one of the previous node of
+// the same branch are rejected with ErrRateLimited.
+func MinInterval(interval time.Duration) ValidationRule {
+	return NewRule("min-interval", func(ctx context.Context, node, previous *Node) error {
+		if previous.Branch != node.Branch {
+			return nil
+		}
+		ts, er := time.Parse(time.RFC3339, node.Timestamp)
+		if er != nil {
+			return ErrInvalidNodeTimestamp
+		}
+		previousTs, er := time.Parse(time.RFC3339, previous.Timestamp)
+		if er != nil {
+			return ErrInvalidNodeTimestamp
+		}
+		if ts.Sub(previousTs) < interval {
+			return ErrRateLimited
+		}
+		return nil
+	})
+}
+
+// ForBranch restricts rule to the nodes of the given branch, e.g. to check the
+// payload of a branch against its schema.
+func ForBranch(branch string, rule ValidationRule) ValidationRule {
+	return NewRule(rule.Name(), func(ctx context.Context, node, previous *Node) error {
+		if node.Branch != branch {
+			return nil
+		}
+		return rule.Validate(ctx, node, previous)
+	})
+}
+
+// verifyRules runs the registered rules in order, stopping at the first one
+// rejecting the node.
+func (da *Dag) verifyRules(ctx context.Context, node, previous *Node) error {
+	for _, rule := range da.rules {
+		if er := rule.Validate(ctx, node, previous); er != nil {
+			return &RuleViolationError{Rule: rule.Name(), Err: er}
+		}
+	}
+	return nil
+}
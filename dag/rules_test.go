@@ -0,0 +1,105 @@
+package dag_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/internal/util"
+)
+
+var _ = Describe("Validation rules", func() {
+	var ctx context.Context
+	var genesisNode *dag.Node
+	var genesisAddr *address.Address
+
+	newDag := func(rules ...dag.ValidationRule) (*dag.Dag, string) {
+		return CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore(), dag.WithValidationRules(rules...))
+	}
+
+	expectViolation := func(err error, rule string, cause error) {
+		violation := &dag.RuleViolationError{}
+		Expect(errors.As(err, &violation)).To(BeTrue())
+		Expect(violation.Rule).To(Equal(rule))
+		Expect(errors.Is(err, cause)).To(BeTrue())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		genesisNode, genesisAddr = CreateGenesisNode()
+	})
+
+	It("Should reject nodes failing the built-in rules", func() {
+		da, genesisKey := newDag(dag.MaxDataSize(100), dag.AllowedPropertyKeys("title"), dag.MaxClockSkew(time.Minute))
+
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte(util.RandString(256))
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err := da.Append(ctx, node, genesisKey)
+		expectViolation(err, "max-data-size", dag.ErrDataTooLarge)
+
+		node = CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		node.Data = []byte("small")
+		Expect(da.PrepareData(ctx, node)).To(BeNil())
+		node.Properties = map[string]string{"title": "a", "author": "b"}
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, node, genesisKey)
+		expectViolation(err, "allowed-property-keys", dag.ErrPropertyNotAllowed)
+
+		node.Properties = map[string]string{"title": "a"}
+		node.Timestamp = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, node, genesisKey)
+		expectViolation(err, "max-clock-skew", dag.ErrClockSkew)
+		Expect(da.VerifyNode(ctx, node, genesisKey, false)).To(HaveOccurred())
+
+		node.Timestamp = time.Now().UTC().Format(time.RFC3339)
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should limit the append rate of a branch", func() {
+		da, genesisKey := newDag(dag.MinInterval(time.Hour))
+
+		node := CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2)
+		_, err := da.Append(ctx, node, genesisKey)
+		expectViolation(err, "min-interval", dag.ErrRateLimited)
+
+		node.Timestamp = time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)
+		_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		_, err = da.Append(ctx, node, genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should run custom rules only on their branch", func() {
+		errNotJson := errors.New("not json")
+		jsonOnly := dag.NewRule("json-payload", func(ctx context.Context, node, previous *dag.Node) error {
+			if node.Properties["format"] != "json" {
+				return errNotJson
+			}
+			return nil
+		})
+		da, genesisKey := newDag(dag.ForBranch("documents", jsonOnly))
+
+		key, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+
+		open := CreateNodeV2(genesisAddr, key, key, "documents", 1)
+		open.Type = dag.NodeTypeBranchOpen
+		open.Properties = map[string]string{"format": "json"}
+		_ = open.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+		openKey, err := da.CreateBranch(ctx, open)
+		Expect(err).To(BeNil())
+
+		_, err = da.Append(ctx, CreateNodeV2(genesisAddr, key, openKey, "documents", 2), key)
+		expectViolation(err, "json-payload", errNotJson)
+	})
+})
@@ -0,0 +1,91 @@
+package dag
+
+import (
+	"context"
+	"slices"
+)
+
+// Skip pointers let readers reach any sequence number of a branch following a
+// logarithmic number of links instead of walking Previous one node at a time.
+//
+// Skips[k-1] of a node with sequence s references the closest ancestor whose
+// sequence is a multiple of 2^k, that is the ancestor at ((s-1) >> k) << k,
+// for every k where that sequence is at least 1. Pointers are aligned this way
+// so they can be derived from the previous node alone: each level either is
+// the previous node itself or is inherited from it.
+
+// ComputeSkips returns the skip pointers of a node with sequence seq appended
+// after previous, whose key is previousKey. The first node of a branch has no
+// skips. If previous lacks some of its own skips, as nodes created before skip
+// pointers existed do, the returned list is truncated at the first missing
+// level.
+func ComputeSkips(previous *Node, previousKey string, seq int64) []string {
+	if seq <= 1 || previous == nil || previous.Seq != seq-1 {
+		return nil
+	}
+	var skips []string
+	for k := 1; skipTarget(seq, k) >= 1; k++ {
+		switch {
+		case previous.Seq%(1<<k) == 0:
+			skips = append(skips, previousKey)
+		case len(previous.Skips) >= k:
+			skips = append(skips, previous.Skips[k-1])
+		default:
+			return skips
+		}
+	}
+	return skips
+}
+
+// SeekSeq walks back from the node with key fromKey to the node of the same
+// branch with the given sequence number, following skip pointers when
+// possible. Returns ErrNodeNotFound if there is no such node.
+func (da *Dag) SeekSeq(ctx context.Context, fromKey string, seq int64) (*Node, string, error) {
+	if seq < 1 {
+		return nil, "", ErrNodeNotFound
+	}
+	key := fromKey
+	node, er := da.getNodeByKey(ctx, key)
+	for {
+		if er != nil {
+			return nil, "", da.translateError(er)
+		}
+		if node == nil || node.Seq < seq {
+			return nil, "", ErrNodeNotFound
+		}
+		if node.Seq == seq {
+			return node, key, nil
+		}
+		key = node.Previous
+		for k := len(node.Skips); k >= 1; k-- {
+			if skipTarget(node.Seq, k) >= seq {
+				key = node.Skips[k-1]
+				break
+			}
+		}
+		if key == "" {
+			return nil, "", ErrNodeNotFound
+		}
+		node, er = da.getNodeByKey(ctx, key)
+	}
+}
+
+// verifySkips checks that the skip pointers of a node are the ones derived
+// from its previous node. Skips are optional, but when present they must be
+// signed, so only v2 nodes can have them.
+func (da *Dag) verifySkips(node, previous *Node) error {
+	if len(node.Skips) == 0 {
+		return nil
+	}
+	if node.GetVersion() < NodeVersion2 {
+		return ErrInvalidSkips
+	}
+	if !slices.Equal(node.Skips, ComputeSkips(previous, node.Previous, node.Seq)) {
+		return ErrInvalidSkips
+	}
+	return nil
+}
+
+func skipTarget(seq int64, level int) int64 {
+	return ((seq - 1) >> level) << level
+}
@@ -0,0 +1,353 @@
+package dag
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// The Dag keeps the heads of every address in an index: the sorted list of
+// their keys, stored in the data store and resolved by name, as branch
+// indexes are. It is updated as nodes are appended, replicated or imported,
+// so peers can compare heads without walking the DAG. DAGs written before the
+// index existed are walked once, on their next change. Only the addresses the
+// resolver manages are indexed.
+
+// Heads returns the keys of the heads of the DAG of addr: the nodes no other
+// node follows, whether through Previous, merge Parents or Redacts. They are
+// sorted, so the result is deterministic. The heads of an address the
+// resolver does not manage are found among the nodes stored for it (see
+// NodeLinks), as its names are only known to the peers managing it.
+func (da *Dag) Heads(ctx context.Context, addr string) ([]string, error) {
+	if !da.resolver.IsManaged(addr) {
+		return da.storedHeads(ctx, addr)
+	}
+	_, heads, er := da.getHeadsIndex(ctx, addr)
+	if er != nil {
+		return nil, er
+	}
+	if heads != nil {
+		return heads, nil
+	}
+	return da.walkHeads(ctx, addr)
+}
+
+// MissingNodes returns the keys of the nodes of the DAG of addr a peer knowing
+// the given heads lacks: every node that neither is one of the heads nor is
+// followed by one of them, directly or not. Heads unknown to this DAG are
+// ignored. Keys are sorted so every node comes after the nodes it references,
+// the order PutNodeBytes needs them in.
+//
+// The DAG is walked back from its heads, greatest clock first, and only until
+// every node left to visit is known to the peer, so the walk is bounded by
+// the nodes the peer lacks, not by the history of the address. A node comes
+// before the nodes it follows, as clocks strictly increase, so whether the
+// peer knows it is settled by the time it is visited. Nodes without clocks
+// are ordered by timestamp instead, and a few the peer knows may be listed.
+func (da *Dag) MissingNodes(ctx context.Context, addr string, heads []string) ([]string, error) {
+	localHeads, er := da.Heads(ctx, addr)
+	if er != nil {
+		return nil, er
+	}
+	known := map[string]bool{}
+	for _, key := range heads {
+		known[key] = true
+	}
+	w := missingWalk{da: da, known: known, entries: map[string]*missingEntry{}}
+	for _, key := range localHeads {
+		if er := w.push(ctx, key, false); er != nil {
+			return nil, er
+		}
+	}
+	missing := map[string]*Node{}
+	for w.unknown > 0 {
+		entry := heap.Pop(&w.frontier).(*missingEntry)
+		entry.visited = true
+		if !entry.known {
+			w.unknown--
+			missing[entry.key] = entry.node
+		}
+		for _, predecessor := range clockPredecessors(entry.node) {
+			if er := w.push(ctx, predecessor.key, entry.known); er != nil {
+				return nil, er
+			}
+		}
+	}
+	return sortNodesForImport(missing), nil
+}
+
+// missingWalk is the state of the walk of MissingNodes: the frontier of nodes
+// to visit, and how many of them the peer is not known to have.
+type missingWalk struct {
+	da       *Dag
+	known    map[string]bool
+	entries  map[string]*missingEntry
+	frontier missingQueue
+	unknown  int
+}
+
+type missingEntry struct {
+	key       string
+	node      *Node
+	timestamp time.Time
+	known     bool
+	visited   bool
+}
+
+// push adds the node with the given key to the frontier, or marks it known if
+// it is already there. Nodes already visited are not visited again.
+func (w *missingWalk) push(ctx context.Context, key string, known bool) error {
+	known = known || w.known[key]
+	if entry, ok := w.entries[key]; ok {
+		if known && !entry.known && !entry.visited {
+			entry.known = true
+			w.unknown--
+		}
+		return nil
+	}
+	node, er := w.da.getNodeByKey(ctx, key)
+	if er != nil {
+		return w.da.translateError(er)
+	}
+	if node == nil {
+		return ErrNodeNotFound
+	}
+	ts, _ := time.Parse(time.RFC3339, node.Timestamp)
+	entry := &missingEntry{key: key, node: node, timestamp: ts, known: known}
+	w.entries[key] = entry
+	if !known {
+		w.unknown++
+	}
+	heap.Push(&w.frontier, entry)
+	return nil
+}
+
+// missingQueue orders the nodes to visit, greatest clock first, then newest
+// timestamp and greatest sequence number, for nodes without clocks.
+type missingQueue []*missingEntry
+
+func (q missingQueue) Len() int { return len(q) }
+
+func (q missingQueue) Less(i, j int) bool {
+	if q[i].node.Clock != q[j].node.Clock {
+		return q[i].node.Clock > q[j].node.Clock
+	}
+	if !q[i].timestamp.Equal(q[j].timestamp) {
+		return q[i].timestamp.After(q[j].timestamp)
+	}
+	if q[i].node.Seq != q[j].node.Seq {
+		return q[i].node.Seq > q[j].node.Seq
+	}
+	return q[i].key > q[j].key
+}
+
+func (q missingQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *missingQueue) Push(x any) { *q = append(*q, x.(*missingEntry)) }
+
+func (q *missingQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// GetNodeBytes returns the node with the given key as stored, so a peer can
+// store it with PutNodeBytes under the same key.
+func (da *Dag) GetNodeBytes(ctx context.Context, key string) ([]byte, error) {
+	return da.readBlob(ctx, key)
+}
+
+// PutNodeBytes verifies and stores a node read by a peer with GetNodeBytes.
+// Nodes are verified with VerifyNode, so the nodes they reference must be
+// stored first; a root node, which follows none, is verified as SetRoot does.
+// Branch heads are left as they are; only the address clock and heads are
+// updated, when the resolver manages the address. Nodes already stored are
+// skipped. The node must be stored under key, otherwise ErrNodeKeyMismatch is
+// returned, as nodes reference each other by key; peers must then use the
+// same kind of data store.
+func (da *Dag) PutNodeBytes(ctx context.Context, key string, data []byte) error {
+	node, er := decodeNode(data)
+	if er != nil {
+		return ErrInvalidNodeEncoding
+	}
+	if eds, ok := da.dt.(datastore.ExtendedDataStore); ok {
+		found, er := eds.Has(ctx, key)
+		if er != nil {
+			return da.translateError(er)
+		}
+		if found {
+			return nil
+		}
+	}
+	var stored string
+	if node.Previous == "" {
+		stored, er = da.importRootNode(ctx, node, data)
+	} else {
+		stored, er = da.importNode(ctx, node, data)
+	}
+	if er != nil {
+		return da.translateError(er)
+	}
+	if stored != key {
+		return ErrNodeKeyMismatch
+	}
+	da.observe(ctx, node, key)
+	if !da.resolver.IsManaged(node.Address) {
+		return nil
+	}
+	er = da.advanceClock(ctx, node, key)
+	if er != nil {
+		return er
+	}
+	return da.addHeads(ctx, node.Address, []string{key}, []*Node{node})
+}
+
+// addHeads records the nodes with the given keys, in order, as heads of addr,
+// in place of the nodes they follow. The index is swapped atomically, and
+// rebuilt if another change won the race.
+func (da *Dag) addHeads(ctx context.Context, addr string, keys []string, nodes []*Node) error {
+	for {
+		indexKey, heads, er := da.getHeadsIndex(ctx, addr)
+		if er != nil {
+			return er
+		}
+		if heads == nil {
+			heads, er = da.walkHeads(ctx, addr)
+			if er != nil && !errors.Is(er, resolver.ErrNotFound) {
+				return er
+			}
+		}
+		for i, node := range nodes {
+			heads = nextHeads(heads, node, keys[i])
+		}
+		data, er := json.Marshal(heads)
+		if er != nil {
+			return er
+		}
+		newIndexKey, _, er := da.dt.Put(ctx, data, nil)
+		if er != nil {
+			return er
+		}
+		er = da.resolver.CompareAndSwap(ctx, da.getHeadsIndexName(addr), indexKey, newIndexKey)
+		if !errors.Is(er, resolver.ErrValueChanged) {
+			return er
+		}
+	}
+}
+
+// nextHeads returns heads once the node with the given key is added: the
+// node replaces the heads it follows.
+func nextHeads(heads []string, node *Node, key string) []string {
+	followed := map[string]bool{}
+	for _, predecessor := range clockPredecessors(node) {
+		followed[predecessor.key] = true
+	}
+	next := []string{key}
+	for _, head := range heads {
+		if !followed[head] && head != key {
+			next = append(next, head)
+		}
+	}
+	sort.Strings(next)
+	return next
+}
+
+// getHeadsIndex returns the key of the heads index of addr and the heads it
+// lists, or nil heads if there is no index, or its content is gone.
+func (da *Dag) getHeadsIndex(ctx context.Context, addr string) (string, []string, error) {
+	indexKey, er := da.resolveManagedName(ctx, addr, da.getHeadsIndexName(addr))
+	if errors.Is(er, resolver.ErrNotFound) {
+		return "", nil, nil
+	}
+	if er != nil {
+		return "", nil, er
+	}
+	f, er := da.dt.Get(ctx, indexKey)
+	if errors.Is(er, datastore.ErrNotFound) {
+		return indexKey, nil, nil
+	}
+	if er != nil {
+		return "", nil, er
+	}
+	data, er := da.readLimited(f)
+	if er != nil {
+		return "", nil, er
+	}
+	heads := []string{}
+	er = json.Unmarshal(data, &heads)
+	if er != nil {
+		return "", nil, er
+	}
+	return indexKey, heads, nil
+}
+
+// walkHeads finds the heads of addr walking its DAG, for DAGs without a heads
+// index.
+func (da *Dag) walkHeads(ctx context.Context, addr string) ([]string, error) {
+	followed := map[string]bool{}
+	var keys []string
+	er := da.WalkAddress(ctx, addr, func(key string, node *Node) error {
+		keys = append(keys, key)
+		for _, predecessor := range clockPredecessors(node) {
+			followed[predecessor.key] = true
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, er
+	}
+	return unfollowed(keys, followed), nil
+}
+
+// storedHeads finds the heads of addr among the nodes the data store holds
+// for it, without resolving any name.
+func (da *Dag) storedHeads(ctx context.Context, addr string) ([]string, error) {
+	followed := map[string]bool{}
+	seen := map[string]bool{}
+	var keys []string
+	for link, er := range da.NodeLinks(ctx, addr) {
+		if er != nil {
+			return nil, er
+		}
+		if seen[link.Key] {
+			continue
+		}
+		seen[link.Key] = true
+		node, er := da.getNodeByKey(ctx, link.Key)
+		if er != nil {
+			return nil, da.translateError(er)
+		}
+		if node == nil {
+			return nil, ErrNodeNotFound
+		}
+		keys = append(keys, link.Key)
+		for _, predecessor := range clockPredecessors(node) {
+			followed[predecessor.key] = true
+		}
+	}
+	return unfollowed(keys, followed), nil
+}
+
+// unfollowed returns the sorted keys no node follows.
+func unfollowed(keys []string, followed map[string]bool) []string {
+	heads := []string{}
+	for _, key := range keys {
+		if !followed[key] {
+			heads = append(heads, key)
+		}
+	}
+	sort.Strings(heads)
+	return heads
+}
+
+func (da *Dag) getHeadsIndexName(addr string) string {
+	return da.getName(addr, "indexes", "heads")
+}
@@ -0,0 +1,59 @@
+package dag_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Sync", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("Should sync a remote address without resolving names its owner lacks", func() {
+		genesisNode, genesisAddr := CreateGenesisNode()
+		ownerRes := resolver.NewLocalResolver()
+		owner, genesisKey := CreateRootedDagWithResolver(genesisNode, genesisAddr, datastore.NewLocalFileStore(), ownerRes)
+		prev := genesisKey
+		for seq := int64(2); seq <= 4; seq++ {
+			var err error
+			prev, err = owner.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, prev, defaultBranch, seq), genesisKey)
+			Expect(err).To(BeNil())
+		}
+		heads, err := owner.Heads(ctx, genesisAddr.Address)
+		Expect(err).To(BeNil())
+		keys, err := owner.MissingNodes(ctx, genesisAddr.Address, nil)
+		Expect(err).To(BeNil())
+		Expect(keys).To(HaveLen(4))
+
+		remote := &remoteResolver{Resolver: resolver.NewLocalResolver(), owner: ownerRes}
+		follower := dag.NewDag("test-ledger", datastore.NewLocalFileStore(), remote)
+		for _, key := range keys {
+			data, err := owner.GetNodeBytes(ctx, key)
+			Expect(err).To(BeNil())
+			Expect(follower.PutNodeBytes(ctx, key, data)).To(BeNil())
+		}
+
+		Expect(follower.Heads(ctx, genesisAddr.Address)).To(Equal(heads))
+		missing, err := follower.MissingNodes(ctx, genesisAddr.Address, heads)
+		Expect(err).To(BeNil())
+		Expect(missing).To(BeEmpty())
+		_, last, err := follower.GetLast(ctx, genesisKey, defaultBranch)
+		Expect(err).To(BeNil())
+		Expect(last).To(Equal(prev))
+		branches, err := follower.ListBranches(ctx, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(branches).To(HaveLen(1))
+		Expect(follower.GetRedaction(ctx, prev)).To(BeEmpty())
+		Expect(follower.GetTimestampToken(ctx, prev)).To(BeNil())
+		Expect(remote.unanswered).To(BeZero())
+	})
+})
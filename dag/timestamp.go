@@ -0,0 +1,153 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+	"github.com/msaldanha/setinstone/tsa"
+)
+
+// Countersign asks authority to countersign the node with the given key and
+// stores the returned token next to the node, where GetTimestampToken finds
+// it. The token proves the node existed at the token time, so it must not be
+// dated before the node Timestamp. A node keeps the first token stored for it;
+// countersigning it again returns ErrNodeAlreadyCountersigned.
+func (da *Dag) Countersign(ctx context.Context, key string, authority tsa.Authority) (*tsa.Token, error) {
+	node, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if node == nil {
+		return nil, ErrNodeNotFound
+	}
+	token, er := authority.Stamp(ctx, key)
+	if er != nil {
+		return nil, er
+	}
+	if er := da.verifyTimestampToken(node, key, token); er != nil {
+		return nil, er
+	}
+	data, er := token.ToJson()
+	if er != nil {
+		return nil, er
+	}
+	pathFunc, er := da.timestampPathFunc(ctx, node, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	tokenKey, _, er := da.dt.Put(ctx, data, pathFunc)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	er = da.resolver.CompareAndSwap(ctx, da.getTimestampName(node.Address, key), "", tokenKey)
+	if errors.Is(er, resolver.ErrValueChanged) {
+		return nil, ErrNodeAlreadyCountersigned
+	}
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	return token, nil
+}
+
+// GetTimestampToken returns the verified timestamp token stored for the node
+// with the given key, or nil if the node was not countersigned. The token
+// signature is checked, but not whether its PubKey belongs to an authority the
+// caller trusts. Tokens are recorded by the resolver managing the address of
+// the node, so nil is returned for the nodes of other addresses.
+func (da *Dag) GetTimestampToken(ctx context.Context, key string) (*tsa.Token, error) {
+	node, er := da.getNodeByKey(ctx, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if node == nil {
+		return nil, ErrNodeNotFound
+	}
+	tokenKey, er := da.resolveManagedName(ctx, node.Address, da.getTimestampName(node.Address, key))
+	if errors.Is(er, resolver.ErrNotFound) {
+		return nil, nil
+	}
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	data, er := da.readBlob(ctx, tokenKey)
+	if er != nil {
+		return nil, er
+	}
+	token := &tsa.Token{}
+	if er := token.FromJson(data); er != nil {
+		return nil, ErrInvalidTimestampToken
+	}
+	if er := da.verifyTimestampToken(node, key, token); er != nil {
+		return nil, er
+	}
+	return token, nil
+}
+
+func (da *Dag) verifyTimestampToken(node *Node, key string, token *tsa.Token) error {
+	if token.Subject != key || token.Verify() != nil {
+		return ErrInvalidTimestampToken
+	}
+	tokenTime, _ := token.GetTime()
+	ts, er := time.Parse(time.RFC3339, node.Timestamp)
+	if er != nil || tokenTime.Before(ts) {
+		return ErrInvalidTimestampToken
+	}
+	return nil
+}
+
+// verifyTimestampOrder checks the node is not dated before the node it
+// follows. Timestamps ahead of the local clock are bounded by the MaxClockSkew
+// rule, see WithMaxFutureSkew.
+func (da *Dag) verifyTimestampOrder(node, previous *Node) error {
+	ts, er := time.Parse(time.RFC3339, node.Timestamp)
+	if er != nil {
+		return ErrInvalidNodeTimestamp
+	}
+	previousTs, er := time.Parse(time.RFC3339, previous.Timestamp)
+	if er != nil {
+		return ErrInvalidNodeTimestamp
+	}
+	if ts.Before(previousTs) {
+		return ErrNodeTimestampOutOfOrder
+	}
+	return nil
+}
+
+// countersignAppended countersigns appended nodes with the authority set with
+// WithTimestampAuthority, if any.
+func (da *Dag) countersignAppended(ctx context.Context, keys ...string) error {
+	if da.timestampAuthority == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if _, er := da.Countersign(ctx, key, da.timestampAuthority); er != nil {
+			return er
+		}
+	}
+	return nil
+}
+
+// timestampPathFunc returns the function building the path of the timestamp
+// token of a node, next to the node itself.
+func (da *Dag) timestampPathFunc(ctx context.Context, node *Node, key string) (datastore.PathFunc, error) {
+	nodePath := da.getName(node.Address, key, "node")
+	if node.BranchRoot != "" {
+		pathFunc, er := da.branchPathFunc(ctx, node, node.BranchRoot)
+		if er != nil {
+			return nil, er
+		}
+		nodePath = pathFunc(key)
+	}
+	dir := strings.TrimSuffix(nodePath, "/node")
+	return func(cid string) string {
+		return dir + "/timestamp"
+	}, nil
+}
+
+func (da *Dag) getTimestampName(addr, nodeKey string) string {
+	return da.getName(addr, "timestamps", nodeKey)
+}
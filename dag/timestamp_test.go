@@ -0,0 +1,95 @@
+package dag_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+	"github.com/msaldanha/setinstone/tsa"
+)
+
+var _ = Describe("Timestamps", func() {
+	var ctx context.Context
+	var genesisNode *dag.Node
+	var genesisAddr *address.Address
+	var authority *tsa.LocalAuthority
+
+	newDag := func(options ...dag.DagOption) (*dag.Dag, string) {
+		return CreateRootedDag(genesisNode, genesisAddr, datastore.NewLocalFileStore(), options...)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		genesisNode, genesisAddr = CreateGenesisNode()
+		keys, err := address.NewKeyPair()
+		Expect(err).To(BeNil())
+		authority = tsa.NewLocalAuthority(keys)
+	})
+
+	It("Should NOT register node dated before the previous one", func() {
+		da, genesisKey := newDag()
+		_, err := da.Append(ctx, CreateNodeAt(genesisAddr, genesisKey, genesisKey, 2, time.Now().Add(-time.Hour)), genesisKey)
+		Expect(err).To(Equal(dag.ErrNodeTimestampOutOfOrder))
+
+		_, err = da.Append(ctx, CreateNodeAt(genesisAddr, genesisKey, genesisKey, 2, time.Now().Add(time.Hour)), genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should NOT register node too far in the future", func() {
+		da, genesisKey := newDag(dag.WithMaxFutureSkew(time.Minute))
+		_, err := da.Append(ctx, CreateNodeAt(genesisAddr, genesisKey, genesisKey, 2, time.Now().Add(time.Hour)), genesisKey)
+		Expect(errors.Is(err, dag.ErrClockSkew)).To(BeTrue())
+
+		_, err = da.Append(ctx, CreateNodeAt(genesisAddr, genesisKey, genesisKey, 2, time.Now().Add(30*time.Second)), genesisKey)
+		Expect(err).To(BeNil())
+	})
+
+	It("Should countersign nodes and keep the token next to them", func() {
+		da, genesisKey := newDag(dag.WithTimestampAuthority(authority))
+		key, err := da.Append(ctx, CreateNodeV2(genesisAddr, genesisKey, genesisKey, defaultBranch, 2), genesisKey)
+		Expect(err).To(BeNil())
+
+		token, err := da.GetTimestampToken(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(token).NotTo(BeNil())
+		Expect(token.Subject).To(Equal(key))
+		Expect(token.PubKey).To(Equal(authority.PubKey()))
+
+		_, err = da.Countersign(ctx, key, authority)
+		Expect(err).To(Equal(dag.ErrNodeAlreadyCountersigned))
+
+		token, err = da.GetTimestampToken(ctx, genesisKey)
+		Expect(err).To(BeNil())
+		Expect(token).To(BeNil())
+		_, err = da.Countersign(ctx, genesisKey, authority)
+		Expect(err).To(BeNil())
+
+		buf := &bytes.Buffer{}
+		Expect(da.Export(ctx, genesisAddr.Address, buf)).To(BeNil())
+		res := resolver.NewLocalResolver()
+		_ = res.Manage(genesisAddr)
+		imported := dag.NewDag("test-ledger", datastore.NewLocalFileStore(), res)
+		_, err = imported.Import(ctx, buf)
+		Expect(err).To(BeNil())
+		token, err = imported.GetTimestampToken(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(token).NotTo(BeNil())
+	})
+
+	It("Should NOT accept tokens dated before the node", func() {
+		da, genesisKey := newDag()
+		key, err := da.Append(ctx, CreateNodeAt(genesisAddr, genesisKey, genesisKey, 2, time.Now().Add(time.Hour)), genesisKey)
+		Expect(err).To(BeNil())
+
+		_, err = da.Countersign(ctx, key, authority)
+		Expect(err).To(Equal(dag.ErrInvalidTimestampToken))
+	})
+})
@@ -0,0 +1,311 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path"
+	"sync"
+
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// DefaultPrefetchWindow is the number of nodes Walk reads ahead by default.
+const DefaultPrefetchWindow = 32
+
+// WalkFunc is called by WalkAddress and Walk for every node visited.
+type WalkFunc func(key string, node *Node) error
+
+// WalkOption configures optional behaviour of Walk.
+type WalkOption func(*walkOptions)
+
+type walkOptions struct {
+	window int
+}
+
+// WithPrefetchWindow sets how many nodes ahead of the one being visited Walk
+// may read, concurrently. A window of 1 disables prefetching.
+func WithPrefetchWindow(window int) WalkOption {
+	return func(o *walkOptions) {
+		o.window = max(window, 1)
+	}
+}
+
+// Walk visits the node with key fromKey and then its ancestors, following
+// Previous links down to the root of the DAG, calling fn once per node in
+// that order. Returning ErrStopWalk from fn ends the walk without error.
+//
+// Ancestors are read ahead of fn, concurrently, within a window of nodes set
+// with WithPrefetchWindow. Reading a node only reveals its Previous key, so
+// skip pointers are used to learn the keys of farther ancestors, letting reads
+// from a slow data store overlap. At most window nodes are kept in memory at
+// any time, besides the one being visited.
+func (da *Dag) Walk(ctx context.Context, fromKey string, fn WalkFunc, options ...WalkOption) error {
+	opts := walkOptions{window: DefaultPrefetchWindow}
+	for _, option := range options {
+		option(&opts)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := newPrefetcher(ctx, da, opts.window)
+	defer p.wait()
+	defer cancel()
+
+	key := fromKey
+	for pos := 0; key != ""; pos++ {
+		node, er := p.get(ctx, key, pos)
+		if er != nil {
+			return er
+		}
+		if er := fn(key, node); er != nil {
+			if errors.Is(er, ErrStopWalk) {
+				return nil
+			}
+			return er
+		}
+		key = node.Previous
+	}
+	return nil
+}
+
+// WalkAddress visits every node of every branch of the DAG of addr, starting
+// at its root, calling fn once per node. Branches declared or opened at any
+// visited node are followed too. Nodes are visited from each branch head
+// backwards, so a node may be visited before its ancestors.
+func (da *Dag) WalkAddress(ctx context.Context, addr string, fn WalkFunc) error {
+	root, rootKey, er := da.GetRoot(ctx, addr)
+	if er != nil {
+		return er
+	}
+	return da.walkFrom(ctx, rootKey, root, fn)
+}
+
+// WalkKeys calls fn with the key of the node with key rootKey, of every node
+// of the branches rooted at it, recursively, and of every blob those nodes
+// reference: payload chunks, branch indexes and timestamp tokens. Chunks of
+// redacted payloads, which were removed, are skipped.
+func (da *Dag) WalkKeys(ctx context.Context, rootKey string, fn func(key string) error) error {
+	root, er := da.getNodeByKey(ctx, rootKey)
+	if er != nil {
+		return da.translateError(er)
+	}
+	if root == nil {
+		return ErrNodeNotFound
+	}
+	return da.walkFrom(ctx, rootKey, root, func(key string, node *Node) error {
+		if er := fn(key); er != nil {
+			return er
+		}
+		blobs, er := da.nodeBlobs(ctx, key, node)
+		if er != nil {
+			return er
+		}
+		for _, blob := range blobs {
+			if er := fn(blob); er != nil {
+				return er
+			}
+		}
+		return nil
+	})
+}
+
+func (da *Dag) walkFrom(ctx context.Context, rootKey string, root *Node, fn WalkFunc) error {
+	visited := map[string]bool{rootKey: true}
+	if er := fn(rootKey, root); er != nil {
+		return er
+	}
+	pending := []string{rootKey}
+	for len(pending) > 0 {
+		branchRootKey := pending[0]
+		pending = pending[1:]
+		branches, er := da.ListBranches(ctx, branchRootKey)
+		if er != nil {
+			return er
+		}
+		for _, branch := range branches {
+			key := branch.HeadKey
+			for key != "" && key != branchRootKey && !visited[key] {
+				node, er := da.getNodeByKey(ctx, key)
+				if er != nil {
+					return da.translateError(er)
+				}
+				if node == nil {
+					return ErrNodeNotFound
+				}
+				visited[key] = true
+				if er := fn(key, node); er != nil {
+					return er
+				}
+				pending = append(pending, key)
+				key = node.Previous
+			}
+		}
+	}
+	return nil
+}
+
+// NodeLinks yields the data store links of the nodes of addr: every node
+// stored with a path, the ones stored by appends that failed, which no branch
+// references, included. Nothing is yielded when the data store does not
+// implement datastore.PathLinker.
+func (da *Dag) NodeLinks(ctx context.Context, addr string) iter.Seq2[datastore.Link, error] {
+	return func(yield func(datastore.Link, error) bool) {
+		linker, ok := da.dt.(datastore.PathLinker)
+		if !ok {
+			return
+		}
+		for link, er := range linker.Paths(ctx, da.getName(addr)) {
+			if er != nil {
+				yield(link, da.translateError(er))
+				return
+			}
+			if path.Base(link.Path) != "node" {
+				continue
+			}
+			if !yield(link, nil) {
+				return
+			}
+		}
+	}
+}
+
+// nodeBlobs returns the keys of the blobs stored for a node besides the node
+// itself.
+func (da *Dag) nodeBlobs(ctx context.Context, key string, node *Node) ([]string, error) {
+	var blobs []string
+	tombstoneKey, er := da.GetRedaction(ctx, key)
+	if er != nil {
+		return nil, er
+	}
+	if tombstoneKey == "" {
+		blobs = append(blobs, node.DataChunks...)
+	}
+	indexKey, _, er := da.getBranchIndex(ctx, node, key)
+	if er != nil {
+		return nil, da.translateError(er)
+	}
+	if indexKey != "" {
+		blobs = append(blobs, indexKey)
+	}
+	tokenKey, er := da.resolveManagedName(ctx, node.Address, da.getTimestampName(node.Address, key))
+	if er != nil && !errors.Is(er, resolver.ErrNotFound) {
+		return nil, da.translateError(er)
+	}
+	if er == nil {
+		blobs = append(blobs, tokenKey)
+	}
+	return blobs, nil
+}
+
+// prefetcher reads the nodes visited by Walk ahead of it. Every key learned is
+// given its position in the walk: one past its successor for a Previous link,
+// or the sequence distance for a skip pointer. Keys positioned within the
+// window past the node being visited are read concurrently.
+type prefetcher struct {
+	da      *Dag
+	ctx     context.Context
+	window  int
+	mtx     sync.Mutex
+	wg      sync.WaitGroup
+	pos     int
+	entries map[string]*prefetchEntry
+}
+
+type prefetchEntry struct {
+	pos     int
+	started bool
+	done    chan struct{}
+	node    *Node
+	er      error
+}
+
+func newPrefetcher(ctx context.Context, da *Dag, window int) *prefetcher {
+	return &prefetcher{
+		da:      da,
+		ctx:     ctx,
+		window:  window,
+		entries: map[string]*prefetchEntry{},
+	}
+}
+
+// get returns the node with the given key, at position pos of the walk,
+// waiting for it to be read, and releases it from the prefetcher.
+func (p *prefetcher) get(ctx context.Context, key string, pos int) (*Node, error) {
+	p.mtx.Lock()
+	p.pos = pos
+	e := p.learn(key, pos)
+	e.pos = pos
+	p.fill()
+	p.mtx.Unlock()
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mtx.Lock()
+	delete(p.entries, key)
+	p.mtx.Unlock()
+	return e.node, e.er
+}
+
+// learn registers a key at position pos, unless already known.
+func (p *prefetcher) learn(key string, pos int) *prefetchEntry {
+	e, found := p.entries[key]
+	if !found && pos >= p.pos {
+		e = &prefetchEntry{pos: pos, done: make(chan struct{})}
+		p.entries[key] = e
+	}
+	return e
+}
+
+// fill starts reading every known key within the window and drops the keys
+// the walk went past without visiting, which only invalid skip pointers lead
+// to.
+func (p *prefetcher) fill() {
+	for key, e := range p.entries {
+		if e.pos < p.pos {
+			delete(p.entries, key)
+			continue
+		}
+		if e.started || e.pos >= p.pos+p.window {
+			continue
+		}
+		e.started = true
+		p.wg.Add(1)
+		go p.read(key, e)
+	}
+}
+
+func (p *prefetcher) read(key string, e *prefetchEntry) {
+	defer p.wg.Done()
+	node, er := p.da.getNodeByKey(p.ctx, key)
+	if er != nil {
+		er = p.da.translateError(er)
+	} else if node == nil {
+		er = ErrNodeNotFound
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e.node, e.er = node, er
+	close(e.done)
+	if er != nil {
+		return
+	}
+	if node.Previous != "" {
+		p.learn(node.Previous, e.pos+1)
+	}
+	for k, skip := range node.Skips {
+		if distance := int(node.Seq - skipTarget(node.Seq, k+1)); distance > 0 {
+			p.learn(skip, e.pos+distance)
+		}
+	}
+	p.fill()
+}
+
+// wait waits for the reads in flight to finish.
+func (p *prefetcher) wait() {
+	p.wg.Wait()
+}
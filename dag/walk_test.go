@@ -0,0 +1,122 @@
+package dag_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("Walk", func() {
+	var ctx context.Context
+	var store *slowDataStore
+	var da *dag.Dag
+	var keys []string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		genesisNode, genesisAddr := CreateGenesisNode()
+		store = &slowDataStore{DataStore: datastore.NewLocalFileStore()}
+		var genesisKey string
+		da, genesisKey = CreateRootedDag(genesisNode, genesisAddr, store)
+		keys = []string{genesisKey}
+		previous := genesisNode
+		for seq := int64(2); seq <= 40; seq++ {
+			node := CreateNodeV2(genesisAddr, genesisKey, keys[len(keys)-1], defaultBranch, seq)
+			node.Skips = dag.ComputeSkips(previous, keys[len(keys)-1], seq)
+			_ = node.Sign(genesisAddr.Keys.ToEcdsaPrivateKey())
+			key, err := da.Append(ctx, node, genesisKey)
+			Expect(err).To(BeNil())
+			keys = append(keys, key)
+			previous = node
+		}
+		store.delay = 5 * time.Millisecond
+	})
+
+	walk := func(fromKey string, options ...dag.WalkOption) []string {
+		var visited []string
+		err := da.Walk(ctx, fromKey, func(key string, node *dag.Node) error {
+			visited = append(visited, key)
+			return nil
+		}, options...)
+		Expect(err).To(BeNil())
+		return visited
+	}
+
+	reversed := func(keys []string) []string {
+		var r []string
+		for i := len(keys) - 1; i >= 0; i-- {
+			r = append(r, keys[i])
+		}
+		return r
+	}
+
+	It("Should visit the ancestors in order", func() {
+		Expect(walk(keys[39])).To(Equal(reversed(keys)))
+		Expect(walk(keys[20], dag.WithPrefetchWindow(4))).To(Equal(reversed(keys[:21])))
+		Expect(walk(keys[39], dag.WithPrefetchWindow(1))).To(Equal(reversed(keys)))
+		Expect(store.maxInFlight).To(BeNumerically(">", 1))
+	})
+
+	It("Should read at most one node at a time without prefetching", func() {
+		Expect(walk(keys[39], dag.WithPrefetchWindow(1))).To(Equal(reversed(keys)))
+		Expect(store.maxInFlight).To(Equal(1))
+	})
+
+	It("Should stop when asked to", func() {
+		var visited []string
+		err := da.Walk(ctx, keys[39], func(key string, node *dag.Node) error {
+			visited = append(visited, key)
+			if node.Seq == 30 {
+				return dag.ErrStopWalk
+			}
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(visited).To(Equal(reversed(keys[29:])))
+
+		failure := errors.New("failure")
+		err = da.Walk(ctx, keys[39], func(key string, node *dag.Node) error {
+			return failure
+		})
+		Expect(err).To(Equal(failure))
+	})
+
+	It("Should return ErrNodeNotFound for unknown keys", func() {
+		err := da.Walk(ctx, "unknown", func(key string, node *dag.Node) error {
+			return nil
+		})
+		Expect(err).To(Equal(dag.ErrNodeNotFound))
+	})
+})
+
+// slowDataStore delays the reads made to the wrapped data store, tracking how
+// many run at the same time.
+type slowDataStore struct {
+	datastore.DataStore
+	delay       time.Duration
+	mtx         sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	s.mtx.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mtx.Unlock()
+	defer func() {
+		s.mtx.Lock()
+		s.inFlight--
+		s.mtx.Unlock()
+	}()
+	time.Sleep(s.delay)
+	return s.DataStore.Get(ctx, key)
+}
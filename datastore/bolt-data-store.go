@@ -0,0 +1,354 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	contentBucket  = "datastore_content"
+	pathsBucket    = "datastore_paths"
+	keyPathsBucket = "datastore_key_paths"
+	pinsBucket     = "datastore_pins"
+
+	listBatchSize = 1024
+)
+
+// BoltDataStore is a DataStore persisting content in a Bolt database. Content
+// is stored under the hex encoded sha256 of its bytes, as NewLocalFileStore
+// does, and the paths given on Put are kept next to it, so the store survives
+// restarts without an IPFS node. It is safe for concurrent use.
+type BoltDataStore struct {
+	db *bbolt.DB
+}
+
+var _ DataStore = (*BoltDataStore)(nil)
+var _ Pinner = (*BoltDataStore)(nil)
+var _ PathLinker = (*BoltDataStore)(nil)
+var _ ExtendedDataStore = (*BoltDataStore)(nil)
+var _ StreamPutter = (*BoltDataStore)(nil)
+
+// NewBoltDataStore creates a DataStore that uses the Bolt database db as
+// storage. The database may be shared with other components, e.g. a
+// resolver.BoltBackend, as the store only uses its own buckets.
+func NewBoltDataStore(db *bbolt.DB) (*BoltDataStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{contentBucket, pathsBucket, keyPathsBucket, pinsBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltDataStore{
+		db: db,
+	}, nil
+}
+
+// Put stores b under its sha256 key and, when pathFunc is given, maps the path
+// it builds from the key to the key. Returns the key and the path.
+func (d *BoltDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (string, string, error) {
+	hash := sha256.Sum256(b)
+	key := hex.EncodeToString(hash[:])
+	p := ""
+	if pathFunc != nil {
+		p = pathFunc(key)
+	}
+	err := d.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(contentBucket)).Put([]byte(key), b); err != nil {
+			return err
+		}
+		if p == "" {
+			return nil
+		}
+		paths := tx.Bucket([]byte(pathsBucket))
+		if previous := paths.Get([]byte(p)); previous != nil && string(previous) != key {
+			if err := tx.Bucket([]byte(keyPathsBucket)).Delete(keyPathEntry(string(previous), p)); err != nil {
+				return err
+			}
+		}
+		if err := paths.Put([]byte(p), []byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(keyPathsBucket)).Put(keyPathEntry(key, p), nil)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return key, p, nil
+}
+
+// PutReader stores the content read from r. Bolt only stores values held in
+// memory, so the content is read in full first.
+func (d *BoltDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	return d.Put(ctx, b, pathFunc)
+}
+
+// Remove deletes the content stored under key, its pin and every path mapped
+// to it, besides the one pathFunc builds, if given.
+func (d *BoltDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(contentBucket)).Delete([]byte(key)); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(pinsBucket)).Delete([]byte(key)); err != nil {
+			return err
+		}
+		paths := tx.Bucket([]byte(pathsBucket))
+		if pathFunc != nil {
+			p := []byte(pathFunc(key))
+			if string(paths.Get(p)) == key {
+				if err := paths.Delete(p); err != nil {
+					return err
+				}
+			}
+		}
+		keyPaths := tx.Bucket([]byte(keyPathsBucket))
+		prefix := keyPathEntry(key, "")
+		var entries [][]byte
+		c := keyPaths.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			entries = append(entries, bytes.Clone(k))
+		}
+		for _, entry := range entries {
+			if err := paths.Delete(entry[len(prefix):]); err != nil {
+				return err
+			}
+			if err := keyPaths.Delete(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns a reader over the content stored under key, or ErrNotFound.
+func (d *BoltDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	var b []byte
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(contentBucket)).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		b = bytes.Clone(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// ResolvePath returns the key of the content stored under path p, or
+// ErrNotFound.
+func (d *BoltDataStore) ResolvePath(ctx context.Context, p string) (string, error) {
+	var key string
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(pathsBucket)).Get([]byte(p))
+		if data == nil {
+			return ErrNotFound
+		}
+		key = string(data)
+		return nil
+	})
+	return key, err
+}
+
+func (d *BoltDataStore) Pin(ctx context.Context, key string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(contentBucket)).Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+		return tx.Bucket([]byte(pinsBucket)).Put([]byte(key), nil)
+	})
+}
+
+func (d *BoltDataStore) Unpin(ctx context.Context, key string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(pinsBucket)).Delete([]byte(key))
+	})
+}
+
+func (d *BoltDataStore) Pins(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(pinsBucket)).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (d *BoltDataStore) Size(ctx context.Context, key string) (int64, error) {
+	var size int64
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(contentBucket)).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		size = int64(len(data))
+		return nil
+	})
+	return size, err
+}
+
+func (d *BoltDataStore) Has(ctx context.Context, key string) (bool, error) {
+	var found bool
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		found = tx.Bucket([]byte(contentBucket)).Get([]byte(key)) != nil
+		return nil
+	})
+	return found, err
+}
+
+func (d *BoltDataStore) Stat(ctx context.Context, key string) (Info, error) {
+	size, err := d.Size(ctx, key)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: size, Codec: cid.Raw}, nil
+}
+
+// List yields the keys of the stored content in ascending order. Keys are read
+// in batches, each in its own transaction, so a long iteration does not keep
+// the database from being written to.
+func (d *BoltDataStore) List(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var after []byte
+		for {
+			var keys []string
+			err := d.db.View(func(tx *bbolt.Tx) error {
+				c := tx.Bucket([]byte(contentBucket)).Cursor()
+				k, _ := c.First()
+				if after != nil {
+					k, _ = c.Seek(after)
+					if bytes.Equal(k, after) {
+						k, _ = c.Next()
+					}
+				}
+				for ; k != nil && len(keys) < listBatchSize; k, _ = c.Next() {
+					keys = append(keys, string(k))
+				}
+				return nil
+			})
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, key := range keys {
+				if err := ctx.Err(); err != nil {
+					yield("", err)
+					return
+				}
+				if !yield(key, nil) {
+					return
+				}
+			}
+			if len(keys) < listBatchSize {
+				return
+			}
+			after = []byte(keys[len(keys)-1])
+		}
+	}
+}
+
+// GetMany reads the content stored under keys in a single transaction.
+func (d *BoltDataStore) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		content := tx.Bucket([]byte(contentBucket))
+		for _, key := range keys {
+			if data := content.Get([]byte(key)); data != nil {
+				result[key] = bytes.Clone(data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Paths yields the paths mapped at prefix or below it, reading them in batches
+// of listBatchSize, each in its own transaction, as List does.
+func (d *BoltDataStore) Paths(ctx context.Context, prefix string) iter.Seq2[Link, error] {
+	return func(yield func(Link, error) bool) {
+		dir := []byte(strings.TrimSuffix(prefix, "/"))
+		next := dir
+		for next != nil {
+			var links []Link
+			err := d.db.View(func(tx *bbolt.Tx) error {
+				c := tx.Bucket([]byte(pathsBucket)).Cursor()
+				k, v := c.Seek(next)
+				next = nil
+				for n := 0; k != nil && bytes.HasPrefix(k, dir); k, v = c.Next() {
+					if n == listBatchSize {
+						next = bytes.Clone(k)
+						break
+					}
+					n++
+					if isUnder(string(k), prefix) {
+						links = append(links, Link{Path: string(k), Key: string(v)})
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				yield(Link{}, err)
+				return
+			}
+			for _, link := range links {
+				if err := ctx.Err(); err != nil {
+					yield(Link{}, err)
+					return
+				}
+				if !yield(link, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Unlink removes the mapping of path. Bolt has no directories, so nothing else
+// is removed.
+func (d *BoltDataStore) Unlink(ctx context.Context, path string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		paths := tx.Bucket([]byte(pathsBucket))
+		key := paths.Get([]byte(path))
+		if key == nil {
+			return nil
+		}
+		if err := tx.Bucket([]byte(keyPathsBucket)).Delete(keyPathEntry(string(key), path)); err != nil {
+			return err
+		}
+		return paths.Delete([]byte(path))
+	})
+}
+
+// keyPathEntry builds the entry indexing path p under key, so the paths of a
+// key can be found by prefix. Keys are length prefixed, so no key is the
+// prefix of another one's entries.
+func keyPathEntry(key, p string) []byte {
+	entry := binary.AppendUvarint(nil, uint64(len(key)))
+	entry = append(entry, key...)
+	return append(entry, p...)
+}
@@ -0,0 +1,117 @@
+package datastore_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/bbolt"
+
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("BoltDataStore", func() {
+	var ctx context.Context
+	var dir string
+	var db *bbolt.DB
+	var store *datastore.BoltDataStore
+
+	open := func() {
+		var err error
+		db, err = bbolt.Open(filepath.Join(dir, "data.db"), 0600, nil)
+		Expect(err).To(BeNil())
+		store, err = datastore.NewBoltDataStore(db)
+		Expect(err).To(BeNil())
+	}
+
+	read := func(key string) string {
+		r, err := store.Get(ctx, key)
+		Expect(err).To(BeNil())
+		b, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		return string(b)
+	}
+
+	nodePath := func(key string) string {
+		return "addr/" + key + "/node"
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "bolt-data-store")
+		Expect(err).To(BeNil())
+		open()
+	})
+
+	AfterEach(func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	})
+
+	It("Should keep content and paths across restarts", func() {
+		key, p, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(key).To(Equal("ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"))
+		Expect(p).To(Equal(nodePath(key)))
+		Expect(store.Pin(ctx, key)).To(BeNil())
+
+		Expect(db.Close()).To(BeNil())
+		open()
+
+		Expect(read(key)).To(Equal("content"))
+		resolved, err := store.ResolvePath(ctx, p)
+		Expect(err).To(BeNil())
+		Expect(resolved).To(Equal(key))
+		size, err := store.Size(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(size).To(Equal(int64(7)))
+		Expect(store.Pins(ctx)).To(Equal([]string{key}))
+	})
+
+	It("Should remove content with its paths and pin", func() {
+		key, p, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		_, other, err := store.Put(ctx, []byte("content"), func(key string) string { return "other/" + key })
+		Expect(err).To(BeNil())
+		kept, _, err := store.Put(ctx, []byte("kept"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(store.Pin(ctx, key)).To(BeNil())
+
+		Expect(store.Remove(ctx, key, nil)).To(BeNil())
+
+		_, err = store.Get(ctx, key)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		_, err = store.ResolvePath(ctx, p)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		_, err = store.ResolvePath(ctx, other)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		Expect(store.Pins(ctx)).To(BeEmpty())
+		Expect(store.Pin(ctx, key)).To(Equal(datastore.ErrNotFound))
+		Expect(read(kept)).To(Equal("kept"))
+	})
+
+	It("Should be safe for concurrent use", func() {
+		var wg sync.WaitGroup
+		keys := make([]string, 20)
+		for i := range keys {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				key, _, err := store.Put(ctx, []byte(fmt.Sprint(i)), nodePath)
+				Expect(err).To(BeNil())
+				keys[i] = key
+			}(i)
+		}
+		wg.Wait()
+		for i, key := range keys {
+			Expect(read(key)).To(Equal(fmt.Sprint(i)))
+		}
+	})
+})
@@ -3,6 +3,8 @@ package datastore
 import (
 	"context"
 	"io"
+	"iter"
+	"strings"
 )
 
 //go:generate mockgen -source=data-store.go -destination=../mock/mock-data-store.go -package=mock -imports="x=github.com/msaldanha/anticorp/datastore"
@@ -14,3 +16,87 @@ type DataStore interface {
 	Remove(ctx context.Context, key string, pathFunc PathFunc) error
 	Get(ctx context.Context, key string) (io.Reader, error)
 }
+
+// BlockPutter is implemented by data stores able to persist content as a
+// native IPLD block of the given codec (a multicodec code, e.g. cid.DagCBOR)
+// instead of an opaque file, so links inside the content can be traversed.
+type BlockPutter interface {
+	PutBlock(ctx context.Context, bytes []byte, codec uint64, pathFunc PathFunc) (string, string, error)
+}
+
+// StreamPutter is implemented by data stores able to store content read from
+// a reader without holding all of it in memory, so large content can be
+// stored as it is produced.
+type StreamPutter interface {
+	// PutReader stores the content read from r until io.EOF, as Put stores
+	// bytes. Returns the key and the path.
+	PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error)
+}
+
+// Pinner is implemented by data stores able to keep content from being
+// garbage collected.
+type Pinner interface {
+	// Pin keeps the content stored under key.
+	Pin(ctx context.Context, key string) error
+	// Unpin lets the content stored under key be garbage collected.
+	Unpin(ctx context.Context, key string) error
+	// Pins lists the keys pinned, directly or as the root of a recursive pin.
+	Pins(ctx context.Context) ([]string, error)
+	// Size returns the size, in bytes, of the content stored under key.
+	Size(ctx context.Context, key string) (int64, error)
+}
+
+// PathLinker is implemented by data stores linking content at the paths built
+// by PathFunc, so links left behind, e.g. by failed appends, can be found and
+// removed.
+type PathLinker interface {
+	// Paths yields the links at prefix or below it. Iteration ends, yielding
+	// the error, when listing fails or ctx is done.
+	Paths(ctx context.Context, prefix string) iter.Seq2[Link, error]
+	// Unlink removes the link at path, and the directories it leaves empty.
+	// The content stays stored.
+	Unlink(ctx context.Context, path string) error
+}
+
+// Link is content linked at a path.
+type Link struct {
+	// Path is the path, as built by PathFunc.
+	Path string
+	// Key is the key of the linked content.
+	Key string
+}
+
+// ExtendedDataStore is implemented by data stores able to answer questions
+// about their content without reading it, and to enumerate it, e.g. for
+// garbage collection or export.
+type ExtendedDataStore interface {
+	DataStore
+	// Has tells whether content is stored under key. Only local content is
+	// considered: nothing is fetched from other peers.
+	Has(ctx context.Context, key string) (bool, error)
+	// Stat describes the content stored under key, or returns ErrNotFound.
+	Stat(ctx context.Context, key string) (Info, error)
+	// List yields the keys of the stored content. Iteration ends, yielding the
+	// error, when listing fails or ctx is done.
+	List(ctx context.Context) iter.Seq2[string, error]
+	// GetMany returns the content stored under keys, by key. Keys without
+	// content are left out of the result.
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// Info describes stored content.
+type Info struct {
+	// Key is the key the content is stored under.
+	Key string
+	// Size is the size of the content in bytes.
+	Size int64
+	// Codec is the multicodec code the content is encoded with, e.g.
+	// cid.DagCBOR. Stores keeping opaque bytes report cid.Raw.
+	Codec uint64
+}
+
+// isUnder tells whether path p is prefix or below it.
+func isUnder(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
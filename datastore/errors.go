@@ -2,4 +2,12 @@ package datastore
 
 import "errors"
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrInvalidPath   = errors.New("invalid path")
+	ErrKeyMismatch   = errors.New("tiers store content under different keys")
+	ErrNotPathLinker = errors.New("data store can't link content from paths")
+)
+
+// errCacheDropped ends the copy of content the fast tier stopped reading.
+var errCacheDropped = errors.New("cache dropped")
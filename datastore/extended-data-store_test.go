@@ -0,0 +1,176 @@
+package datastore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/bbolt"
+
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("ExtendedDataStore", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "extended-data-store")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	behaves := func(newStore func() datastore.ExtendedDataStore) {
+		var ctx context.Context
+		var store datastore.ExtendedDataStore
+		var keys []string
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			store = newStore()
+			keys = nil
+			for _, content := range []string{"one", "two", "three"} {
+				key, _, err := store.Put(ctx, []byte(content), nil)
+				Expect(err).To(BeNil())
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		})
+
+		It("Should tell whether content exists and describe it", func() {
+			key, _, err := store.Put(ctx, []byte("content"), nil)
+			Expect(err).To(BeNil())
+
+			Expect(store.Has(ctx, key)).To(BeTrue())
+			info, err := store.Stat(ctx, key)
+			Expect(err).To(BeNil())
+			Expect(info).To(Equal(datastore.Info{Key: key, Size: 7, Codec: cid.Raw}))
+
+			Expect(store.Remove(ctx, key, nil)).To(BeNil())
+			Expect(store.Has(ctx, key)).To(BeFalse())
+			_, err = store.Stat(ctx, key)
+			Expect(err).To(Equal(datastore.ErrNotFound))
+		})
+
+		It("Should list stored keys", func() {
+			var listed []string
+			for key, err := range store.List(ctx) {
+				Expect(err).To(BeNil())
+				listed = append(listed, key)
+			}
+			sort.Strings(listed)
+			Expect(listed).To(Equal(keys))
+		})
+
+		It("Should stop listing when the context is done", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			var listed []string
+			var listErr error
+			for key, err := range store.List(ctx) {
+				if err != nil {
+					listErr = err
+					break
+				}
+				listed = append(listed, key)
+				cancel()
+			}
+			Expect(listed).To(HaveLen(1))
+			Expect(listErr).To(Equal(context.Canceled))
+		})
+
+		It("Should get many keys at once, leaving out missing ones", func() {
+			missing, _, err := store.Put(ctx, []byte("missing"), nil)
+			Expect(err).To(BeNil())
+			Expect(store.Remove(ctx, missing, nil)).To(BeNil())
+
+			result, err := store.GetMany(ctx, append([]string{missing}, keys...))
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(len(keys)))
+			for _, key := range keys {
+				Expect(store.Has(ctx, key)).To(BeTrue())
+				Expect(result).To(HaveKey(key))
+			}
+		})
+
+		It("Should get copies of the content", func() {
+			result, err := store.GetMany(ctx, keys[:1])
+			Expect(err).To(BeNil())
+			content := append([]byte(nil), result[keys[0]]...)
+			result[keys[0]][0] = 'x'
+
+			result, err = store.GetMany(ctx, keys[:1])
+			Expect(err).To(BeNil())
+			Expect(result[keys[0]]).To(Equal(content))
+		})
+
+		It("Should list and unlink the paths under a prefix", func() {
+			linker, ok := store.(datastore.PathLinker)
+			Expect(ok).To(BeTrue())
+			under := func(prefix string) datastore.PathFunc {
+				return func(key string) string { return prefix + "/" + key + "/node" }
+			}
+			a, _, err := store.Put(ctx, []byte("a"), under("/addr/ns"))
+			Expect(err).To(BeNil())
+			b, _, err := store.Put(ctx, []byte("b"), under("/addr/ns"))
+			Expect(err).To(BeNil())
+			_, _, err = store.Put(ctx, []byte("c"), under("/other/ns"))
+			Expect(err).To(BeNil())
+
+			paths := func() []datastore.Link {
+				var links []datastore.Link
+				for link, err := range linker.Paths(ctx, "/addr") {
+					Expect(err).To(BeNil())
+					links = append(links, link)
+				}
+				return links
+			}
+			Expect(paths()).To(ConsistOf(
+				datastore.Link{Path: under("/addr/ns")(a), Key: a},
+				datastore.Link{Path: under("/addr/ns")(b), Key: b},
+			))
+
+			Expect(linker.Unlink(ctx, under("/addr/ns")(a))).To(BeNil())
+			Expect(paths()).To(ConsistOf(datastore.Link{Path: under("/addr/ns")(b), Key: b}))
+			Expect(store.Has(ctx, a)).To(BeTrue())
+		})
+	}
+
+	Context("Local", func() {
+		behaves(func() datastore.ExtendedDataStore {
+			return datastore.NewLocalFileStore().(datastore.ExtendedDataStore)
+		})
+	})
+
+	Context("Bolt", func() {
+		var db *bbolt.DB
+
+		AfterEach(func() {
+			_ = db.Close()
+		})
+
+		behaves(func() datastore.ExtendedDataStore {
+			var err error
+			db, err = bbolt.Open(filepath.Join(dir, "data.db"), 0600, nil)
+			Expect(err).To(BeNil())
+			store, err := datastore.NewBoltDataStore(db)
+			Expect(err).To(BeNil())
+			return store
+		})
+	})
+
+	Context("File", func() {
+		behaves(func() datastore.ExtendedDataStore {
+			store, err := datastore.NewFileDataStore(dir)
+			Expect(err).To(BeNil())
+			return store
+		})
+	})
+})
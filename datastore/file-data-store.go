@@ -0,0 +1,552 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	blobsDir = "blobs"
+	pathsDir = "paths"
+	pinsDir  = "pins"
+	tmpDir   = "tmp"
+)
+
+// FileDataStore is a DataStore keeping content as plain files under a root
+// directory, so it can be inspected with ordinary tools. Content is stored
+// under the hex encoded sha256 of its bytes, in blobs/<2 chars>/<2 chars>/<key>,
+// and the paths given on Put are symlinks to it in the paths tree. Files are
+// written to a temporary file, synced and renamed, so a crash never leaves a
+// partial blob behind. It is safe for concurrent use.
+type FileDataStore struct {
+	root string
+	mtx  sync.Mutex
+}
+
+var _ DataStore = (*FileDataStore)(nil)
+var _ Pinner = (*FileDataStore)(nil)
+var _ ExtendedDataStore = (*FileDataStore)(nil)
+var _ StreamPutter = (*FileDataStore)(nil)
+var _ PathLinker = (*FileDataStore)(nil)
+
+// NewFileDataStore creates a DataStore storing content under the directory
+// root, which is created if needed.
+func NewFileDataStore(root string) (*FileDataStore, error) {
+	for _, dir := range []string{blobsDir, pathsDir, pinsDir, tmpDir} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileDataStore{
+		root: root,
+	}, nil
+}
+
+// Put stores b under its sha256 key and, when pathFunc is given, links the
+// path it builds from the key to the content. Returns the key and the path.
+// Paths are rooted at the paths tree, as IPFS MFS paths are at the MFS root,
+// and must not leave it, otherwise ErrInvalidPath is returned.
+func (d *FileDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (string, string, error) {
+	hash := sha256.Sum256(b)
+	key := hex.EncodeToString(hash[:])
+	p := ""
+	link := ""
+	if pathFunc != nil {
+		p = pathFunc(key)
+		var err error
+		if link, err = d.linkPath(p); err != nil {
+			return "", "", err
+		}
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	blob := d.blobPath(key)
+	if _, err := os.Stat(blob); errors.Is(err, fs.ErrNotExist) {
+		if err := d.writeFile(blob, b); err != nil {
+			return "", "", err
+		}
+	} else if err != nil {
+		return "", "", err
+	}
+	return d.linkBlob(key, p, link)
+}
+
+// PutReader stores the content read from r as Put does, streaming it to a
+// temporary file while hashing it, so it is never held in memory.
+func (d *FileDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	f, err := os.CreateTemp(filepath.Join(d.root, tmpDir), "blob-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(f.Name())
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		_ = f.Close()
+		return "", "", err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", "", err
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+	p := ""
+	link := ""
+	if pathFunc != nil {
+		p = pathFunc(key)
+		if link, err = d.linkPath(p); err != nil {
+			return "", "", err
+		}
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	blob := d.blobPath(key)
+	if _, err := os.Stat(blob); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return "", "", err
+		}
+		if err := os.Rename(f.Name(), blob); err != nil {
+			return "", "", err
+		}
+		if err := syncDir(filepath.Dir(blob)); err != nil {
+			return "", "", err
+		}
+	} else if err != nil {
+		return "", "", err
+	}
+	return d.linkBlob(key, p, link)
+}
+
+// linkBlob links path p, whose symlink is link, to the blob of key, once the
+// blob is stored. Returns the key and the path.
+func (d *FileDataStore) linkBlob(key, p, link string) (string, string, error) {
+	if p == "" {
+		return key, p, nil
+	}
+	if err := d.link(link, d.blobPath(key)); err != nil {
+		return "", "", err
+	}
+	if err := d.addPathRef(key, p); err != nil {
+		return "", "", err
+	}
+	return key, p, nil
+}
+
+// Remove deletes the content stored under key, its pin and the symlinks of
+// every path given for it, besides the one pathFunc builds, if given.
+func (d *FileDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc) error {
+	if !isKey(key) {
+		return ErrNotFound
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	paths, err := d.pathRefs(key)
+	if err != nil {
+		return err
+	}
+	if pathFunc != nil {
+		paths = append(paths, pathFunc(key))
+	}
+	blob := d.blobPath(key)
+	for _, p := range paths {
+		link, err := d.linkPath(p)
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(link)
+		if err != nil || filepath.Base(target) != key {
+			continue
+		}
+		if err := removeFile(link); err != nil {
+			return err
+		}
+	}
+	for _, f := range []string{blob + ".paths", filepath.Join(d.root, pinsDir, key), blob} {
+		if err := removeFile(f); err != nil {
+			return err
+		}
+	}
+	return syncDir(filepath.Dir(blob))
+}
+
+// Get returns a reader over the content stored under key, or ErrNotFound.
+// Content is streamed from its file, which is closed once read to the end, or
+// by Close, as the reader is an io.ReadCloser.
+func (d *FileDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	if !isKey(key) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(d.blobPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileReader{f: f}, nil
+}
+
+// ResolvePath returns the key of the content linked from path p, or
+// ErrNotFound.
+func (d *FileDataStore) ResolvePath(ctx context.Context, p string) (string, error) {
+	link, err := d.linkPath(p)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(link)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+func (d *FileDataStore) Pin(ctx context.Context, key string) error {
+	if !isKey(key) {
+		return ErrNotFound
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, err := os.Stat(d.blobPath(key)); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return d.writeFile(filepath.Join(d.root, pinsDir, key), nil)
+}
+
+func (d *FileDataStore) Unpin(ctx context.Context, key string) error {
+	if !isKey(key) {
+		return nil
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return removeFile(filepath.Join(d.root, pinsDir, key))
+}
+
+func (d *FileDataStore) Pins(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(d.root, pinsDir))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Name())
+	}
+	return keys, nil
+}
+
+func (d *FileDataStore) Size(ctx context.Context, key string) (int64, error) {
+	if !isKey(key) {
+		return 0, ErrNotFound
+	}
+	info, err := os.Stat(d.blobPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d *FileDataStore) Has(ctx context.Context, key string) (bool, error) {
+	_, err := d.Size(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *FileDataStore) Stat(ctx context.Context, key string) (Info, error) {
+	size, err := d.Size(ctx, key)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: size, Codec: cid.Raw}, nil
+}
+
+// List yields the keys of the stored content, walking the blobs tree in
+// lexical order.
+func (d *FileDataStore) List(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		err := filepath.WalkDir(filepath.Join(d.root, blobsDir), func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if entry.IsDir() || !isKey(entry.Name()) {
+				return nil
+			}
+			if !yield(entry.Name(), nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// Paths yields the symlinks of the paths tree at prefix or below it.
+func (d *FileDataStore) Paths(ctx context.Context, prefix string) iter.Seq2[Link, error] {
+	return func(yield func(Link, error) bool) {
+		dir, err := d.linkPath(prefix)
+		if err != nil {
+			yield(Link{}, err)
+			return
+		}
+		prefix = strings.TrimSuffix(prefix, "/")
+		err = filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && name == dir {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if entry.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			target, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return err
+			}
+			p := prefix
+			if rel != "." {
+				p += "/" + filepath.ToSlash(rel)
+			}
+			if !yield(Link{Path: p, Key: filepath.Base(target)}, nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			yield(Link{}, err)
+		}
+	}
+}
+
+// Unlink removes the symlink of path and the directories of the paths tree it
+// leaves empty.
+func (d *FileDataStore) Unlink(ctx context.Context, path string) error {
+	link, err := d.linkPath(path)
+	if err != nil {
+		return err
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if err := removeFile(link); err != nil {
+		return err
+	}
+	root := filepath.Join(d.root, pathsDir)
+	for dir := filepath.Dir(link); dir != root; dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (d *FileDataStore) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !isKey(key) {
+			continue
+		}
+		b, err := os.ReadFile(d.blobPath(key))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = b
+	}
+	return result, nil
+}
+
+func (d *FileDataStore) blobPath(key string) string {
+	return filepath.Join(d.root, blobsDir, key[:2], key[2:4], key)
+}
+
+// writeFile atomically replaces name with a file holding b: b is written to
+// a temporary file, synced, and renamed over name, whose directory is synced
+// last so the rename itself is durable.
+func (d *FileDataStore) writeFile(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Join(d.root, tmpDir), "blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// linkPath returns the name of the symlink of path p in the paths tree.
+func (d *FileDataStore) linkPath(p string) (string, error) {
+	rel := strings.TrimLeft(filepath.FromSlash(p), string(filepath.Separator))
+	if !filepath.IsLocal(rel) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(d.root, pathsDir, rel), nil
+}
+
+// link atomically points the symlink name to blob.
+func (d *FileDataStore) link(name, blob string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	target, err := filepath.Rel(filepath.Dir(name), blob)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Join(d.root, tmpDir), "link-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	tmpLink := filepath.Join(tmp, "link")
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpLink, name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// addPathRef records p in the list of paths given for key, which Remove uses
+// to find the symlinks to delete.
+func (d *FileDataStore) addPathRef(key, p string) error {
+	paths, err := d.pathRefs(key)
+	if err != nil {
+		return err
+	}
+	for _, known := range paths {
+		if known == p {
+			return nil
+		}
+	}
+	paths = append(paths, p)
+	return d.writeFile(d.blobPath(key)+".paths", []byte(strings.Join(paths, "\n")+"\n"))
+}
+
+func (d *FileDataStore) pathRefs(key string) ([]string, error) {
+	f, err := os.Open(d.blobPath(key) + ".paths")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// isKey tells whether key is a hex encoded sha256, so it can't be used to
+// reach files outside the blobs tree.
+func isKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+func removeFile(name string) error {
+	err := os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// fileReader reads a file, closing it as soon as reading it fails or ends, so
+// readers that are not closed do not keep it open.
+type fileReader struct {
+	f   *os.File
+	err error
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.f.Read(p)
+	if err != nil {
+		r.err = err
+		_ = r.f.Close()
+	}
+	return n, err
+}
+
+func (r *fileReader) Close() error {
+	if r.err != nil {
+		return nil
+	}
+	r.err = os.ErrClosed
+	return r.f.Close()
+}
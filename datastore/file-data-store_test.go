@@ -0,0 +1,110 @@
+package datastore_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+var _ = Describe("FileDataStore", func() {
+	var ctx context.Context
+	var root string
+	var store *datastore.FileDataStore
+
+	nodePath := func(key string) string {
+		return "/addr/" + key + "/node"
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		root, err = os.MkdirTemp("", "file-data-store")
+		Expect(err).To(BeNil())
+		store, err = datastore.NewFileDataStore(root)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(root)
+	})
+
+	It("Should store content as sharded files linked from their paths", func() {
+		key, p, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(nodePath(key)))
+
+		b, err := os.ReadFile(filepath.Join(root, "blobs", key[:2], key[2:4], key))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("content"))
+		b, err = os.ReadFile(filepath.Join(root, "paths", p))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("content"))
+		entries, err := os.ReadDir(filepath.Join(root, "tmp"))
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+
+		store, err = datastore.NewFileDataStore(root)
+		Expect(err).To(BeNil())
+		r, err := store.Get(ctx, key)
+		Expect(err).To(BeNil())
+		b, err = io.ReadAll(r)
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("content"))
+		resolved, err := store.ResolvePath(ctx, p)
+		Expect(err).To(BeNil())
+		Expect(resolved).To(Equal(key))
+		size, err := store.Size(ctx, key)
+		Expect(err).To(BeNil())
+		Expect(size).To(Equal(int64(7)))
+	})
+
+	It("Should stream content read from a reader", func() {
+		key, p, err := store.PutReader(ctx, strings.NewReader("content"), nodePath)
+		Expect(err).To(BeNil())
+		expected, _, err := store.Put(ctx, []byte("content"), nil)
+		Expect(err).To(BeNil())
+		Expect(key).To(Equal(expected))
+		Expect(p).To(Equal(nodePath(key)))
+
+		b, err := os.ReadFile(filepath.Join(root, "paths", p))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("content"))
+		entries, err := os.ReadDir(filepath.Join(root, "tmp"))
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Should remove content with its paths and pin", func() {
+		key, p, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		_, other, err := store.Put(ctx, []byte("content"), func(key string) string { return "other/" + key })
+		Expect(err).To(BeNil())
+		Expect(store.Pin(ctx, key)).To(BeNil())
+		Expect(store.Pins(ctx)).To(Equal([]string{key}))
+
+		Expect(store.Remove(ctx, key, nil)).To(BeNil())
+
+		_, err = store.Get(ctx, key)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		_, err = store.ResolvePath(ctx, p)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		_, err = store.ResolvePath(ctx, other)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+		Expect(store.Pins(ctx)).To(BeEmpty())
+		Expect(store.Pin(ctx, key)).To(Equal(datastore.ErrNotFound))
+	})
+
+	It("Should NOT write outside its root", func() {
+		_, _, err := store.Put(ctx, []byte("content"), func(key string) string { return "../" + key })
+		Expect(err).To(Equal(datastore.ErrInvalidPath))
+		_, err = store.Get(ctx, "../../etc/passwd")
+		Expect(err).To(Equal(datastore.ErrNotFound))
+	})
+})
@@ -1,19 +1,28 @@
 package datastore
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"os"
 	gopath "path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ipfs/boxo/files"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 	"github.com/ipfs/boxo/mfs"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
 
 	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	mc "github.com/multiformats/go-multicodec"
 
 	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
@@ -28,6 +37,18 @@ type ipfsDataStore struct {
 
 var IpfsErrPrefix = "IpfsDataStore: "
 
+var _ BlockPutter = ipfsDataStore{}
+var _ Pinner = ipfsDataStore{}
+var _ ExtendedDataStore = ipfsDataStore{}
+var _ StreamPutter = ipfsDataStore{}
+var _ PathLinker = ipfsDataStore{}
+
+// getManyConcurrency bounds the number of blocks GetMany fetches at once.
+const getManyConcurrency = 16
+
+// getTimeout bounds how long content is searched for.
+const getTimeout = 10 * time.Second
+
 func NewIPFSDataStore(node *core.IpfsNode) (DataStore, error) {
 	// Attach the Core API to the node
 	api, err := coreapi.NewCoreAPI(node)
@@ -42,7 +63,13 @@ func NewIPFSDataStore(node *core.IpfsNode) (DataStore, error) {
 }
 
 func (d ipfsDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (string, string, error) {
-	f := files.NewBytesFile(b)
+	return d.PutReader(ctx, bytes.NewReader(b), pathFunc)
+}
+
+// PutReader adds the content read from r as a UnixFS file, which IPFS splits
+// into chunks as it reads them, so the content is never fully buffered.
+func (d ipfsDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	f := files.NewReaderFile(r)
 	bs, er := d.ipfs.Unixfs().Add(ctx, f)
 	if er != nil {
 		return "", "", fmt.Errorf(IpfsErrPrefix+"could not add block: %s", er)
@@ -50,14 +77,41 @@ func (d ipfsDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (st
 
 	fmt.Printf("Added block to IPFS with CID %s \n", bs.RootCid().String())
 
+	p, er := d.putPath(ctx, bs, pathFunc)
+	if er != nil {
+		return "", "", er
+	}
+
+	return bs.RootCid().String(), p, nil
+}
+
+// PutBlock stores b as a single raw IPLD block encoded with codec, so IPFS can
+// decode it and follow its links (e.g. ipfs dag get).
+func (d ipfsDataStore) PutBlock(ctx context.Context, b []byte, codec uint64, pathFunc PathFunc) (string, string, error) {
+	bs, er := d.ipfs.Block().Put(ctx, bytes.NewReader(b), options.Block.CidCodec(mc.Code(codec).String()))
+	if er != nil {
+		return "", "", fmt.Errorf(IpfsErrPrefix+"could not put block: %s", er)
+	}
+
+	c := bs.Path().RootCid()
+
+	p, er := d.putPath(ctx, bs.Path(), pathFunc)
+	if er != nil {
+		return "", "", er
+	}
+
+	return c.String(), p, nil
+}
+
+func (d ipfsDataStore) putPath(ctx context.Context, ph path.ImmutablePath, pathFunc PathFunc) (string, error) {
 	p := ""
 	if pathFunc != nil {
-		ipldNode, er := d.ipfs.ResolveNode(ctx, bs)
+		ipldNode, er := d.ipfs.ResolveNode(ctx, ph)
 		if er != nil {
-			return "", "", fmt.Errorf(IpfsErrPrefix+"could not resolve ipld node: %s", er)
+			return "", fmt.Errorf(IpfsErrPrefix+"could not resolve ipld node: %s", er)
 		}
 
-		p = pathFunc(bs.RootCid().String())
+		p = pathFunc(ph.RootCid().String())
 		dirtomake := gopath.Dir(p)
 
 		er = mfs.Mkdir(d.ipfsNode.FilesRoot, dirtomake, mfs.MkdirOpts{
@@ -65,16 +119,16 @@ func (d ipfsDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (st
 			Flush:     true,
 		})
 		if er != nil {
-			return "", "", fmt.Errorf(IpfsErrPrefix+"could create dir %s: %s", dirtomake, er)
+			return "", fmt.Errorf(IpfsErrPrefix+"could create dir %s: %s", dirtomake, er)
 		}
 
 		er = mfs.PutNode(d.ipfsNode.FilesRoot, p, ipldNode)
 		if er != nil {
-			return "", "", fmt.Errorf(IpfsErrPrefix+"could add node %s to path %s: %s", bs.RootCid().String(), p, er)
+			return "", fmt.Errorf(IpfsErrPrefix+"could add node %s to path %s: %s", ph.RootCid().String(), p, er)
 		}
 	}
 
-	return bs.RootCid().String(), p, nil
+	return p, nil
 }
 
 func (d ipfsDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc) error {
@@ -94,19 +148,46 @@ func (d ipfsDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc
 }
 
 func (d ipfsDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel() // releases resources if slowOperation completes before timeout elapses
+	r, er := d.get(ctx, key)
+	if errors.Is(er, context.DeadlineExceeded) {
+		// consider not found
+		return nil, ErrNotFound
+	}
+	return r, er
+}
 
+// get fetches the content stored under key, giving up after getTimeout with
+// an error wrapping context.DeadlineExceeded. UnixFS content is read lazily,
+// so only finding it is bounded by getTimeout: the returned reader reads
+// under ctx until it is read to the end, fails or is closed.
+func (d ipfsDataStore) get(ctx context.Context, key string) (io.Reader, error) {
 	c, er := cid.Parse(key)
 	if er != nil {
 		return nil, er
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(getTimeout, cancel)
+	r, er := d.find(ctx, key, c)
+	if !timer.Stop() {
+		cancel()
+		return nil, fmt.Errorf(IpfsErrPrefix+"could not get %s in time: %w", key, context.DeadlineExceeded)
+	}
+	if er != nil {
+		cancel()
+		return nil, er
+	}
+	return &cancelReader{r: r, cancel: cancel}, nil
+}
+
+func (d ipfsDataStore) find(ctx context.Context, key string, c cid.Cid) (io.Reader, error) {
 	p := path.FromCid(c)
+	if c.Type() != cid.DagProtobuf && c.Type() != cid.Raw {
+		return d.getBlock(ctx, key, p)
+	}
 	node, er := d.ipfs.Unixfs().Get(ctx, p)
 	if er != nil {
 		if errors.Is(er, context.DeadlineExceeded) {
-			// consider not found
-			return nil, ErrNotFound
+			return nil, fmt.Errorf(IpfsErrPrefix+"could not get %s in time: %w", key, context.DeadlineExceeded)
 		}
 		return nil, fmt.Errorf(IpfsErrPrefix+"could not Unixfs.Get data with CID: %s %s", key, er)
 	}
@@ -118,3 +199,322 @@ func (d ipfsDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
 
 	return reader, nil
 }
+
+func (d ipfsDataStore) getBlock(ctx context.Context, key string, p path.ImmutablePath) (io.Reader, error) {
+	r, er := d.ipfs.Block().Get(ctx, p)
+	if er != nil {
+		if errors.Is(er, context.DeadlineExceeded) {
+			return nil, fmt.Errorf(IpfsErrPrefix+"could not get %s in time: %w", key, context.DeadlineExceeded)
+		}
+		return nil, fmt.Errorf(IpfsErrPrefix+"could not Block.Get data with CID: %s %s", key, er)
+	}
+	return r, nil
+}
+
+// Pin pins the content stored under key. UnixFS content is pinned recursively,
+// so all its blocks are kept; nodes are pinned directly, as pinning them
+// recursively would pin, through their links, the whole chain before them.
+func (d ipfsDataStore) Pin(ctx context.Context, key string) error {
+	c, er := cid.Parse(key)
+	if er != nil {
+		return er
+	}
+	recursive := c.Type() == cid.DagProtobuf || c.Type() == cid.Raw
+	er = d.ipfs.Pin().Add(ctx, path.FromCid(c), options.Pin.Recursive(recursive))
+	if er != nil {
+		return fmt.Errorf(IpfsErrPrefix+"could not pin %s: %s", key, er)
+	}
+	return nil
+}
+
+func (d ipfsDataStore) Unpin(ctx context.Context, key string) error {
+	c, er := cid.Parse(key)
+	if er != nil {
+		return er
+	}
+	er = d.ipfs.Pin().Rm(ctx, path.FromCid(c))
+	if er != nil {
+		return fmt.Errorf(IpfsErrPrefix+"could not unpin %s: %s", key, er)
+	}
+	return nil
+}
+
+func (d ipfsDataStore) Pins(ctx context.Context) ([]string, error) {
+	var keys []string
+	for _, pinType := range []options.PinLsOption{options.Pin.Ls.Recursive(), options.Pin.Ls.Direct()} {
+		ch := make(chan icore.Pin)
+		done := make(chan error, 1)
+		go func() {
+			done <- d.ipfs.Pin().Ls(ctx, ch, pinType)
+		}()
+		for p := range ch {
+			keys = append(keys, p.Path().RootCid().String())
+		}
+		if er := <-done; er != nil {
+			return nil, fmt.Errorf(IpfsErrPrefix+"could not list pins: %s", er)
+		}
+	}
+	return keys, nil
+}
+
+// Size returns the size of the content stored under key. UnixFS content is
+// pinned recursively, so its size is the cumulative size of its DAG; the size
+// of a node is the size of its block, as its links are pinned on their own.
+func (d ipfsDataStore) Size(ctx context.Context, key string) (int64, error) {
+	c, er := cid.Parse(key)
+	if er != nil {
+		return 0, er
+	}
+	if c.Type() == cid.DagProtobuf {
+		node, er := d.ipfs.ResolveNode(ctx, path.FromCid(c))
+		if er != nil {
+			return 0, fmt.Errorf(IpfsErrPrefix+"could not stat %s: %s", key, er)
+		}
+		size, er := node.Size()
+		if er != nil {
+			return 0, fmt.Errorf(IpfsErrPrefix+"could not stat %s: %s", key, er)
+		}
+		return int64(size), nil
+	}
+	st, er := d.ipfs.Block().Stat(ctx, path.FromCid(c))
+	if er != nil {
+		return 0, fmt.Errorf(IpfsErrPrefix+"could not stat %s: %s", key, er)
+	}
+	return int64(st.Size()), nil
+}
+
+// Paths yields the MFS entries at prefix or below it that are not
+// directories, with the CID they link to.
+func (d ipfsDataStore) Paths(ctx context.Context, prefix string) iter.Seq2[Link, error] {
+	return func(yield func(Link, error) bool) {
+		prefix = strings.TrimSuffix(prefix, "/")
+		fsn, er := mfs.Lookup(d.ipfsNode.FilesRoot, prefix)
+		if errors.Is(er, os.ErrNotExist) {
+			return
+		}
+		if er != nil {
+			yield(Link{}, fmt.Errorf(IpfsErrPrefix+"could not look up %s: %s", prefix, er))
+			return
+		}
+		node, er := fsn.GetNode()
+		if er != nil {
+			yield(Link{}, fmt.Errorf(IpfsErrPrefix+"could not look up %s: %s", prefix, er))
+			return
+		}
+		_ = d.walkPaths(ctx, prefix, node, yield)
+	}
+}
+
+// walkPaths yields the entries of the MFS tree rooted at node, linked at p.
+// Returns false once iteration must stop.
+func (d ipfsDataStore) walkPaths(ctx context.Context, p string, node ipld.Node, yield func(Link, error) bool) bool {
+	dir, er := uio.NewDirectoryFromNode(d.ipfsNode.DAG, node)
+	if errors.Is(er, uio.ErrNotADir) {
+		return yield(Link{Path: p, Key: node.Cid().String()}, nil)
+	}
+	if er != nil {
+		yield(Link{}, fmt.Errorf(IpfsErrPrefix+"could not list %s: %s", p, er))
+		return false
+	}
+	var links []*ipld.Link
+	er = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		links = append(links, l)
+		return nil
+	})
+	if er != nil {
+		yield(Link{}, fmt.Errorf(IpfsErrPrefix+"could not list %s: %s", p, er))
+		return false
+	}
+	for _, l := range links {
+		if er := ctx.Err(); er != nil {
+			yield(Link{}, er)
+			return false
+		}
+		child := p + "/" + l.Name
+		if l.Cid.Type() != cid.DagProtobuf {
+			if !yield(Link{Path: child, Key: l.Cid.String()}, nil) {
+				return false
+			}
+			continue
+		}
+		node, er := d.ipfsNode.DAG.Get(ctx, l.Cid)
+		if er != nil {
+			yield(Link{}, fmt.Errorf(IpfsErrPrefix+"could not list %s: %s", child, er))
+			return false
+		}
+		if !d.walkPaths(ctx, child, node, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unlink removes the MFS entry at p, and the directories it leaves empty. The
+// content is kept until it is garbage collected.
+func (d ipfsDataStore) Unlink(ctx context.Context, p string) error {
+	for p = strings.TrimSuffix(p, "/"); p != "" && p != "/"; p = gopath.Dir(p) {
+		parent, er := mfs.Lookup(d.ipfsNode.FilesRoot, gopath.Dir(p))
+		if errors.Is(er, os.ErrNotExist) {
+			return nil
+		}
+		if er != nil {
+			return fmt.Errorf(IpfsErrPrefix+"could not look up %s: %s", gopath.Dir(p), er)
+		}
+		dir, ok := parent.(*mfs.Directory)
+		if !ok {
+			return fmt.Errorf(IpfsErrPrefix+"not a directory: %s", gopath.Dir(p))
+		}
+		er = dir.Unlink(gopath.Base(p))
+		if er != nil && !errors.Is(er, os.ErrNotExist) {
+			return fmt.Errorf(IpfsErrPrefix+"could not unlink %s: %s", p, er)
+		}
+		if er := dir.Flush(); er != nil {
+			return fmt.Errorf(IpfsErrPrefix+"could not unlink %s: %s", p, er)
+		}
+		names, er := dir.ListNames(ctx)
+		if er != nil {
+			return fmt.Errorf(IpfsErrPrefix+"could not list %s: %s", gopath.Dir(p), er)
+		}
+		if len(names) > 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Has tells whether the root block of key is in the local blockstore, without
+// asking the network for it.
+func (d ipfsDataStore) Has(ctx context.Context, key string) (bool, error) {
+	c, er := cid.Parse(key)
+	if er != nil {
+		return false, er
+	}
+	found, er := d.ipfsNode.Blockstore.Has(ctx, c)
+	if er != nil {
+		return false, fmt.Errorf(IpfsErrPrefix+"could not check %s: %s", key, er)
+	}
+	return found, nil
+}
+
+// Stat describes the content stored under key, which must be available
+// locally. The size of UnixFS content is the size of the file it holds, the
+// size of other content the size of its block.
+func (d ipfsDataStore) Stat(ctx context.Context, key string) (Info, error) {
+	found, er := d.Has(ctx, key)
+	if er != nil {
+		return Info{}, er
+	}
+	if !found {
+		return Info{}, ErrNotFound
+	}
+	c, _ := cid.Parse(key)
+	info := Info{Key: key, Codec: c.Type()}
+	if c.Type() == cid.DagProtobuf || c.Type() == cid.Raw {
+		node, er := d.ipfs.Unixfs().Get(ctx, path.FromCid(c))
+		if er != nil {
+			return Info{}, fmt.Errorf(IpfsErrPrefix+"could not stat %s: %s", key, er)
+		}
+		defer node.Close()
+		info.Size, er = node.Size()
+		if er != nil {
+			return Info{}, fmt.Errorf(IpfsErrPrefix+"could not stat %s: %s", key, er)
+		}
+		return info, nil
+	}
+	info.Size, er = d.Size(ctx, key)
+	if er != nil {
+		return Info{}, er
+	}
+	return info, nil
+}
+
+// List yields the keys of every block in the local blockstore, including the
+// inner blocks of UnixFS content.
+func (d ipfsDataStore) List(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		keys, er := d.ipfsNode.Blockstore.AllKeysChan(ctx)
+		if er != nil {
+			yield("", fmt.Errorf(IpfsErrPrefix+"could not list blocks: %s", er))
+			return
+		}
+		for c := range keys {
+			if !yield(c.String(), nil) {
+				return
+			}
+		}
+		if er := ctx.Err(); er != nil {
+			yield("", er)
+		}
+	}
+}
+
+// GetMany fetches the content stored under keys concurrently. IPFS can't tell
+// missing content from content no peer provided yet, so a key that can't be
+// fetched in time fails GetMany with an error wrapping
+// context.DeadlineExceeded, instead of being left out of the result.
+func (d ipfsDataStore) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	var firstEr error
+	result := make(map[string][]byte, len(keys))
+	sem := make(chan struct{}, getManyConcurrency)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b, er := d.getBytes(ctx, key)
+			mtx.Lock()
+			defer mtx.Unlock()
+			if er != nil {
+				if firstEr == nil {
+					firstEr = er
+				}
+				return
+			}
+			result[key] = b
+		}()
+	}
+	wg.Wait()
+	if firstEr != nil {
+		return nil, firstEr
+	}
+	return result, nil
+}
+
+func (d ipfsDataStore) getBytes(ctx context.Context, key string) ([]byte, error) {
+	r, er := d.get(ctx, key)
+	if er != nil {
+		return nil, er
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return io.ReadAll(r)
+}
+
+// cancelReader reads r, cancelling the context r reads under once r is read
+// to the end, fails or is closed.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, er := r.r.Read(p)
+	if er != nil {
+		r.cancel()
+	}
+	return n, er
+}
+
+func (r *cancelReader) Close() error {
+	r.cancel()
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -6,18 +6,29 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
+	"iter"
+	"sort"
+
+	"github.com/ipfs/go-cid"
 )
 
 type localDataStore struct {
 	pairs map[string][]byte
 	paths map[string]string
+	pins  map[string]bool
 	tip   []byte
 }
 
+var _ Pinner = localDataStore{}
+var _ ExtendedDataStore = localDataStore{}
+var _ StreamPutter = localDataStore{}
+var _ PathLinker = localDataStore{}
+
 func NewLocalFileStore() DataStore {
 	return localDataStore{
 		pairs: make(map[string][]byte),
 		paths: map[string]string{},
+		pins:  map[string]bool{},
 	}
 }
 
@@ -33,6 +44,16 @@ func (d localDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (s
 	return hexHash, p, nil
 }
 
+// PutReader stores the content read from r. Content is kept in memory, so it
+// is read in full first.
+func (d localDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	return d.Put(ctx, b, pathFunc)
+}
+
 func (d localDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc) error {
 	delete(d.pairs, key)
 	return nil
@@ -45,3 +66,101 @@ func (d localDataStore) Get(ctx context.Context, key string) (io.Reader, error)
 	}
 	return bytes.NewReader(b), nil
 }
+
+func (d localDataStore) Pin(ctx context.Context, key string) error {
+	if _, ok := d.pairs[key]; !ok {
+		return ErrNotFound
+	}
+	d.pins[key] = true
+	return nil
+}
+
+func (d localDataStore) Unpin(ctx context.Context, key string) error {
+	delete(d.pins, key)
+	return nil
+}
+
+func (d localDataStore) Pins(ctx context.Context) ([]string, error) {
+	keys := make([]string, 0, len(d.pins))
+	for key := range d.pins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (d localDataStore) Size(ctx context.Context, key string) (int64, error) {
+	b, ok := d.pairs[key]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return int64(len(b)), nil
+}
+
+func (d localDataStore) Has(ctx context.Context, key string) (bool, error) {
+	_, ok := d.pairs[key]
+	return ok, nil
+}
+
+func (d localDataStore) Stat(ctx context.Context, key string) (Info, error) {
+	b, ok := d.pairs[key]
+	if !ok {
+		return Info{}, ErrNotFound
+	}
+	return Info{Key: key, Size: int64(len(b)), Codec: cid.Raw}, nil
+}
+
+func (d localDataStore) List(ctx context.Context) iter.Seq2[string, error] {
+	keys := make([]string, 0, len(d.pairs))
+	for key := range d.pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return func(yield func(string, error) bool) {
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (d localDataStore) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if b, ok := d.pairs[key]; ok {
+			result[key] = bytes.Clone(b)
+		}
+	}
+	return result, nil
+}
+
+func (d localDataStore) Paths(ctx context.Context, prefix string) iter.Seq2[Link, error] {
+	return func(yield func(Link, error) bool) {
+		paths := make([]string, 0, len(d.paths))
+		for p := range d.paths {
+			if isUnder(p, prefix) {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if err := ctx.Err(); err != nil {
+				yield(Link{}, err)
+				return
+			}
+			if !yield(Link{Path: p, Key: d.paths[p]}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (d localDataStore) Unlink(ctx context.Context, path string) error {
+	delete(d.paths, path)
+	return nil
+}
@@ -0,0 +1,650 @@
+package datastore
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+)
+
+// DefaultMaxFastSize is the default number of bytes a TieredDataStore keeps in
+// its fast tier.
+const DefaultMaxFastSize = 64 << 20
+
+// dirtyPrefix is the path, in the fast tier, under which a TieredDataStore
+// writing back records the content not yet written to the slow tier.
+const dirtyPrefix = "/.tiered/dirty"
+
+// WritePolicy tells when a TieredDataStore writes content to its slow tier.
+type WritePolicy int
+
+const (
+	// WriteThrough writes content to the slow tier on Put, then caches it in
+	// the fast tier. Keys are the ones of the slow tier.
+	WriteThrough WritePolicy = iota
+	// WriteBack writes content to the fast tier only, until Flush writes it to
+	// the slow tier. Keys are the ones of the fast tier, so both tiers must
+	// derive the same key from the same content, e.g. a BoltDataStore in front
+	// of a FileDataStore. Which content was not flushed yet is recorded in the
+	// fast tier, which must then implement PathLinker, so it is still flushed
+	// after a restart. A fast tier that does not persist, such as the one
+	// NewLocalFileStore creates, loses it, content included, on restart.
+	WriteBack
+)
+
+// TieredOption configures a TieredDataStore.
+type TieredOption func(*TieredDataStore)
+
+// WithWritePolicy sets the policy used to write content. Defaults to
+// WriteThrough.
+func WithWritePolicy(policy WritePolicy) TieredOption {
+	return func(d *TieredDataStore) {
+		d.policy = policy
+	}
+}
+
+// WithMaxFastSize sets the number of bytes kept in the fast tier, beyond which
+// the least recently used content is evicted from it. Defaults to
+// DefaultMaxFastSize.
+func WithMaxFastSize(size int64) TieredOption {
+	return func(d *TieredDataStore) {
+		d.maxFastSize = size
+	}
+}
+
+// TieredDataStore is a DataStore layering a fast store, e.g. one created with
+// NewLocalFileStore or NewBoltDataStore, in front of a slow one, e.g. an IPFS
+// store. Content read from the slow tier is kept in the fast tier, so later
+// reads of it do not reach the slow tier, until it is evicted to keep the fast
+// tier within its size. Content not yet written to the slow tier is never
+// evicted. Which content the fast tier caches is only known to the
+// TieredDataStore, so it starts with only the content not yet written to the
+// slow tier. It is safe for concurrent use when both tiers are.
+type TieredDataStore struct {
+	fast        DataStore
+	slow        DataStore
+	policy      WritePolicy
+	maxFastSize int64
+
+	mtx      sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	fastRefs map[string]int
+	fastSize int64
+}
+
+type tieredEntry struct {
+	key     string
+	fastKey string
+	size    int64
+	// dirty entries are only stored in the fast tier. They are written to the
+	// slow tier under the paths of their record, as a block of codec when it
+	// is not zero.
+	dirty     bool
+	record    dirtyRecord
+	recordKey string
+}
+
+// dirtyRecord describes content not yet written to the slow tier. It is kept
+// in the fast tier, linked from a path under dirtyPrefix.
+type dirtyRecord struct {
+	Key   string   `json:"key"`
+	Paths []string `json:"paths,omitempty"`
+	Codec uint64   `json:"codec,omitempty"`
+	Size  int64    `json:"size"`
+}
+
+var _ DataStore = (*TieredDataStore)(nil)
+var _ BlockPutter = (*TieredDataStore)(nil)
+var _ StreamPutter = (*TieredDataStore)(nil)
+
+// NewTieredDataStore creates a DataStore caching the content of slow in fast.
+// When writing back, the content the fast tier holds that was not written to
+// the slow tier yet is loaded, to be flushed, and ErrNotPathLinker is returned
+// if the fast tier can't record it.
+func NewTieredDataStore(fast, slow DataStore, options ...TieredOption) (*TieredDataStore, error) {
+	d := &TieredDataStore{
+		fast:        fast,
+		slow:        slow,
+		policy:      WriteThrough,
+		maxFastSize: DefaultMaxFastSize,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		fastRefs:    make(map[string]int),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.policy != WriteBack {
+		return d, nil
+	}
+	if _, ok := fast.(PathLinker); !ok {
+		return nil, ErrNotPathLinker
+	}
+	if err := d.loadDirty(context.Background()); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Put stores b according to the write policy. Returns the key and the path.
+func (d *TieredDataStore) Put(ctx context.Context, b []byte, pathFunc PathFunc) (string, string, error) {
+	if d.policy == WriteBack {
+		return d.putBack(ctx, b, pathFunc, 0)
+	}
+	key, p, err := d.slow.Put(ctx, b, pathFunc)
+	if err != nil {
+		return "", "", err
+	}
+	d.cache(ctx, key, b)
+	return key, p, nil
+}
+
+// PutBlock stores b as a block of codec when the slow tier supports it, and as
+// Put does otherwise.
+func (d *TieredDataStore) PutBlock(ctx context.Context, b []byte, codec uint64, pathFunc PathFunc) (string, string, error) {
+	if d.policy == WriteBack {
+		return d.putBack(ctx, b, pathFunc, codec)
+	}
+	key, p, err := d.putSlow(ctx, b, pathFunc, codec)
+	if err != nil {
+		return "", "", err
+	}
+	d.cache(ctx, key, b)
+	return key, p, nil
+}
+
+// Remove deletes the content stored under key from both tiers. pathFunc is
+// only used by the slow tier.
+func (d *TieredDataStore) Remove(ctx context.Context, key string, pathFunc PathFunc) error {
+	d.mtx.Lock()
+	var entry tieredEntry
+	var err error
+	if e, found := d.entries[key]; found {
+		entry = *e.Value.(*tieredEntry)
+		err = d.remove(ctx, e)
+	}
+	d.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+	if entry.dirty {
+		return d.forgetDirty(ctx, entry)
+	}
+	return d.slow.Remove(ctx, key, pathFunc)
+}
+
+// Get returns a reader over the content stored under key, reading it from the
+// fast tier when cached there, and from the slow tier otherwise, caching it.
+// Neither tier is read while holding the lock, so reads run concurrently.
+func (d *TieredDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	d.mtx.Lock()
+	e, found := d.entries[key]
+	var entry tieredEntry
+	if found {
+		d.order.MoveToFront(e)
+		entry = *e.Value.(*tieredEntry)
+	}
+	d.mtx.Unlock()
+
+	if found {
+		r, err := d.fast.Get(ctx, entry.fastKey)
+		if err == nil || entry.dirty {
+			return r, err
+		}
+		// The fast tier lost the content, read it again from the slow tier.
+		d.mtx.Lock()
+		if current, found := d.entries[key]; found && current == e {
+			_ = d.remove(ctx, e)
+		}
+		d.mtx.Unlock()
+	}
+
+	r, err := d.slow.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if sp, ok := d.fast.(StreamPutter); ok {
+		return d.cacheReader(ctx, key, r, sp)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d.cache(ctx, key, b)
+	return bytes.NewReader(b), nil
+}
+
+// PutReader stores the content read from r according to the write policy, as
+// Put does. Content is streamed to the tiers supporting it (see StreamPutter)
+// and, when writing through, to both tiers at once, so it is not held in
+// memory.
+func (d *TieredDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	if d.policy == WriteBack {
+		return d.putBackReader(ctx, r, pathFunc)
+	}
+	sp, ok := d.slow.(StreamPutter)
+	if !ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", "", err
+		}
+		return d.Put(ctx, b, pathFunc)
+	}
+	fsp, ok := d.fast.(StreamPutter)
+	if !ok {
+		return sp.PutReader(ctx, r, pathFunc)
+	}
+
+	// The fast tier reads a copy of what the slow tier reads. Failing to cache
+	// the content is not an error, so the copy is dropped if the fast tier
+	// stops reading it.
+	pr, pw := io.Pipe()
+	type cached struct {
+		key string
+		err error
+	}
+	done := make(chan cached, 1)
+	go func() {
+		key, _, err := fsp.PutReader(ctx, pr, nil)
+		_ = pr.CloseWithError(errCacheDropped)
+		done <- cached{key, err}
+	}()
+	counter := &countingReader{r: r}
+	key, p, err := sp.PutReader(ctx, io.TeeReader(counter, &dropWriter{w: pw}), pathFunc)
+	_ = pw.CloseWithError(err)
+	c := <-done
+	if err != nil {
+		return "", "", err
+	}
+	if c.err == nil {
+		d.register(ctx, key, c.key, counter.n)
+	}
+	return key, p, nil
+}
+
+// Flush writes the content stored in the fast tier only to the slow tier,
+// oldest first. Returns ErrKeyMismatch when the slow tier stores content under
+// another key than the fast tier does. Flushed content can then be evicted.
+func (d *TieredDataStore) Flush(ctx context.Context) error {
+	d.mtx.Lock()
+	var dirty []tieredEntry
+	for e := d.order.Back(); e != nil; e = e.Prev() {
+		if entry := e.Value.(*tieredEntry); entry.dirty {
+			dirty = append(dirty, *entry)
+		}
+	}
+	d.mtx.Unlock()
+
+	for _, entry := range dirty {
+		key, err := d.flushEntry(ctx, entry)
+		if err != nil {
+			return err
+		}
+		if key != entry.key {
+			return ErrKeyMismatch
+		}
+		// Content linked at another path meanwhile is flushed next time.
+		d.mtx.Lock()
+		e, found := d.entries[entry.key]
+		flushed := found && e.Value.(*tieredEntry).recordKey == entry.recordKey
+		if flushed {
+			e.Value.(*tieredEntry).dirty = false
+		}
+		d.mtx.Unlock()
+		if !flushed {
+			continue
+		}
+		if err := d.forgetDirty(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.evict(ctx)
+	return nil
+}
+
+// flushEntry writes the content of entry to the slow tier, once for each of
+// its paths. Returns the key the slow tier stored it under.
+func (d *TieredDataStore) flushEntry(ctx context.Context, entry tieredEntry) (string, error) {
+	if len(entry.record.Paths) == 0 {
+		return d.writeSlow(ctx, entry.fastKey, nil, entry.record.Codec)
+	}
+	key := ""
+	for _, p := range entry.record.Paths {
+		var err error
+		key, err = d.writeSlow(ctx, entry.fastKey, pathAt(p), entry.record.Codec)
+		if err != nil || key != entry.key {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// writeSlow writes the content stored in the fast tier under fastKey to the
+// slow tier, with pathFunc, streaming it when the slow tier supports it.
+// Returns the key the slow tier stored it under.
+func (d *TieredDataStore) writeSlow(ctx context.Context, fastKey string, pathFunc PathFunc, codec uint64) (string, error) {
+	r, err := d.fast.Get(ctx, fastKey)
+	if err != nil {
+		return "", err
+	}
+	if sp, ok := d.slow.(StreamPutter); ok && codec == 0 {
+		key, _, err := sp.PutReader(ctx, r, pathFunc)
+		return key, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	key, _, err := d.putSlow(ctx, b, pathFunc, codec)
+	return key, err
+}
+
+func (d *TieredDataStore) putBack(ctx context.Context, b []byte, pathFunc PathFunc, codec uint64) (string, string, error) {
+	key, _, err := d.fast.Put(ctx, b, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return d.markDirty(ctx, key, pathFunc, codec, int64(len(b)))
+}
+
+// putBackReader writes the content read from r back, streaming it to the fast
+// tier when it supports it.
+func (d *TieredDataStore) putBackReader(ctx context.Context, r io.Reader, pathFunc PathFunc) (string, string, error) {
+	sp, ok := d.fast.(StreamPutter)
+	if !ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", "", err
+		}
+		return d.putBack(ctx, b, pathFunc, 0)
+	}
+	counter := &countingReader{r: r}
+	key, _, err := sp.PutReader(ctx, counter, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return d.markDirty(ctx, key, pathFunc, 0, counter.n)
+}
+
+// markDirty records that the content stored in the fast tier under key must
+// be written to the slow tier, with pathFunc, as a block of codec when it is
+// not zero. Content already stored keeps its paths: a new path is added to
+// the record of content not written to the slow tier yet, and linked in the
+// slow tier right away otherwise. Returns the key and the path.
+func (d *TieredDataStore) markDirty(ctx context.Context, key string, pathFunc PathFunc, codec uint64, size int64) (string, string, error) {
+	p := ""
+	if pathFunc != nil {
+		p = pathFunc(key)
+	}
+	for {
+		d.mtx.Lock()
+		var entry tieredEntry
+		e, found := d.entries[key]
+		if found {
+			d.order.MoveToFront(e)
+			entry = *e.Value.(*tieredEntry)
+		}
+		d.mtx.Unlock()
+
+		switch {
+		case found && (p == "" || slices.Contains(entry.record.Paths, p)):
+			return key, p, nil
+		case found && !entry.dirty:
+			if _, err := d.writeSlow(ctx, key, pathFunc, codec); err != nil {
+				return "", "", err
+			}
+			return key, p, nil
+		}
+
+		record := dirtyRecord{Key: key, Codec: codec, Size: size}
+		if found {
+			record = entry.record
+			record.Paths = slices.Clone(record.Paths)
+		}
+		if p != "" {
+			record.Paths = append(record.Paths, p)
+		}
+		recordKey, err := d.recordDirty(ctx, record)
+		if err != nil {
+			return "", "", err
+		}
+
+		d.mtx.Lock()
+		current, stillFound := d.entries[key]
+		switch {
+		case !found && !stillFound:
+			d.add(&tieredEntry{
+				key:       key,
+				fastKey:   key,
+				size:      record.Size,
+				dirty:     true,
+				record:    record,
+				recordKey: recordKey,
+			})
+			d.evict(ctx)
+			d.mtx.Unlock()
+			return key, p, nil
+		case found && stillFound && current == e && e.Value.(*tieredEntry).dirty &&
+			e.Value.(*tieredEntry).recordKey == entry.recordKey:
+			e.Value.(*tieredEntry).record = record
+			e.Value.(*tieredEntry).recordKey = recordKey
+			d.mtx.Unlock()
+			// Failing to remove the replaced record only leaves it stored.
+			_ = d.fast.Remove(ctx, entry.recordKey, nil)
+			return key, p, nil
+		}
+		d.mtx.Unlock()
+		// The entry changed meanwhile, e.g. it was flushed: try again.
+	}
+}
+
+// recordDirty records in the fast tier that the content of record was not
+// written to the slow tier yet. Returns the key of the record.
+func (d *TieredDataStore) recordDirty(ctx context.Context, record dirtyRecord) (string, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	key, _, err := d.fast.Put(ctx, data, func(string) string {
+		return dirtyPath(record.Key)
+	})
+	return key, err
+}
+
+// forgetDirty removes the record of the content of entry, once it is written
+// to the slow tier or removed.
+func (d *TieredDataStore) forgetDirty(ctx context.Context, entry tieredEntry) error {
+	err := d.fast.(PathLinker).Unlink(ctx, dirtyPath(entry.key))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	err = d.fast.Remove(ctx, entry.recordKey, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// loadDirty adds the content the fast tier holds that was not written to the
+// slow tier yet, as recorded before a restart.
+func (d *TieredDataStore) loadDirty(ctx context.Context) error {
+	for link, err := range d.fast.(PathLinker).Paths(ctx, dirtyPrefix) {
+		if err != nil {
+			return err
+		}
+		r, err := d.fast.Get(ctx, link.Key)
+		if err != nil {
+			return err
+		}
+		var record dirtyRecord
+		if err := json.NewDecoder(r).Decode(&record); err != nil {
+			return err
+		}
+		if _, found := d.entries[record.Key]; found {
+			continue
+		}
+		d.add(&tieredEntry{
+			key:       record.Key,
+			fastKey:   record.Key,
+			size:      record.Size,
+			dirty:     true,
+			record:    record,
+			recordKey: link.Key,
+		})
+	}
+	return nil
+}
+
+func (d *TieredDataStore) putSlow(ctx context.Context, b []byte, pathFunc PathFunc, codec uint64) (string, string, error) {
+	if bp, ok := d.slow.(BlockPutter); ok && codec != 0 {
+		return bp.PutBlock(ctx, b, codec, pathFunc)
+	}
+	return d.slow.Put(ctx, b, pathFunc)
+}
+
+// cache stores b, the content of the slow tier under key, in the fast tier.
+// Failing to do so is not an error: the content is read from the slow tier
+// again next time.
+func (d *TieredDataStore) cache(ctx context.Context, key string, b []byte) {
+	if int64(len(b)) > d.maxFastSize {
+		return
+	}
+	d.mtx.Lock()
+	if e, found := d.entries[key]; found {
+		d.order.MoveToFront(e)
+		d.mtx.Unlock()
+		return
+	}
+	d.mtx.Unlock()
+
+	fastKey, _, err := d.fast.Put(ctx, b, nil)
+	if err != nil {
+		return
+	}
+	d.register(ctx, key, fastKey, int64(len(b)))
+}
+
+// cacheReader streams r, the content of the slow tier under key, to the fast
+// tier, and returns a reader over the copy. If the fast tier fails to store
+// it, the content is read from the slow tier again, without caching it.
+func (d *TieredDataStore) cacheReader(ctx context.Context, key string, r io.Reader, sp StreamPutter) (io.Reader, error) {
+	counter := &countingReader{r: r}
+	fastKey, _, err := sp.PutReader(ctx, counter, nil)
+	if err != nil {
+		return d.slow.Get(ctx, key)
+	}
+	fr, err := d.fast.Get(ctx, fastKey)
+	if err != nil {
+		return d.slow.Get(ctx, key)
+	}
+	d.register(ctx, key, fastKey, counter.n)
+	return fr, nil
+}
+
+// register records that the fast tier caches the content of the slow tier
+// under key, stored under fastKey. Content larger than the fast tier is
+// removed from it instead, unless other entries share it.
+func (d *TieredDataStore) register(ctx context.Context, key, fastKey string, size int64) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if size > d.maxFastSize {
+		if d.fastRefs[fastKey] == 0 {
+			_ = d.fast.Remove(ctx, fastKey, nil)
+		}
+		return
+	}
+	if _, found := d.entries[key]; found {
+		return
+	}
+	d.add(&tieredEntry{
+		key:     key,
+		fastKey: fastKey,
+		size:    size,
+	})
+	d.evict(ctx)
+}
+
+func (d *TieredDataStore) add(entry *tieredEntry) {
+	d.entries[entry.key] = d.order.PushFront(entry)
+	if d.fastRefs[entry.fastKey] == 0 {
+		d.fastSize += entry.size
+	}
+	d.fastRefs[entry.fastKey]++
+}
+
+// remove forgets e, deleting its content from the fast tier unless other
+// entries share it.
+func (d *TieredDataStore) remove(ctx context.Context, e *list.Element) error {
+	entry := e.Value.(*tieredEntry)
+	d.order.Remove(e)
+	delete(d.entries, entry.key)
+	d.fastRefs[entry.fastKey]--
+	if d.fastRefs[entry.fastKey] > 0 {
+		return nil
+	}
+	delete(d.fastRefs, entry.fastKey)
+	d.fastSize -= entry.size
+	err := d.fast.Remove(ctx, entry.fastKey, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// evict removes the least recently used content written to the slow tier from
+// the fast tier, until the fast tier is within its size.
+func (d *TieredDataStore) evict(ctx context.Context) {
+	e := d.order.Back()
+	for e != nil && d.fastSize > d.maxFastSize {
+		prev := e.Prev()
+		if !e.Value.(*tieredEntry).dirty {
+			_ = d.remove(ctx, e)
+		}
+		e = prev
+	}
+}
+
+// pathAt returns the PathFunc writing content under path p.
+func pathAt(p string) PathFunc {
+	return func(string) string {
+		return p
+	}
+}
+
+func dirtyPath(key string) string {
+	return dirtyPrefix + "/" + key
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// dropWriter writes to w until a write fails, and then drops what it is
+// given, so a failing copy does not fail the write it is taken from.
+type dropWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dropWriter) Write(p []byte) (int, error) {
+	if d.err == nil {
+		_, d.err = d.w.Write(p)
+	}
+	return len(p), nil
+}
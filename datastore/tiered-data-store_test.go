@@ -0,0 +1,258 @@
+package datastore_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/bbolt"
+
+	"github.com/msaldanha/setinstone/datastore"
+)
+
+// countingDataStore counts the calls reaching the data store it wraps.
+type countingDataStore struct {
+	datastore.DataStore
+	mtx     sync.Mutex
+	puts    int
+	streams int
+	gets    int
+}
+
+func (d *countingDataStore) Put(ctx context.Context, b []byte, pathFunc datastore.PathFunc) (string, string, error) {
+	d.mtx.Lock()
+	d.puts++
+	d.mtx.Unlock()
+	return d.DataStore.Put(ctx, b, pathFunc)
+}
+
+func (d *countingDataStore) PutReader(ctx context.Context, r io.Reader, pathFunc datastore.PathFunc) (string, string, error) {
+	d.mtx.Lock()
+	d.streams++
+	d.mtx.Unlock()
+	return d.DataStore.(datastore.StreamPutter).PutReader(ctx, r, pathFunc)
+}
+
+func (d *countingDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	d.mtx.Lock()
+	d.gets++
+	d.mtx.Unlock()
+	return d.DataStore.Get(ctx, key)
+}
+
+var _ = Describe("TieredDataStore", func() {
+	var ctx context.Context
+	var fast datastore.ExtendedDataStore
+	var slow *countingDataStore
+
+	read := func(store datastore.DataStore, key string) string {
+		r, err := store.Get(ctx, key)
+		Expect(err).To(BeNil())
+		b, err := io.ReadAll(r)
+		Expect(err).To(BeNil())
+		return string(b)
+	}
+
+	nodePath := func(key string) string {
+		return "/addr/" + key + "/node"
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fast = datastore.NewLocalFileStore().(datastore.ExtendedDataStore)
+		slow = &countingDataStore{DataStore: datastore.NewLocalFileStore()}
+	})
+
+	It("Should read through the slow tier once", func() {
+		key, _, err := slow.Put(ctx, []byte("content"), nil)
+		Expect(err).To(BeNil())
+		store, err := datastore.NewTieredDataStore(fast, slow)
+		Expect(err).To(BeNil())
+
+		Expect(read(store, key)).To(Equal("content"))
+		Expect(read(store, key)).To(Equal("content"))
+
+		Expect(slow.gets).To(Equal(1))
+		Expect(fast.Has(ctx, key)).To(BeTrue())
+	})
+
+	It("Should write through to the slow tier", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow)
+		Expect(err).To(BeNil())
+
+		key, p, err := store.PutBlock(ctx, []byte("content"), cid.DagCBOR, nodePath)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(nodePath(key)))
+		Expect(read(slow, key)).To(Equal("content"))
+		Expect(read(store, key)).To(Equal("content"))
+		Expect(slow.gets).To(Equal(1))
+
+		Expect(store.Remove(ctx, key, nil)).To(BeNil())
+		Expect(fast.Has(ctx, key)).To(BeFalse())
+		_, err = store.Get(ctx, key)
+		Expect(err).To(Equal(datastore.ErrNotFound))
+	})
+
+	It("Should write back to the slow tier on Flush", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow, datastore.WithWritePolicy(datastore.WriteBack),
+			datastore.WithMaxFastSize(1))
+		Expect(err).To(BeNil())
+
+		key, p, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(nodePath(key)))
+		Expect(slow.puts).To(Equal(0))
+		Expect(read(store, key)).To(Equal("content"))
+
+		Expect(store.Flush(ctx)).To(BeNil())
+		Expect(slow.streams).To(Equal(1))
+		Expect(read(slow, key)).To(Equal("content"))
+		Expect(fast.Has(ctx, key)).To(BeFalse())
+	})
+
+	It("Should write back every path content is linked at", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+		otherPath := func(key string) string {
+			return "/other/" + key + "/node"
+		}
+		lastPath := func(key string) string {
+			return "/last/" + key + "/node"
+		}
+
+		key, _, err := store.Put(ctx, []byte("content"), nodePath)
+		Expect(err).To(BeNil())
+		_, _, err = store.Put(ctx, []byte("content"), otherPath)
+		Expect(err).To(BeNil())
+		Expect(store.Flush(ctx)).To(BeNil())
+		_, _, err = store.Put(ctx, []byte("content"), lastPath)
+		Expect(err).To(BeNil())
+
+		var paths []string
+		for link, err := range slow.DataStore.(datastore.PathLinker).Paths(ctx, "/") {
+			Expect(err).To(BeNil())
+			Expect(link.Key).To(Equal(key))
+			paths = append(paths, link.Path)
+		}
+		Expect(paths).To(ConsistOf(nodePath(key), otherPath(key), lastPath(key)))
+	})
+
+	It("Should stream content through both tiers", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow)
+		Expect(err).To(BeNil())
+
+		key, p, err := store.PutReader(ctx, strings.NewReader("content"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(p).To(Equal(nodePath(key)))
+		Expect(slow.streams).To(Equal(1))
+		Expect(slow.puts).To(Equal(0))
+		Expect(fast.Has(ctx, key)).To(BeTrue())
+		Expect(read(store, key)).To(Equal("content"))
+		Expect(slow.gets).To(Equal(0))
+	})
+
+	It("Should stream content written back on Flush", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+
+		key, _, err := store.PutReader(ctx, strings.NewReader("content"), nodePath)
+		Expect(err).To(BeNil())
+		Expect(slow.streams).To(Equal(0))
+		Expect(read(store, key)).To(Equal("content"))
+
+		Expect(store.Flush(ctx)).To(BeNil())
+		Expect(slow.streams).To(Equal(1))
+		Expect(slow.puts).To(Equal(0))
+		Expect(read(slow, key)).To(Equal("content"))
+	})
+
+	It("Should cache content read from the slow tier by streaming it", func() {
+		key, _, err := slow.Put(ctx, []byte("content"), nil)
+		Expect(err).To(BeNil())
+		store, err := datastore.NewTieredDataStore(fast, slow, datastore.WithMaxFastSize(3))
+		Expect(err).To(BeNil())
+
+		Expect(read(store, key)).To(Equal("content"))
+		Expect(fast.Has(ctx, key)).To(BeFalse())
+		Expect(read(store, key)).To(Equal("content"))
+		Expect(slow.gets).To(Equal(2))
+	})
+
+	It("Should fail to flush when the tiers derive different keys", func() {
+		store, err := datastore.NewTieredDataStore(fast, upperKeyDataStore{slow}, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+
+		_, _, err = store.Put(ctx, []byte("content"), nil)
+		Expect(err).To(BeNil())
+		Expect(store.Flush(ctx)).To(Equal(datastore.ErrKeyMismatch))
+	})
+
+	It("Should flush content written back before a restart", func() {
+		dir, err := os.MkdirTemp("", "tiered-data-store")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		db, err := bbolt.Open(filepath.Join(dir, "fast.db"), 0600, nil)
+		Expect(err).To(BeNil())
+		defer db.Close()
+		bolt, err := datastore.NewBoltDataStore(db)
+		Expect(err).To(BeNil())
+		store, err := datastore.NewTieredDataStore(bolt, slow, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+		key, _, err := store.PutBlock(ctx, []byte("content"), cid.DagCBOR, nodePath)
+		Expect(err).To(BeNil())
+
+		restarted, err := datastore.NewTieredDataStore(bolt, slow, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+		Expect(read(restarted, key)).To(Equal("content"))
+		Expect(slow.gets).To(Equal(0))
+		Expect(restarted.Flush(ctx)).To(BeNil())
+		Expect(read(slow, key)).To(Equal("content"))
+
+		restarted, err = datastore.NewTieredDataStore(bolt, slow, datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(BeNil())
+		Expect(restarted.Flush(ctx)).To(BeNil())
+		Expect(slow.puts).To(Equal(1))
+	})
+
+	It("Should NOT write back to a fast tier that can't record unflushed content", func() {
+		_, err := datastore.NewTieredDataStore(&countingDataStore{DataStore: fast}, slow,
+			datastore.WithWritePolicy(datastore.WriteBack))
+		Expect(err).To(Equal(datastore.ErrNotPathLinker))
+	})
+
+	It("Should evict the least recently used content from the fast tier", func() {
+		store, err := datastore.NewTieredDataStore(fast, slow, datastore.WithMaxFastSize(20))
+		Expect(err).To(BeNil())
+		var keys []string
+		for _, content := range []string{"first.....", "second....", "third....."} {
+			key, _, err := store.Put(ctx, []byte(content), nil)
+			Expect(err).To(BeNil())
+			keys = append(keys, key)
+		}
+
+		Expect(fast.Has(ctx, keys[0])).To(BeFalse())
+		Expect(fast.Has(ctx, keys[1])).To(BeTrue())
+		Expect(fast.Has(ctx, keys[2])).To(BeTrue())
+
+		Expect(read(store, keys[0])).To(Equal("first....."))
+		Expect(slow.gets).To(Equal(1))
+		Expect(fast.Has(ctx, keys[1])).To(BeFalse())
+		Expect(fast.Has(ctx, keys[0])).To(BeTrue())
+	})
+})
+
+// upperKeyDataStore stores content under other keys than NewLocalFileStore.
+type upperKeyDataStore struct {
+	datastore.DataStore
+}
+
+func (d upperKeyDataStore) Put(ctx context.Context, b []byte, pathFunc datastore.PathFunc) (string, string, error) {
+	key, p, err := d.DataStore.Put(ctx, b, pathFunc)
+	return strings.ToUpper(key), p, err
+}
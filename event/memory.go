@@ -0,0 +1,122 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBus connects in-memory Managers, so components exchanging events can
+// run without IPFS, e.g. in tests. Events emitted by a Manager are delivered,
+// in order, to the subscribers of every other Manager of the bus, as pubsub
+// does for peers of a topic. Deliveries run on a goroutine per Manager.
+type MemoryBus struct {
+	mtx      sync.Mutex
+	managers []*memoryManager
+}
+
+type memoryManager struct {
+	bus           *MemoryBus
+	subscriptions *subscriptions
+	mtx           sync.Mutex
+	cond          *sync.Cond
+	queue         []Event
+	closed        bool
+}
+
+var _ Manager = (*memoryManager)(nil)
+
+// NewMemoryBus creates a bus without Managers.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Manager creates a Manager joined to the bus.
+func (b *MemoryBus) Manager() Manager {
+	m := &memoryManager{
+		bus:           b,
+		subscriptions: newSubscriptions(),
+	}
+	m.cond = sync.NewCond(&m.mtx)
+	b.mtx.Lock()
+	b.managers = append(b.managers, m)
+	b.mtx.Unlock()
+	go m.deliver()
+	return m
+}
+
+// Close stops delivering events. Events still queued are dropped.
+func (b *MemoryBus) Close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, m := range b.managers {
+		m.mtx.Lock()
+		m.closed = true
+		m.cond.Signal()
+		m.mtx.Unlock()
+	}
+	b.managers = nil
+}
+
+func (m *memoryManager) On(eventName string, callback CallbackFunc) *Subscription {
+	return m.subscriptions.Subscribe(eventName, callback)
+}
+
+func (m *memoryManager) Next(ctx context.Context, eventName string) (Event, error) {
+	doneChan := make(chan Event, 1)
+	sub := m.On(eventName, func(ev Event) {
+		select {
+		case doneChan <- ev:
+		default:
+		}
+	})
+	defer sub.Unsubscribe()
+
+	select {
+	case ev := <-doneChan:
+		return ev, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *memoryManager) Emit(eventName string, data []byte) error {
+	ev := event{
+		N: eventName,
+		D: data,
+	}
+	m.bus.mtx.Lock()
+	defer m.bus.mtx.Unlock()
+	for _, other := range m.bus.managers {
+		if other != m {
+			other.enqueue(ev)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) enqueue(ev Event) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.queue = append(m.queue, ev)
+	m.cond.Signal()
+}
+
+func (m *memoryManager) deliver() {
+	for {
+		m.mtx.Lock()
+		for len(m.queue) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if m.closed {
+			m.mtx.Unlock()
+			return
+		}
+		ev := m.queue[0]
+		m.queue = m.queue[1:]
+		m.mtx.Unlock()
+
+		for _, callback := range m.subscriptions.Get(ev.Name()) {
+			callback(ev)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory bus", func() {
+	It("Should deliver events in order to the other managers only", func() {
+		bus := NewMemoryBus()
+		defer bus.Close()
+		sender := bus.Manager()
+		receiver := bus.Manager()
+
+		received := make(chan string, 10)
+		sender.On("test_event", func(ev Event) {
+			received <- "sender"
+		})
+		receiver.On("test_event", func(ev Event) {
+			received <- string(ev.Data())
+		})
+
+		for _, data := range []string{"1", "2", "3"} {
+			Expect(sender.Emit("test_event", []byte(data))).To(BeNil())
+		}
+		for _, data := range []string{"1", "2", "3"} {
+			Eventually(received).Should(Receive(Equal(data)))
+		}
+		Consistently(received, 50*time.Millisecond).ShouldNot(Receive())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = receiver.Emit("other_event", []byte("data"))
+		}()
+		ev, er := sender.Next(ctx, "other_event")
+		Expect(er).To(BeNil())
+		Expect(ev.Data()).To(Equal([]byte("data")))
+	})
+})
@@ -32,6 +32,8 @@ func (s *Subscription) Unsubscribe() {
 }
 
 func (m *subscriptions) Subscribe(eventName string, callback CallbackFunc) *Subscription {
+	m.subLock.Lock()
+	defer m.subLock.Unlock()
 	subs := m.getOrCreate(eventName)
 	id := uuid.New().String()
 	subs[id] = callback
@@ -66,8 +68,6 @@ func (m *subscriptions) Unsubscribe(eventName, id string) {
 }
 
 func (m *subscriptions) getOrCreate(eventName string) map[string]CallbackFunc {
-	m.subLock.Lock()
-	defer m.subLock.Unlock()
 	sub, found := m.subs[eventName]
 	if !found {
 		sub = make(map[string]CallbackFunc, 0)
@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"container/heap"
+	"context"
+
+	dag2 "github.com/msaldanha/setinstone/dag"
+)
+
+// CausalNodes returns every node of every branch of the graph in causal
+// order: each node comes after the nodes it follows, Previous, merge parents
+// and the node a tombstone redacts. Nodes are ordered by their Lamport Clock,
+// ties broken by key, so every replica lists them in the same order. Nodes
+// created before clocks existed are still placed after their predecessors.
+func (d *Graph) CausalNodes(ctx context.Context) ([]Node, error) {
+	entries := map[string]*causalEntry{}
+	er := d.da.WalkAddress(ctx, d.addr.Address, func(key string, node *dag2.Node) error {
+		entries[key] = &causalEntry{key: key, node: node}
+		return nil
+	})
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	for _, entry := range entries {
+		for _, key := range causalPredecessors(entry.node) {
+			if predecessor, ok := entries[key]; ok {
+				predecessor.successors = append(predecessor.successors, entry)
+				entry.pending++
+			}
+		}
+	}
+	ready := causalQueue{}
+	for _, entry := range entries {
+		if entry.pending == 0 {
+			heap.Push(&ready, entry)
+		}
+	}
+	result := make([]Node, 0, len(entries))
+	for ready.Len() > 0 {
+		entry := heap.Pop(&ready).(*causalEntry)
+		for _, successor := range entry.successors {
+			successor.pending--
+			if successor.pending == 0 {
+				heap.Push(&ready, successor)
+			}
+		}
+		item, er := d.toReadNode(ctx, entry.key, entry.node)
+		if er != nil {
+			return nil, er
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+type causalEntry struct {
+	key        string
+	node       *dag2.Node
+	pending    int
+	successors []*causalEntry
+}
+
+func causalPredecessors(node *dag2.Node) []string {
+	keys := ancestorKeys(node)
+	if node.Redacts != "" {
+		keys = append(keys, node.Redacts)
+	}
+	return keys
+}
+
+// causalQueue orders nodes ready to be released, lowest clock first.
+type causalQueue []*causalEntry
+
+func (q causalQueue) Len() int { return len(q) }
+
+func (q causalQueue) Less(i, j int) bool {
+	if q[i].node.Clock != q[j].node.Clock {
+		return q[i].node.Clock < q[j].node.Clock
+	}
+	return q[i].key < q[j].key
+}
+
+func (q causalQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *causalQueue) Push(x any) { *q = append(*q, x.(*causalEntry)) }
+
+func (q *causalQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
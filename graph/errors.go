@@ -8,4 +8,6 @@ var (
 	ErrNotFound             = errors.New("not found")
 	ErrPreviousNotFound     = errors.New("previous item not found")
 	ErrReadOnly             = errors.New("read only")
+	ErrNothingToMerge       = errors.New("nothing to merge")
+	ErrInvalidBatch         = errors.New("invalid batch")
 )
@@ -1,13 +1,16 @@
 package graph
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 
 	"go.uber.org/zap"
 
 	"github.com/msaldanha/setinstone/address"
 	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/tsa"
 )
 
 // Graph provides a higher-level API over a DAG (Directed Acyclic Graph)
@@ -23,6 +26,8 @@ type Graph struct {
 	addr     *address.Address
 	da       dag.DagInterface
 	logger   *zap.Logger
+
+	checkpointInterval int64
 }
 
 // Node is the public representation of a graph node returned by
@@ -31,9 +36,17 @@ type Graph struct {
 //
 // Fields such as Key, Previous, Branch and BranchRoot help clients
 // navigate the graph, while Data and Properties hold the payload.
+// Small payloads are kept inline in the node and returned in Data (see
+// dag.WithMaxInlineDataSize); larger ones are stored in chunks, described
+// by DataHash and DataSize, and fetched on demand by OpenData. Nodes whose
+// payload was redacted by a tombstone are returned with Redacted set and
+// without payload.
 type Node struct {
 	Key        string            `json:"key,omitempty"`
-	Seq        int32             `json:"seq,omitempty"`
+	Version    int32             `json:"version,omitempty"`
+	Type       string            `json:"type,omitempty"`
+	Seq        int64             `json:"seq,omitempty"`
+	Clock      uint64            `json:"clock,omitempty"`
 	Timestamp  string            `json:"timestamp,omitempty"`
 	Address    string            `json:"address,omitempty"`
 	Previous   string            `json:"previous,omitempty"`
@@ -41,9 +54,42 @@ type Node struct {
 	BranchRoot string            `json:"branchRoot,omitempty"`
 	Properties map[string]string `json:"properties,omitempty"`
 	Branches   []string          `json:"branches,omitempty"`
+	Parents    []string          `json:"parents,omitempty"`
+	Skips      []string          `json:"skips,omitempty"`
+	MerkleRoot string            `json:"merkleRoot,omitempty"`
+	Redacts    string            `json:"redacts,omitempty"`
+	Redacted   bool              `json:"redacted,omitempty"`
 	Data       []byte            `json:"data,omitempty"`
+	DataHash   string            `json:"dataHash,omitempty"`
+	DataSize   int64             `json:"dataSize,omitempty"`
+	DataChunks []string          `json:"dataChunks,omitempty"`
 	PubKey     string            `json:"pubKey,omitempty"`
 	Signature  string            `json:"signature,omitempty"`
+
+	da dag.DagInterface
+}
+
+// OpenData returns a reader over the node payload, whether it is inline in
+// Data or stored in chunks, which are only fetched as the reader is read.
+// Reading fails with dag.ErrDataHashMismatch if the fetched content does not
+// match DataHash. Returns dag.ErrDataRedacted for redacted nodes.
+func (n Node) OpenData(ctx context.Context) (io.ReadCloser, error) {
+	if n.Redacted {
+		return nil, dag.ErrDataRedacted
+	}
+	if n.DataHash == "" {
+		return io.NopCloser(bytes.NewReader(n.Data)), nil
+	}
+	if n.da == nil {
+		return nil, ErrNotFound
+	}
+	return n.da.OpenData(ctx, &dag.Node{
+		Version:    n.Version,
+		Data:       n.Data,
+		DataHash:   n.DataHash,
+		DataSize:   n.DataSize,
+		DataChunks: n.DataChunks,
+	})
 }
 
 // NodeData contains the minimal information required to create
@@ -51,27 +97,44 @@ type Node struct {
 // Branch selects which branch to append to; Branches can declare
 // available branches when creating the first node of a graph.
 // Properties can store arbitrary key/value metadata alongside Data.
+// Parents lists the keys of other heads joined by the node, turning it
+// into a merge node; see Merge. DataReader, when set, replaces Data and
+// streams the payload to chunks without holding it in memory.
 type NodeData struct {
 	Address    string
 	Data       []byte
+	DataReader io.Reader
 	Branch     string
 	Branches   []string
+	Parents    []string
 	Properties map[string]string
 }
 
+// MergeSource identifies a branch, by its root key and name, whose current
+// head is joined by Merge. An empty KeyRoot means the graph root.
+type MergeSource struct {
+	KeyRoot string
+	Branch  string
+}
+
 // New constructs a Graph bound to the provided address and backing DAG
 // implementation. If the address contains a private key, the underlying
-// DAG is placed into managed mode for that address.
-func New(addr *address.Address, da dag.DagInterface, logger *zap.Logger) *Graph {
+// DAG is placed into managed mode for that address. Optional behaviour is
+// configured with options, see Option.
+func New(addr *address.Address, da dag.DagInterface, logger *zap.Logger, options ...Option) *Graph {
 	if addr.Keys != nil && addr.Keys.PrivateKey != "" {
 		_ = da.Manage(addr)
 	}
 
-	return &Graph{
+	g := &Graph{
 		da:     da,
 		addr:   addr,
 		logger: logger,
 	}
+	for _, option := range options {
+		option(g)
+	}
+	return g
 }
 
 // GetName returns the human-readable name of this graph, if set.
@@ -102,7 +165,34 @@ func (d *Graph) Get(ctx context.Context, key string) (Node, bool, error) {
 		}
 		return Node{}, false, d.translateError(er)
 	}
-	return d.toGraphNode(key, node), true, nil
+	n, er := d.toReadNode(ctx, key, node)
+	if er != nil {
+		return Node{}, false, er
+	}
+	return n, true, nil
+}
+
+// GetBySeq retrieves the node with sequence number seq of the given branch.
+// If keyRoot is empty, the graph root is used. It follows the skip pointers of
+// the nodes, so only a logarithmic number of nodes is fetched. As Get, it
+// returns ok=false and err=nil when there is no such node.
+func (d *Graph) GetBySeq(ctx context.Context, keyRoot, branch string, seq int64) (Node, bool, error) {
+	keyRoot, er := d.resolveKeyRoot(ctx, keyRoot)
+	if er != nil {
+		return Node{}, false, er
+	}
+	node, key, er := d.seekSeq(ctx, keyRoot, branch, seq)
+	if errors.Is(er, ErrNotFound) {
+		return Node{}, false, nil
+	}
+	if er != nil {
+		return Node{}, false, er
+	}
+	n, er := d.toReadNode(ctx, key, node)
+	if er != nil {
+		return Node{}, false, er
+	}
+	return n, true, nil
 }
 
 // Append adds a new node to the graph on the specified branch.
@@ -132,24 +222,292 @@ func (d *Graph) Append(ctx context.Context, keyRoot string, node NodeData) (Node
 	if er != nil {
 		return Node{}, er
 	}
-	seq := int32(0)
-	if lastKey == keyRoot && last.Branch != node.Branch {
-		seq = 1
-	} else {
-		seq = last.Seq + 1
+	n, er := d.createNode(ctx, node, keyRoot, last, lastKey, nextSeq(keyRoot, lastKey, last, node.Branch))
+	if er != nil {
+		return Node{}, er
+	}
+	key, er := d.da.Append(ctx, n, keyRoot)
+	if er != nil {
+		return Node{}, er
 	}
+	if d.checkpointInterval > 0 && n.Seq%d.checkpointInterval == 0 {
+		_, er = d.Checkpoint(ctx, keyRoot, node.Branch)
+		if er != nil && d.logger != nil {
+			d.logger.Error("Failed to append checkpoint", zap.String("branch", node.Branch), zap.Error(er))
+		}
+	}
+	return d.toAppendedNode(ctx, key, n)
+}
 
-	n, er := createNode(node, keyRoot, lastKey, d.addr, seq)
+// Checkpoint appends a checkpoint node to the given branch, committing to the
+// Merkle root of every node of the branch before it. If keyRoot is empty, the
+// graph root is used. Use ProveInclusion to prove a node is covered by it.
+func (d *Graph) Checkpoint(ctx context.Context, keyRoot, branch string) (Node, error) {
+	if d.addr.Keys == nil || d.addr.Keys.PrivateKey == "" {
+		return Node{}, ErrReadOnly
+	}
+	keyRoot, er := d.resolveKeyRoot(ctx, keyRoot)
+	if er != nil {
+		return Node{}, er
+	}
+	last, lastKey, er := d.da.GetLast(ctx, keyRoot, branch)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	seq := nextSeq(keyRoot, lastKey, last, branch)
+	root, er := d.da.MerkleRoot(ctx, lastKey, seq-1)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	n, er := d.createTypedNode(ctx, dag.NodeTypeCheckpoint, NodeData{Branch: branch}, keyRoot, last, lastKey, seq)
+	if er != nil {
+		return Node{}, er
+	}
+	n.MerkleRoot = root
+	er = n.Sign(d.addr.Keys.ToEcdsaPrivateKey())
 	if er != nil {
 		return Node{}, er
 	}
 	key, er := d.da.Append(ctx, n, keyRoot)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	return d.toGraphNode(key, n), nil
+}
+
+// ProveInclusion returns a proof, verifiable offline, that the node with key
+// nodeKey is covered by the checkpoint with key checkpointKey.
+func (d *Graph) ProveInclusion(ctx context.Context, checkpointKey, nodeKey string) (*dag.InclusionProof, error) {
+	proof, er := d.da.ProveInclusion(ctx, checkpointKey, nodeKey)
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	return proof, nil
+}
+
+// AppendBatch appends a contiguous run of nodes to a single branch in one
+// call. Nodes are built, signed and stored in order, and the branch head only
+// moves once all of them are stored; if any of them fails, the head is left
+// unchanged. All nodes must target the same branch. If keyRoot is empty, the
+// graph root is used; when the graph is empty, the first node becomes the
+// root, as in Append, and the remaining ones form the batch.
+func (d *Graph) AppendBatch(ctx context.Context, keyRoot string, nodes []NodeData) ([]Node, error) {
+	if d.addr.Keys == nil || d.addr.Keys.PrivateKey == "" {
+		return nil, ErrReadOnly
+	}
+	if len(nodes) == 0 {
+		return nil, ErrInvalidBatch
+	}
+	branch := nodes[0].Branch
+	for _, node := range nodes {
+		if node.Branch != branch {
+			return nil, ErrInvalidBatch
+		}
+	}
+
+	result := make([]Node, 0, len(nodes))
+	if keyRoot == "" {
+		gn, gnKey, er := d.da.GetRoot(ctx, d.addr.Address)
+		if errors.Is(er, dag.ErrNodeNotFound) || gn == nil {
+			first, er := d.createFirstNode(ctx, nodes[0])
+			if er != nil {
+				return nil, er
+			}
+			result = append(result, first)
+			nodes = nodes[1:]
+			gnKey = first.Key
+		} else if er != nil {
+			return nil, er
+		}
+		keyRoot = gnKey
+	}
+
+	built := make([]*dag.Node, len(nodes))
+	keys, er := d.da.AppendBatch(ctx, keyRoot, branch, len(nodes),
+		func(index int, previous *dag.Node, previousKey string) (*dag.Node, error) {
+			n, er := d.createNode(ctx, nodes[index], keyRoot, previous, previousKey, nextSeq(keyRoot, previousKey, previous, branch))
+			built[index] = n
+			return n, er
+		})
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	for i, key := range keys {
+		n, er := d.toAppendedNode(ctx, key, built[i])
+		if er != nil {
+			return nil, er
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// Merge appends a merge node to node.Branch that joins the current heads of
+// the given source branches, so their history becomes part of the target
+// branch. Sources whose head already is the target head are ignored and
+// ErrNothingToMerge is returned when no head is left to join.
+func (d *Graph) Merge(ctx context.Context, keyRoot string, node NodeData, sources ...MergeSource) (Node, error) {
+	keyRoot, er := d.resolveKeyRoot(ctx, keyRoot)
+	if er != nil {
+		return Node{}, er
+	}
+	_, targetKey, er := d.da.GetLast(ctx, keyRoot, node.Branch)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	seen := map[string]bool{targetKey: true}
+	parents := []string{}
+	for _, source := range sources {
+		sourceRoot, er := d.resolveKeyRoot(ctx, source.KeyRoot)
+		if er != nil {
+			return Node{}, er
+		}
+		_, headKey, er := d.da.GetLast(ctx, sourceRoot, source.Branch)
+		if er != nil {
+			return Node{}, d.translateError(er)
+		}
+		if seen[headKey] {
+			continue
+		}
+		seen[headKey] = true
+		parents = append(parents, headKey)
+	}
+	if len(parents) == 0 {
+		return Node{}, ErrNothingToMerge
+	}
+	node.Parents = parents
+	return d.Append(ctx, keyRoot, node)
+}
+
+// CreateBranch opens a new branch named branch starting at the node with key
+// fromKey. If fromKey is empty, the graph root is used. Nodes can then be
+// appended to the branch using fromKey as keyRoot. Returns the branch-open
+// node, the first node of the branch.
+func (d *Graph) CreateBranch(ctx context.Context, fromKey, branch string) (Node, error) {
+	if d.addr.Keys == nil || d.addr.Keys.PrivateKey == "" {
+		return Node{}, ErrReadOnly
+	}
+	fromKey, er := d.resolveKeyRoot(ctx, fromKey)
+	if er != nil {
+		return Node{}, er
+	}
+	n, er := d.createTypedNode(ctx, dag.NodeTypeBranchOpen, NodeData{Branch: branch}, fromKey, nil, fromKey, 1)
+	if er != nil {
+		return Node{}, er
+	}
+	key, er := d.da.CreateBranch(ctx, n)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	return d.toGraphNode(key, n), nil
+}
+
+// CloseBranch closes the given branch by appending a branch-close node to it.
+// If keyRoot is empty, the graph root is used. Appending to a closed branch
+// fails with dag.ErrBranchClosed.
+func (d *Graph) CloseBranch(ctx context.Context, keyRoot, branch string) (Node, error) {
+	if d.addr.Keys == nil || d.addr.Keys.PrivateKey == "" {
+		return Node{}, ErrReadOnly
+	}
+	keyRoot, er := d.resolveKeyRoot(ctx, keyRoot)
+	if er != nil {
+		return Node{}, er
+	}
+	last, lastKey, er := d.da.GetLast(ctx, keyRoot, branch)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	n, er := d.createTypedNode(ctx, dag.NodeTypeBranchClose, NodeData{Branch: branch}, keyRoot, last, lastKey,
+		nextSeq(keyRoot, lastKey, last, branch))
 	if er != nil {
 		return Node{}, er
 	}
+	key, er := d.da.CloseBranch(ctx, n, keyRoot)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
 	return d.toGraphNode(key, n), nil
 }
 
+// Redact appends a tombstone redacting the payload of the node with the given
+// key to the branch of that node. The payload chunks are removed from the data
+// store and the node is then returned with Redacted set, while the chain keeps
+// verifying. See dag.Dag.Redact.
+func (d *Graph) Redact(ctx context.Context, key string) (Node, error) {
+	if d.addr.Keys == nil || d.addr.Keys.PrivateKey == "" {
+		return Node{}, ErrReadOnly
+	}
+	target, er := d.get(ctx, key)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	keyRoot := target.BranchRoot
+	if keyRoot == "" {
+		keyRoot = key
+	}
+	last, lastKey, er := d.da.GetLast(ctx, keyRoot, target.Branch)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	n, er := d.createTypedNode(ctx, dag.NodeTypeTombstone, NodeData{Branch: target.Branch}, keyRoot, last, lastKey,
+		nextSeq(keyRoot, lastKey, last, target.Branch))
+	if er != nil {
+		return Node{}, er
+	}
+	n.Redacts = key
+	n.Clock, er = d.da.NextClock(ctx, n)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	er = n.Sign(d.addr.Keys.ToEcdsaPrivateKey())
+	if er != nil {
+		return Node{}, er
+	}
+	tombstoneKey, er := d.da.Redact(ctx, n, keyRoot)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	return d.toGraphNode(tombstoneKey, n), nil
+}
+
+// GetTimestampToken returns the timestamp authority countersignature of the
+// node with the given key, or nil if it has none. See dag.Dag.Countersign.
+func (d *Graph) GetTimestampToken(ctx context.Context, key string) (*tsa.Token, error) {
+	token, er := d.da.GetTimestampToken(ctx, key)
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	return token, nil
+}
+
+// ListBranches lists the branches rooted at the node with the given key,
+// with their head and length. If key is empty, the graph root is used.
+func (d *Graph) ListBranches(ctx context.Context, key string) ([]dag.BranchInfo, error) {
+	key, er := d.resolveKeyRoot(ctx, key)
+	if er != nil {
+		return nil, er
+	}
+	branches, er := d.da.ListBranches(ctx, key)
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	return branches, nil
+}
+
+// GetBranch describes a single branch rooted at the node with the given key.
+// If key is empty, the graph root is used.
+func (d *Graph) GetBranch(ctx context.Context, key, branch string) (dag.BranchInfo, error) {
+	key, er := d.resolveKeyRoot(ctx, key)
+	if er != nil {
+		return dag.BranchInfo{}, er
+	}
+	info, er := d.da.GetBranch(ctx, key, branch)
+	if er != nil {
+		return dag.BranchInfo{}, d.translateError(er)
+	}
+	return *info, nil
+}
+
 // GetIterator creates an Iterator that walks nodes in the given branch
 // starting from the provided key (from). If keyRoot is empty, the graph's
 // current root is implied by the underlying DAG implementation.
@@ -157,12 +515,86 @@ func (d *Graph) GetIterator(ctx context.Context, keyRoot, branch string, from st
 	return newIterator(ctx, d, from, keyRoot, branch)
 }
 
+// GetMergedIterator creates an Iterator that walks the whole history reachable
+// from the given branch, following both Previous and the parents of merge
+// nodes. Nodes are returned in reverse topological order: every node comes
+// before all of its ancestors. As GetIterator, it starts at the branch head
+// or, when from is given, right before it.
+func (d *Graph) GetMergedIterator(ctx context.Context, keyRoot, branch string, from string) Iterator {
+	return newMergedIterator(ctx, d, from, keyRoot, branch)
+}
+
+// VerifyChain audits the given branch, re-verifying every node from the branch
+// head down to keyRoot. If keyRoot is empty, the graph root is used. Problems
+// found are listed in the returned report.
+func (d *Graph) VerifyChain(ctx context.Context, keyRoot, branch string) (*dag.ChainReport, error) {
+	keyRoot, er := d.resolveKeyRoot(ctx, keyRoot)
+	if er != nil {
+		return nil, er
+	}
+	report, er := d.da.VerifyChain(ctx, keyRoot, branch)
+	if er != nil {
+		return nil, d.translateError(er)
+	}
+	return report, nil
+}
+
+// Export writes the whole graph, every node of every branch and the names
+// of its root and branch heads, to w as a CAR archive. See dag.Dag.Export.
+func (d *Graph) Export(ctx context.Context, w io.Writer) error {
+	er := d.da.Export(ctx, d.addr.Address, w)
+	if er != nil {
+		return d.translateError(er)
+	}
+	return nil
+}
+
+// Import restores a graph from a CAR archive written by Export, verifying
+// every node before storing it. It returns the address of the imported graph,
+// which must not be initialized yet. See dag.Dag.Import.
+func (d *Graph) Import(ctx context.Context, r io.Reader) (string, error) {
+	addr, er := d.da.Import(ctx, r)
+	if er != nil {
+		return "", d.translateError(er)
+	}
+	return addr, nil
+}
+
 // Manage configures the underlying DAG to use the provided address
 // (and its keys) for subsequent write operations.
 func (d *Graph) Manage(addr *address.Address) error {
 	return d.da.Manage(addr)
 }
 
+func (d *Graph) resolveKeyRoot(ctx context.Context, keyRoot string) (string, error) {
+	if keyRoot != "" {
+		return keyRoot, nil
+	}
+	_, gnKey, er := d.da.GetRoot(ctx, d.addr.Address)
+	if er != nil {
+		return "", d.translateError(er)
+	}
+	return gnKey, nil
+}
+
+func (d *Graph) seekSeq(ctx context.Context, keyRoot, branch string, seq int64) (*dag.Node, string, error) {
+	head, headKey, er := d.da.GetLast(ctx, keyRoot, branch)
+	if er != nil {
+		return nil, "", d.translateError(er)
+	}
+	if head.Branch != branch {
+		return nil, "", ErrNotFound
+	}
+	node, key, er := d.da.SeekSeq(ctx, headKey, seq)
+	if er != nil {
+		return nil, "", d.translateError(er)
+	}
+	if node.Branch != branch {
+		return nil, "", ErrNotFound
+	}
+	return node, key, nil
+}
+
 func (d *Graph) get(ctx context.Context, key string) (*dag.Node, error) {
 	var node *dag.Node
 	var er error
@@ -201,7 +633,7 @@ func (d *Graph) createFirstNode(ctx context.Context, node NodeData) (Node, error
 	if !hasDefaultBranch {
 		node.Branches = append(node.Branches, node.Branch)
 	}
-	n, er := createNode(node, "", "", d.addr, 1)
+	n, er := d.createNode(ctx, node, "", nil, "", 1)
 	if er != nil {
 		return Node{}, d.translateError(er)
 	}
@@ -211,7 +643,7 @@ func (d *Graph) createFirstNode(ctx context.Context, node NodeData) (Node, error
 		return Node{}, d.translateError(er)
 	}
 
-	return d.toGraphNode(key, n), nil
+	return d.toAppendedNode(ctx, key, n)
 }
 
 func (d *Graph) translateError(er error) error {
@@ -224,10 +656,47 @@ func (d *Graph) translateError(er error) error {
 	return er
 }
 
+// toReadNode converts a node read from the DAG, flagging it and dropping its
+// payload when it was redacted. Small payloads are read along with the node,
+// into Data.
+func (d *Graph) toReadNode(ctx context.Context, key string, node *dag.Node) (Node, error) {
+	n := d.toGraphNode(key, node)
+	tombstoneKey, er := d.da.GetRedaction(ctx, key)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	if tombstoneKey != "" {
+		n.Redacted = true
+		n.Data = nil
+		n.DataChunks = nil
+		return n, nil
+	}
+	n.Data, er = d.da.InlineData(ctx, node)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	return n, nil
+}
+
+// toAppendedNode converts a node just appended, reading its payload into Data
+// when it is small, as toReadNode does.
+func (d *Graph) toAppendedNode(ctx context.Context, key string, node *dag.Node) (Node, error) {
+	n := d.toGraphNode(key, node)
+	data, er := d.da.InlineData(ctx, node)
+	if er != nil {
+		return Node{}, d.translateError(er)
+	}
+	n.Data = data
+	return n, nil
+}
+
 func (d *Graph) toGraphNode(key string, node *dag.Node) Node {
 	return Node{
 		Key:        key,
+		Version:    node.Version,
+		Type:       node.Type,
 		Seq:        node.Seq,
+		Clock:      node.Clock,
 		Timestamp:  node.Timestamp,
 		Address:    node.Address,
 		Previous:   node.Previous,
@@ -235,8 +704,16 @@ func (d *Graph) toGraphNode(key string, node *dag.Node) Node {
 		BranchRoot: node.BranchRoot,
 		Properties: node.Properties,
 		Branches:   node.Branches,
+		Parents:    node.Parents,
+		Skips:      node.Skips,
+		MerkleRoot: node.MerkleRoot,
+		Redacts:    node.Redacts,
 		Data:       node.Data,
+		DataHash:   node.DataHash,
+		DataSize:   node.DataSize,
+		DataChunks: node.DataChunks,
 		PubKey:     node.PubKey,
 		Signature:  node.Signature,
+		da:         d.da,
 	}
 }
@@ -1,8 +1,12 @@
 package graph
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -53,6 +57,7 @@ var _ = Describe("Graph", func() {
 		Expect(er).To(BeNil())
 		Expect(found).To(BeTrue())
 		Expect(data).To(Equal(dataToAdd))
+		Expect(v.Version).To(Equal(dag.NodeVersion2))
 	})
 
 	It("When adding, should return error if previous node does not exists", func() {
@@ -165,8 +170,517 @@ var _ = Describe("Graph", func() {
 		}
 		Expect(i).To(Equal(0))
 	})
+
+	It("Should merge branches and walk merged history", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+
+		root, er := gr.Append(ctx, "", NodeData{Branch: "main", Branches: []string{"main", "drafts"}, Data: []byte("root")})
+		Expect(er).To(BeNil())
+		for i := 0; i < 3; i++ {
+			_, er = gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+			_, er = gr.Append(ctx, "", NodeData{Branch: "drafts", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+		}
+
+		merged, er := gr.Merge(ctx, "", NodeData{Branch: "main", Data: []byte("merge")},
+			MergeSource{Branch: "drafts"})
+		Expect(er).To(BeNil())
+		Expect(merged.Parents).To(HaveLen(1))
+
+		_, er = gr.Merge(ctx, "", NodeData{Branch: "main"}, MergeSource{Branch: "main"})
+		Expect(er).To(Equal(ErrNothingToMerge))
+
+		seen := map[string]bool{}
+		count := 0
+		for v := range gr.GetMergedIterator(ctx, "", "main", "").All() {
+			Expect(seen[v.Key]).To(BeFalse())
+			for _, ancestor := range append([]string{v.Previous}, v.Parents...) {
+				Expect(seen[ancestor]).To(BeFalse())
+			}
+			seen[v.Key] = true
+			count++
+			if count == 1 {
+				Expect(v.Key).To(Equal(merged.Key))
+			}
+			Expect(v.Key == root.Key).To(Equal(count == 8))
+		}
+		Expect(count).To(Equal(8))
+
+		linear := 0
+		for range gr.GetIterator(ctx, "", "main", "").All() {
+			linear++
+		}
+		Expect(linear).To(Equal(5))
+	})
+
+	It("Should walk merged history without clocks in topological order", func() {
+		timestamp := time.Now().UTC().Format(time.RFC3339)
+		appendNode := func(keyRoot, previous, branch string, seq int64, mutate func(*dag.Node)) string {
+			n := &dag.Node{Version: dag.NodeVersion2, Address: addr.Address, PubKey: addr.Keys.PublicKey,
+				Timestamp: timestamp, Previous: previous, BranchRoot: keyRoot, Branch: branch, Seq: seq}
+			if mutate != nil {
+				mutate(n)
+			}
+			Expect(n.Sign(addr.Keys.ToEcdsaPrivateKey())).To(BeNil())
+			var key string
+			var er error
+			switch {
+			case previous == "":
+				key, er = ld.SetRoot(ctx, n)
+			case n.IsBranchOpen():
+				key, er = ld.CreateBranch(ctx, n)
+			default:
+				key, er = ld.Append(ctx, n, keyRoot)
+			}
+			Expect(er).To(BeNil())
+			return key
+		}
+
+		// The drafts branch is opened from x, so x must come after it, although
+		// x has the higher sequence number.
+		root := appendNode("", "", "main", 1, func(n *dag.Node) { n.Branches = []string{"main"} })
+		x := appendNode(root, root, "main", 2, nil)
+		open := appendNode(x, x, "drafts", 1, func(n *dag.Node) { n.Type = dag.NodeTypeBranchOpen })
+		y := appendNode(root, x, "main", 3, nil)
+		z := appendNode(root, y, "main", 4, nil)
+		merged := appendNode(root, z, "main", 5, func(n *dag.Node) { n.Parents = []string{open} })
+
+		gr := newGraph(ld, addr)
+		var keys []string
+		for v := range gr.GetMergedIterator(ctx, "", "main", "").All() {
+			Expect(v.Clock).To(BeZero())
+			keys = append(keys, v.Key)
+		}
+		Expect(keys).To(Equal([]string{merged, z, y, open, x, root}))
+	})
+
+	It("Should load merged history lazily", func() {
+		counting := &countingDataStore{DataStore: lts}
+		gr := newGraph(dag.NewDag("test-graph", counting, res), addr)
+
+		_, er := gr.Append(ctx, "", NodeData{Branch: "main", Branches: []string{"main", "drafts"}, Data: []byte("root")})
+		Expect(er).To(BeNil())
+		for i := 0; i < 50; i++ {
+			_, er = gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+			_, er = gr.Append(ctx, "", NodeData{Branch: "drafts", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+		}
+		merged, er := gr.Merge(ctx, "", NodeData{Branch: "main", Data: []byte("merge")},
+			MergeSource{Branch: "drafts"})
+		Expect(er).To(BeNil())
+
+		counting.gets = 0
+		it := gr.GetMergedIterator(ctx, "", "main", "")
+		v, er := it.Last()
+		Expect(er).To(BeNil())
+		Expect(v.Key).To(Equal(merged.Key))
+		Expect(counting.gets).To(BeNumerically("<", 20))
+
+		count := 1
+		for v, er = it.Prev(); er == nil && v != nil; v, er = it.Prev() {
+			count++
+		}
+		Expect(er).To(BeNil())
+		Expect(count).To(Equal(102))
+	})
+
+	It("Should list the nodes of every branch in causal order", func() {
+		gr := newGraph(ld, addr)
+
+		root, er := gr.Append(ctx, "", NodeData{Branch: "main", Branches: []string{"main", "drafts"}, Data: []byte("root")})
+		Expect(er).To(BeNil())
+		Expect(root.Clock).To(Equal(uint64(1)))
+		for i := 0; i < 3; i++ {
+			_, er = gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+		}
+		draft, er := gr.Append(ctx, "", NodeData{Branch: "drafts", Data: []byte("draft")})
+		Expect(er).To(BeNil())
+		Expect(draft.Clock).To(Equal(uint64(5)))
+		merged, er := gr.Merge(ctx, "", NodeData{Branch: "main", Data: []byte("merge")},
+			MergeSource{Branch: "drafts"})
+		Expect(er).To(BeNil())
+		Expect(merged.Clock).To(Equal(uint64(6)))
+		tombstone, er := gr.Redact(ctx, draft.Key)
+		Expect(er).To(BeNil())
+		Expect(tombstone.Clock).To(Equal(uint64(7)))
+
+		nodes, er := gr.CausalNodes(ctx)
+		Expect(er).To(BeNil())
+		Expect(nodes).To(HaveLen(7))
+		position := map[string]int{}
+		for i, n := range nodes {
+			position[n.Key] = i
+			if i > 0 {
+				Expect(n.Clock).To(BeNumerically(">", nodes[i-1].Clock))
+			}
+			for _, ancestor := range append([]string{n.Previous, n.Redacts}, n.Parents...) {
+				if ancestor != "" {
+					Expect(position).To(HaveKey(ancestor))
+				}
+			}
+		}
+		Expect(nodes[0].Key).To(Equal(root.Key))
+		Expect(nodes[position[draft.Key]].Redacted).To(BeTrue())
+		Expect(nodes[5].Key).To(Equal(merged.Key))
+		Expect(nodes[6].Key).To(Equal(tombstone.Key))
+	})
+
+	It("Should manage branch lifecycle", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+
+		_, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: []byte("root")})
+		Expect(er).To(BeNil())
+		from, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: []byte("from")})
+		Expect(er).To(BeNil())
+
+		opened, er := gr.CreateBranch(ctx, from.Key, "drafts")
+		Expect(er).To(BeNil())
+		Expect(opened.Type).To(Equal(dag.NodeTypeBranchOpen))
+
+		_, er = gr.CreateBranch(ctx, from.Key, "drafts")
+		Expect(er).To(Equal(dag.ErrBranchAlreadyExists))
+
+		draft, er := gr.Append(ctx, from.Key, NodeData{Branch: "drafts", Data: []byte("draft")})
+		Expect(er).To(BeNil())
+		Expect(draft.Seq).To(Equal(int64(2)))
+
+		branches, er := gr.ListBranches(ctx, from.Key)
+		Expect(er).To(BeNil())
+		Expect(branches).To(HaveLen(1))
+		Expect(branches[0].HeadKey).To(Equal(draft.Key))
+		Expect(branches[0].Length).To(Equal(int64(2)))
+
+		branches, er = gr.ListBranches(ctx, "")
+		Expect(er).To(BeNil())
+		Expect(branches).To(HaveLen(1))
+		Expect(branches[0].Name).To(Equal("main"))
+		Expect(branches[0].HeadKey).To(Equal(from.Key))
+
+		_, er = gr.CloseBranch(ctx, from.Key, "drafts")
+		Expect(er).To(BeNil())
+
+		_, er = gr.Append(ctx, from.Key, NodeData{Branch: "drafts", Data: []byte("late")})
+		Expect(er).To(Equal(dag.ErrBranchClosed))
+
+		info, er := gr.GetBranch(ctx, from.Key, "drafts")
+		Expect(er).To(BeNil())
+		Expect(info.Closed).To(BeTrue())
+		Expect(info.Length).To(Equal(int64(3)))
+	})
+
+	It("Should append a batch of nodes", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+
+		batch := []NodeData{}
+		for i := 0; i < 5; i++ {
+			batch = append(batch, NodeData{Branch: "main", Data: toBytes(i)})
+		}
+		added, er := gr.AppendBatch(ctx, "", batch)
+		Expect(er).To(BeNil())
+		Expect(added).To(HaveLen(5))
+
+		added, er = gr.AppendBatch(ctx, "", batch)
+		Expect(er).To(BeNil())
+		Expect(added).To(HaveLen(5))
+		Expect(added[4].Seq).To(Equal(int64(10)))
+
+		count := 0
+		for v := range gr.GetIterator(ctx, "", "main", "").All() {
+			Expect(v.Key).To(Equal(added[len(added)-1-count].Key))
+			count++
+			if count == len(added) {
+				break
+			}
+		}
+
+		_, er = gr.AppendBatch(ctx, "", []NodeData{{Branch: "main"}, {Branch: "drafts"}})
+		Expect(er).To(Equal(ErrInvalidBatch))
+	})
+
+	It("Should leave the head unchanged when a batch fails", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+
+		head, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: []byte("root")})
+		Expect(er).To(BeNil())
+
+		_, er = gr.AppendBatch(ctx, "", []NodeData{
+			{Branch: "main", Data: toBytes(1)},
+			{Branch: "main", Data: toBytes(2)},
+			{Branch: "main", Data: toBytes(3), Parents: []string{"missing"}},
+		})
+		Expect(er).To(Equal(dag.ErrMergeParentNotFound))
+
+		_, lastKey, er := ld.GetLast(ctx, head.Key, "main")
+		Expect(er).To(BeNil())
+		Expect(lastKey).To(Equal(head.Key))
+	})
+
+	It("Should get nodes by seq following skip pointers", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		counting := &countingDataStore{DataStore: lts}
+		gr := newGraph(dag.NewDag("test-graph", counting, res), addr)
+
+		batch := []NodeData{}
+		for i := 1; i <= 300; i++ {
+			batch = append(batch, NodeData{Branch: "main", Data: toBytes(i)})
+		}
+		added, er := gr.AppendBatch(ctx, "", batch)
+		Expect(er).To(BeNil())
+
+		for _, seq := range []int64{1, 2, 10, 129, 255, 299, 300} {
+			counting.gets = 0
+			v, found, er := gr.GetBySeq(ctx, "", "main", seq)
+			Expect(er).To(BeNil())
+			Expect(found).To(BeTrue())
+			Expect(v.Key).To(Equal(added[seq-1].Key))
+			Expect(counting.gets).To(BeNumerically("<", 25))
+		}
+
+		_, found, er := gr.GetBySeq(ctx, "", "main", 301)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeFalse())
+
+		it := gr.GetIterator(ctx, "", "main", "")
+		v, er := it.SeekSeq(10)
+		Expect(er).To(BeNil())
+		Expect(v.Seq).To(Equal(int64(10)))
+		v, er = it.Prev()
+		Expect(er).To(BeNil())
+		Expect(v.Seq).To(Equal(int64(9)))
+	})
+
+	It("Should add checkpoints periodically", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+		gr.checkpointInterval = 4
+
+		var added []Node
+		for i := 0; i < 6; i++ {
+			n, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(i)})
+			Expect(er).To(BeNil())
+			added = append(added, n)
+		}
+		Expect(added[4].Seq).To(Equal(int64(6)))
+
+		checkpoint, found, er := gr.GetBySeq(ctx, "", "main", 5)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(checkpoint.Type).To(Equal(dag.NodeTypeCheckpoint))
+
+		proof, er := gr.ProveInclusion(ctx, checkpoint.Key, added[1].Key)
+		Expect(er).To(BeNil())
+		Expect(proof.Verify()).To(BeNil())
+	})
+
+	It("Should store large payloads apart and open them on demand", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(dag.NewDag("test-graph", lts, res, dag.WithMaxInlineDataSize(1024)), addr)
+
+		payload := bytes.Repeat([]byte("attachment"), 1000)
+		added, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: payload})
+		Expect(er).To(BeNil())
+		Expect(added.Data).To(BeEmpty())
+		Expect(added.DataSize).To(Equal(int64(len(payload))))
+
+		v, found, er := gr.Get(ctx, added.Key)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(v.Data).To(BeEmpty())
+
+		r, er := v.OpenData(ctx)
+		Expect(er).To(BeNil())
+		data, er := io.ReadAll(r)
+		Expect(er).To(BeNil())
+		Expect(data).To(Equal(payload))
+	})
+
+	It("Should stream payloads read from a reader", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(dag.NewDag("test-graph", lts, res, dag.WithMaxInlineDataSize(1024)), addr)
+
+		payload := bytes.Repeat([]byte("attachment"), 1000)
+		added, er := gr.Append(ctx, "", NodeData{Branch: "main", DataReader: bytes.NewReader(payload)})
+		Expect(er).To(BeNil())
+		Expect(added.Data).To(BeEmpty())
+		Expect(added.DataSize).To(Equal(int64(len(payload))))
+
+		v, found, er := gr.Get(ctx, added.Key)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+
+		r, er := v.OpenData(ctx)
+		Expect(er).To(BeNil())
+		data, er := io.ReadAll(r)
+		Expect(er).To(BeNil())
+		Expect(data).To(Equal(payload))
+	})
+
+	It("Should export and import the whole graph", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+		first, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(testPayLoad{NumberField: 1})})
+		Expect(er).To(BeNil())
+		last, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(testPayLoad{NumberField: 2})})
+		Expect(er).To(BeNil())
+
+		buf := &bytes.Buffer{}
+		Expect(gr.Export(ctx, buf)).To(BeNil())
+
+		otherRes := resolver2.NewLocalResolver()
+		_ = otherRes.Manage(addr)
+		other := newGraph(dag.NewDag("test-graph", datastore2.NewLocalFileStore(), otherRes), addr)
+		imported, er := other.Import(ctx, buf)
+		Expect(er).To(BeNil())
+		Expect(imported).To(Equal(addr.Address))
+
+		it := other.GetIterator(ctx, "", "main", "")
+		v, er := it.Last()
+		Expect(er).To(BeNil())
+		Expect(v.Key).To(Equal(last.Key))
+		v, er = it.Prev()
+		Expect(er).To(BeNil())
+		Expect(v.Key).To(Equal(first.Key))
+	})
+
+	It("Should read a followed graph without resolving names its owner lacks", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(ld, addr)
+		first, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(testPayLoad{NumberField: 1})})
+		Expect(er).To(BeNil())
+		second, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(testPayLoad{NumberField: 2})})
+		Expect(er).To(BeNil())
+
+		remote := &remoteResolver{Resolver: resolver2.NewLocalResolver(), owner: res}
+		follower := newGraph(dag.NewDag("test-graph", lts, remote), &address.Address{Address: addr.Address})
+
+		v, found, er := follower.Get(ctx, first.Key)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(v.Redacted).To(BeFalse())
+		var keys []string
+		for v := range follower.GetIterator(ctx, "", "main", "").All() {
+			keys = append(keys, v.Key)
+		}
+		Expect(keys).To(Equal([]string{second.Key, first.Key}))
+		branches, er := follower.ListBranches(ctx, "")
+		Expect(er).To(BeNil())
+		Expect(branches).To(HaveLen(1))
+		Expect(branches[0].HeadKey).To(Equal(second.Key))
+		nodes, er := follower.CausalNodes(ctx)
+		Expect(er).To(BeNil())
+		Expect(nodes).To(HaveLen(2))
+		token, er := follower.GetTimestampToken(ctx, second.Key)
+		Expect(er).To(BeNil())
+		Expect(token).To(BeNil())
+		Expect(remote.unanswered).To(BeZero())
+	})
+
+	It("Should return redacted nodes flagged", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+
+		gr := newGraph(dag.NewDag("test-graph", lts, res, dag.WithMaxInlineDataSize(1024)), addr)
+		first, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: toBytes(testPayLoad{NumberField: 1})})
+		Expect(er).To(BeNil())
+		redacted, er := gr.Append(ctx, "", NodeData{Branch: "main", Data: bytes.Repeat([]byte("secret"), 1000)})
+		Expect(er).To(BeNil())
+
+		tombstone, er := gr.Redact(ctx, redacted.Key)
+		Expect(er).To(BeNil())
+		Expect(tombstone.Type).To(Equal(dag.NodeTypeTombstone))
+		Expect(tombstone.Redacts).To(Equal(redacted.Key))
+
+		var keys []string
+		for v := range gr.GetIterator(ctx, "", "main", "").All() {
+			keys = append(keys, v.Key)
+			Expect(v.Redacted).To(Equal(v.Key == redacted.Key))
+		}
+		Expect(keys).To(Equal([]string{tombstone.Key, redacted.Key, first.Key}))
+
+		v, found, er := gr.Get(ctx, redacted.Key)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(v.Redacted).To(BeTrue())
+		Expect(v.DataChunks).To(BeEmpty())
+		_, er = v.OpenData(ctx)
+		Expect(er).To(Equal(dag.ErrDataRedacted))
+
+		report, er := gr.VerifyChain(ctx, "", "main")
+		Expect(er).To(BeNil())
+		Expect(report.Valid()).To(BeTrue())
+
+		_, er = gr.Redact(ctx, first.Key)
+		Expect(er).To(BeNil())
+		v, found, er = gr.Get(ctx, first.Key)
+		Expect(er).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(v.Redacted).To(BeTrue())
+		Expect(v.Data).To(BeNil())
+	})
 })
 
+// countingDataStore counts the reads made to the wrapped data store.
+type countingDataStore struct {
+	datastore2.DataStore
+	gets int
+}
+
+func (c *countingDataStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	c.gets++
+	return c.DataStore.Get(ctx, key)
+}
+
+// remoteResolver resolves the names of the addresses it doesn't manage as the
+// IPFS resolver does: names the owner has are answered, and queries for other
+// names go unanswered until they time out.
+type remoteResolver struct {
+	resolver2.Resolver
+	owner      resolver2.Resolver
+	unanswered int
+}
+
+func (r *remoteResolver) Resolve(ctx context.Context, name string) (string, error) {
+	if r.IsManaged(strings.Split(name, "/")[1]) {
+		return r.Resolver.Resolve(ctx, name)
+	}
+	value, er := r.owner.Resolve(ctx, name)
+	if er == nil {
+		return value, nil
+	}
+	r.unanswered++
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
 func toBytes(data interface{}) []byte {
 	js, _ := json.Marshal(data)
 	return js
@@ -11,6 +11,11 @@ import (
 type Iterator interface {
 	Last() (*Node, error)
 	Prev() (*Node, error)
+	// SeekSeq moves the iterator to the node of the branch with sequence
+	// number seq and returns it; Prev then continues from its ancestors.
+	// Returns nil when there is no such node.
+	SeekSeq(seq int64) (*Node, error)
+	// All yields Last and then its ancestors, read ahead with dag.Walk.
 	All() iter.Seq[*Node]
 }
 
@@ -32,15 +37,8 @@ func (it *iterator) Last() (*Node, error) {
 	var key string
 	var err error
 	if it.start == "" {
-		if it.keyRoot == "" {
-			gn, gnKey, er := it.graph.da.GetRoot(it.ctx, it.graph.addr.Address)
-			if errors.Is(er, dag2.ErrNodeNotFound) || gn == nil {
-				return nil, ErrNotFound
-			}
-			if er != nil {
-				return nil, er
-			}
-			it.keyRoot = gnKey
+		if er := it.resolveKeyRoot(); er != nil {
+			return nil, er
 		}
 		node, key, err = it.graph.da.GetLast(it.ctx, it.keyRoot, it.branch)
 	} else {
@@ -55,7 +53,10 @@ func (it *iterator) Last() (*Node, error) {
 	if node == nil {
 		return nil, nil
 	}
-	item := it.graph.toGraphNode(key, node)
+	item, er := it.graph.toReadNode(it.ctx, key, node)
+	if er != nil {
+		return nil, er
+	}
 	it.previous = node.Previous
 	return &item, nil
 }
@@ -74,17 +75,64 @@ func (it *iterator) Prev() (*Node, error) {
 	if node == nil {
 		return nil, nil
 	}
-	item := it.graph.toGraphNode(it.previous, node)
+	item, er := it.graph.toReadNode(it.ctx, it.previous, node)
+	if er != nil {
+		return nil, er
+	}
+	it.previous = node.Previous
+	return &item, nil
+}
+
+func (it *iterator) SeekSeq(seq int64) (*Node, error) {
+	if er := it.resolveKeyRoot(); er != nil {
+		return nil, er
+	}
+	node, key, er := it.graph.seekSeq(it.ctx, it.keyRoot, it.branch, seq)
+	if errors.Is(er, ErrNotFound) {
+		return nil, nil
+	}
+	if er != nil {
+		return nil, er
+	}
+	item, er := it.graph.toReadNode(it.ctx, key, node)
+	if er != nil {
+		return nil, er
+	}
 	it.previous = node.Previous
 	return &item, nil
 }
 
+func (it *iterator) resolveKeyRoot() error {
+	if it.keyRoot != "" {
+		return nil
+	}
+	gn, gnKey, er := it.graph.da.GetRoot(it.ctx, it.graph.addr.Address)
+	if errors.Is(er, dag2.ErrNodeNotFound) || gn == nil {
+		return ErrNotFound
+	}
+	if er != nil {
+		return er
+	}
+	it.keyRoot = gnKey
+	return nil
+}
+
 func (it *iterator) All() iter.Seq[*Node] {
 	return func(yield func(*Node) bool) {
-		for v, er := it.Last(); er == nil && v != nil; v, er = it.Prev() {
-			if !yield(v) {
-				return
-			}
+		v, er := it.Last()
+		if er != nil || v == nil || !yield(v) {
+			return
 		}
+		_ = it.graph.da.Walk(it.ctx, it.previous, func(key string, node *dag2.Node) error {
+			item, er := it.graph.toReadNode(it.ctx, key, node)
+			if er != nil {
+				return er
+			}
+			it.previous = node.Previous
+			if !yield(&item) {
+				return dag2.ErrStopWalk
+			}
+			return nil
+		})
 	}
 }
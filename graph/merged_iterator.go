@@ -0,0 +1,267 @@
+package graph
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"iter"
+	"time"
+
+	dag2 "github.com/msaldanha/setinstone/dag"
+)
+
+// mergedIterator walks the history reachable from a branch head through both
+// Previous and merge parents. As merged history is not a line, it keeps a
+// frontier of the nodes whose descendants were all released, and releases
+// the one with the highest Lamport clock next. Clocks strictly increase from a
+// node to the ones referencing it, so nodes come in reverse topological order,
+// newest first on ties. Nodes are loaded as the frontier reaches them, so only
+// about one node per merged branch is held at a time.
+//
+// Nodes created before clocks were introduced have none, and only reference
+// nodes without clocks, so they come last. Their order can't be told from
+// the nodes themselves: once the frontier reaches them, the nodes still to be
+// released are loaded once to count the references to each of them, and a
+// node is only released after every node referencing it.
+type mergedIterator struct {
+	graph    *Graph
+	ctx      context.Context
+	start    string
+	keyRoot  string
+	branch   string
+	frontier mergedQueue
+	queued   map[string]bool
+	// pending counts, once the walk reached nodes without clocks, the nodes
+	// not released yet referencing each node.
+	pending map[string]int
+}
+
+type mergedEntry struct {
+	key       string
+	node      *dag2.Node
+	timestamp time.Time
+}
+
+func newMergedIterator(ctx context.Context, graph *Graph, start, keyRoot, branch string) *mergedIterator {
+	return &mergedIterator{ctx: ctx, graph: graph, start: start, keyRoot: keyRoot, branch: branch}
+}
+
+func (it *mergedIterator) Last() (*Node, error) {
+	var heads []string
+	if it.start == "" {
+		if er := it.resolveKeyRoot(); er != nil {
+			return nil, er
+		}
+		_, key, er := it.graph.da.GetLast(it.ctx, it.keyRoot, it.branch)
+		if er != nil {
+			return nil, it.graph.translateError(er)
+		}
+		heads = []string{key}
+	} else {
+		node, er := it.graph.get(it.ctx, it.start)
+		if errors.Is(er, ErrNotFound) {
+			return nil, nil
+		}
+		if er != nil {
+			return nil, er
+		}
+		heads = ancestorKeys(node)
+	}
+
+	er := it.load(heads)
+	if er != nil {
+		return nil, er
+	}
+	return it.Prev()
+}
+
+func (it *mergedIterator) Prev() (*Node, error) {
+	if it.frontier.Len() == 0 {
+		return nil, nil
+	}
+	if it.pending == nil && it.frontier[0].node.Clock == 0 {
+		if er := it.countReferences(); er != nil {
+			return nil, er
+		}
+	}
+	entry := heap.Pop(&it.frontier).(*mergedEntry)
+	delete(it.queued, entry.key)
+	er := it.push(ancestorKeys(entry.node))
+	if er != nil {
+		return nil, er
+	}
+	item, er := it.graph.toReadNode(it.ctx, entry.key, entry.node)
+	if er != nil {
+		return nil, er
+	}
+	return &item, nil
+}
+
+// SeekSeq restarts the merged walk at the node of the branch with sequence
+// number seq, so Prev continues with the history reachable from it.
+func (it *mergedIterator) SeekSeq(seq int64) (*Node, error) {
+	if er := it.resolveKeyRoot(); er != nil {
+		return nil, er
+	}
+	_, key, er := it.graph.seekSeq(it.ctx, it.keyRoot, it.branch, seq)
+	if errors.Is(er, ErrNotFound) {
+		return nil, nil
+	}
+	if er != nil {
+		return nil, er
+	}
+	er = it.load([]string{key})
+	if er != nil {
+		return nil, er
+	}
+	return it.Prev()
+}
+
+func (it *mergedIterator) resolveKeyRoot() error {
+	if it.keyRoot != "" {
+		return nil
+	}
+	gn, gnKey, er := it.graph.da.GetRoot(it.ctx, it.graph.addr.Address)
+	if errors.Is(er, dag2.ErrNodeNotFound) || gn == nil {
+		return ErrNotFound
+	}
+	if er != nil {
+		return er
+	}
+	it.keyRoot = gnKey
+	return nil
+}
+
+func (it *mergedIterator) All() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for v, er := it.Last(); er == nil && v != nil; v, er = it.Prev() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// load restarts the walk with heads as the frontier.
+func (it *mergedIterator) load(heads []string) error {
+	it.frontier = mergedQueue{}
+	it.queued = map[string]bool{}
+	it.pending = nil
+	return it.push(heads)
+}
+
+// push adds the nodes of keys to the frontier. A node is only queued once:
+// every node referencing it has a higher clock, so all of them are released,
+// and reference it, before it is. Nodes without clocks are only queued once
+// the last node referencing them is released.
+func (it *mergedIterator) push(keys []string) error {
+	for _, key := range keys {
+		if it.pending != nil {
+			it.pending[key]--
+			if it.pending[key] > 0 {
+				continue
+			}
+		}
+		if it.queued[key] {
+			continue
+		}
+		node, er := it.graph.get(it.ctx, key)
+		if errors.Is(er, ErrNotFound) {
+			continue
+		}
+		if er != nil {
+			return er
+		}
+		if node == nil {
+			continue
+		}
+		ts, _ := time.Parse(time.RFC3339, node.Timestamp)
+		it.queued[key] = true
+		heap.Push(&it.frontier, &mergedEntry{key: key, node: node, timestamp: ts})
+	}
+	return nil
+}
+
+// countReferences counts the references to the nodes reachable from the
+// frontier, which have no clocks, and keeps in the frontier only the nodes no
+// other one still to be released references.
+func (it *mergedIterator) countReferences() error {
+	it.pending = map[string]int{}
+	visited := map[string]bool{}
+	var stack []*dag2.Node
+	for _, entry := range it.frontier {
+		visited[entry.key] = true
+		stack = append(stack, entry.node)
+	}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, key := range ancestorKeys(node) {
+			it.pending[key]++
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			ancestor, er := it.graph.get(it.ctx, key)
+			if errors.Is(er, ErrNotFound) {
+				continue
+			}
+			if er != nil {
+				return er
+			}
+			if ancestor != nil {
+				stack = append(stack, ancestor)
+			}
+		}
+	}
+	ready := mergedQueue{}
+	for _, entry := range it.frontier {
+		if it.pending[entry.key] > 0 {
+			delete(it.queued, entry.key)
+			continue
+		}
+		ready = append(ready, entry)
+	}
+	heap.Init(&ready)
+	it.frontier = ready
+	return nil
+}
+
+func ancestorKeys(node *dag2.Node) []string {
+	keys := make([]string, 0, len(node.Parents)+1)
+	if node.Previous != "" {
+		keys = append(keys, node.Previous)
+	}
+	return append(keys, node.Parents...)
+}
+
+// mergedQueue orders nodes ready to be released, highest clock first, then
+// newest timestamp, highest sequence number and key.
+type mergedQueue []*mergedEntry
+
+func (q mergedQueue) Len() int { return len(q) }
+
+func (q mergedQueue) Less(i, j int) bool {
+	if q[i].node.Clock != q[j].node.Clock {
+		return q[i].node.Clock > q[j].node.Clock
+	}
+	if !q[i].timestamp.Equal(q[j].timestamp) {
+		return q[i].timestamp.After(q[j].timestamp)
+	}
+	if q[i].node.Seq != q[j].node.Seq {
+		return q[i].node.Seq > q[j].node.Seq
+	}
+	return q[i].key > q[j].key
+}
+
+func (q mergedQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *mergedQueue) Push(x any) { *q = append(*q, x.(*mergedEntry)) }
+
+func (q *mergedQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
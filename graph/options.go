@@ -0,0 +1,13 @@
+package graph
+
+// Option configures optional behaviour of a Graph created with New.
+type Option func(*Graph)
+
+// WithCheckpointInterval makes Append add a checkpoint node to a branch after
+// every node whose sequence number is a multiple of interval. Zero, the
+// default, disables automatic checkpoints.
+func WithCheckpointInterval(interval int64) Option {
+	return func(g *Graph) {
+		g.checkpointInterval = interval
+	}
+}
@@ -1,29 +1,63 @@
 package graph
 
 import (
+	"context"
 	"time"
 
-	"github.com/msaldanha/setinstone/address"
 	"github.com/msaldanha/setinstone/dag"
 )
 
-func createNode(node NodeData, keyRoot, prev string,
-	addr *address.Address, seq int32) (*dag.Node, error) {
+func (d *Graph) createNode(ctx context.Context, node NodeData, keyRoot string, previous *dag.Node, prev string,
+	seq int64) (*dag.Node, error) {
+	return d.createTypedNode(ctx, "", node, keyRoot, previous, prev, seq)
+}
+
+// createTypedNode builds and signs a node. Large payloads are moved to chunks
+// by the DAG before signing, so the signature covers their hash.
+func (d *Graph) createTypedNode(ctx context.Context, nodeType string, node NodeData, keyRoot string,
+	previous *dag.Node, prev string, seq int64) (*dag.Node, error) {
+	addr := d.addr
 	n := dag.NewNode()
+	n.Type = nodeType
 	n.Data = node.Data
 	if prev != "" {
 		n.Previous = prev
 	}
 	n.Seq = seq
+	n.Skips = dag.ComputeSkips(previous, prev, seq)
 	n.Address = addr.Address
 	n.PubKey = addr.Keys.PublicKey
 	n.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	n.Branches = node.Branches
+	n.Parents = node.Parents
 	n.Branch = node.Branch
 	n.BranchRoot = keyRoot
-	er := n.Sign(addr.Keys.ToEcdsaPrivateKey())
+	clock, er := d.da.NextClock(ctx, n)
+	if er != nil {
+		return nil, er
+	}
+	n.Clock = clock
+	if node.DataReader != nil {
+		er = d.da.PrepareDataFrom(ctx, n, node.DataReader)
+	} else {
+		er = d.da.PrepareData(ctx, n)
+	}
+	if er != nil {
+		return nil, er
+	}
+	er = n.Sign(addr.Keys.ToEcdsaPrivateKey())
 	if er != nil {
 		return nil, er
 	}
 	return n, nil
 }
+
+// nextSeq returns the sequence number of a node appended to branch after last.
+// The first node of a branch has seq 1, unless the branch continues the branch
+// of its root.
+func nextSeq(keyRoot, lastKey string, last *dag.Node, branch string) int64 {
+	if lastKey == keyRoot && last.Branch != branch {
+		return 1
+	}
+	return last.Seq + 1
+}
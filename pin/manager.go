@@ -0,0 +1,255 @@
+package pin
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// Manager keeps the content of tracked graphs pinned in a data store and
+// unpins content no longer reachable from them. Graphs are tracked by address,
+// keeping every node of every branch, or by branch root, keeping the node and
+// the branches rooted at it.
+//
+// The Manager only unpins what it pinned itself, so pins made by others, e.g.
+// on an IPFS node shared with other applications, are left alone. Its pins
+// are kept in memory: a new Manager does not unpin what an earlier one pinned.
+//
+// When the data store links nodes at paths (see datastore.PathLinker), as the
+// IPFS one does in MFS, the links of the nodes of tracked addresses that are
+// not reachable, like the nodes stored by failed appends, are removed too, so
+// their blocks can be garbage collected.
+type Manager struct {
+	mtx         sync.Mutex
+	da          dag.DagInterface
+	pinner      datastore.Pinner
+	addresses   map[string]bool
+	roots       map[string]bool
+	owned       map[string]bool
+	orphans     map[string]bool
+	orphanLinks map[string]bool
+	usage       map[string]int64
+}
+
+// Report describes the changes made by a Sync.
+type Report struct {
+	// Pinned lists the keys pinned by the sync.
+	Pinned []string
+	// Unpinned lists the keys unpinned by the sync.
+	Unpinned []string
+	// Unlinked lists the paths of unreachable nodes unlinked by the sync.
+	Unlinked []string
+	// Usage maps every tracked address to the bytes its content takes.
+	Usage map[string]int64
+}
+
+// NewManager creates a Manager reading graphs through da and pinning their
+// content with pinner, usually the data store da persists to.
+func NewManager(da dag.DagInterface, pinner datastore.Pinner) *Manager {
+	return &Manager{
+		da:          da,
+		pinner:      pinner,
+		addresses:   map[string]bool{},
+		roots:       map[string]bool{},
+		owned:       map[string]bool{},
+		orphans:     map[string]bool{},
+		orphanLinks: map[string]bool{},
+		usage:       map[string]int64{},
+	}
+}
+
+// TrackAddress keeps the whole graph of addr pinned from the next Sync on.
+func (m *Manager) TrackAddress(addr string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.addresses[addr] = true
+}
+
+// UntrackAddress stops keeping the graph of addr. Its content is unpinned by
+// the following syncs unless reachable from another tracked graph.
+func (m *Manager) UntrackAddress(addr string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.addresses, addr)
+}
+
+// TrackRoot keeps the node with key rootKey and the branches rooted at it,
+// recursively, pinned from the next Sync on.
+func (m *Manager) TrackRoot(rootKey string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.roots[rootKey] = true
+}
+
+// UntrackRoot stops keeping the branches rooted at the node with key rootKey.
+func (m *Manager) UntrackRoot(rootKey string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.roots, rootKey)
+}
+
+// Sync walks the tracked graphs, pins every node and blob reachable from them
+// and unpins the content it pinned that is not. Content is only unpinned, and
+// node links only removed, once two consecutive syncs found them unreachable,
+// so the nodes of an append still in progress, stored but not yet linked from
+// a branch head, are not lost. If a tracked graph can't be walked nothing is
+// unpinned and the error is returned. Tracked addresses without a graph yet
+// are skipped.
+func (m *Manager) Sync(ctx context.Context) (*Report, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	reachable := map[string]bool{}
+	usage := map[string]int64{}
+	counted := map[string]map[string]bool{}
+	visit := func(addr, rootKey string) error {
+		if counted[addr] == nil {
+			counted[addr] = map[string]bool{}
+		}
+		return m.da.WalkKeys(ctx, rootKey, func(key string) error {
+			reachable[key] = true
+			if counted[addr][key] {
+				return nil
+			}
+			counted[addr][key] = true
+			size, er := m.pinner.Size(ctx, key)
+			if er != nil {
+				return er
+			}
+			usage[addr] += size
+			return nil
+		})
+	}
+	for _, addr := range sortedKeys(m.addresses) {
+		_, rootKey, er := m.da.GetRoot(ctx, addr)
+		if errors.Is(er, dag.ErrNodeNotFound) || errors.Is(er, resolver.ErrNotFound) {
+			continue
+		}
+		if er != nil {
+			return nil, er
+		}
+		if er := visit(addr, rootKey); er != nil {
+			return nil, er
+		}
+	}
+	for _, rootKey := range sortedKeys(m.roots) {
+		root, er := m.da.Get(ctx, rootKey)
+		if er != nil {
+			return nil, er
+		}
+		if er := visit(root.Address, rootKey); er != nil {
+			return nil, er
+		}
+	}
+
+	pins, er := m.pinner.Pins(ctx)
+	if er != nil {
+		return nil, er
+	}
+	pinned := make(map[string]bool, len(pins))
+	for _, key := range pins {
+		pinned[key] = true
+	}
+	for key := range m.owned {
+		if !pinned[key] {
+			// Unpinned by someone else.
+			delete(m.owned, key)
+		}
+	}
+
+	report := &Report{Usage: usage}
+	for _, key := range sortedKeys(reachable) {
+		if pinned[key] {
+			continue
+		}
+		if er := m.pinner.Pin(ctx, key); er != nil {
+			return nil, er
+		}
+		m.owned[key] = true
+		report.Pinned = append(report.Pinned, key)
+	}
+	orphans := map[string]bool{}
+	for _, key := range sortedKeys(m.owned) {
+		if reachable[key] {
+			continue
+		}
+		if !m.orphans[key] {
+			orphans[key] = true
+			continue
+		}
+		if er := m.pinner.Unpin(ctx, key); er != nil {
+			return nil, er
+		}
+		delete(m.owned, key)
+		report.Unpinned = append(report.Unpinned, key)
+	}
+	m.orphans = orphans
+
+	orphanLinks, er := m.unlinkOrphans(ctx, reachable, report)
+	if er != nil {
+		return nil, er
+	}
+	m.orphanLinks = orphanLinks
+	m.usage = usage
+	return report, nil
+}
+
+// unlinkOrphans removes the links of the nodes of tracked addresses found
+// unreachable by the previous sync too, and returns the links found
+// unreachable now for the first time.
+func (m *Manager) unlinkOrphans(ctx context.Context, reachable map[string]bool, report *Report) (map[string]bool, error) {
+	orphans := map[string]bool{}
+	linker, ok := m.pinner.(datastore.PathLinker)
+	if !ok {
+		return orphans, nil
+	}
+	var unlink []string
+	for _, addr := range sortedKeys(m.addresses) {
+		for link, er := range m.da.NodeLinks(ctx, addr) {
+			if er != nil {
+				return nil, er
+			}
+			if reachable[link.Key] {
+				continue
+			}
+			if !m.orphanLinks[link.Path] {
+				orphans[link.Path] = true
+				continue
+			}
+			unlink = append(unlink, link.Path)
+		}
+	}
+	for _, p := range unlink {
+		if er := linker.Unlink(ctx, p); er != nil {
+			return nil, er
+		}
+		report.Unlinked = append(report.Unlinked, p)
+	}
+	return orphans, nil
+}
+
+// Usage returns the bytes taken by the content of every tracked address, as
+// found by the last Sync.
+func (m *Manager) Usage() map[string]int64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	usage := make(map[string]int64, len(m.usage))
+	for addr, size := range m.usage {
+		usage[addr] = size
+	}
+	return usage
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+package pin_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/graph"
+	"github.com/msaldanha/setinstone/pin"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Manager", func() {
+	var ctx context.Context
+	var store datastore.DataStore
+	var pinner datastore.Pinner
+	var da *dag.Dag
+	var res resolver.Resolver
+
+	newGraph := func() (*address.Address, []string) {
+		addr, _ := address.NewAddressWithKeys()
+		Expect(res.Manage(addr)).To(BeNil())
+		gr := graph.New(addr, da, nil)
+		var keys []string
+		for _, data := range [][]byte{[]byte("first " + addr.Address), []byte(strings.Repeat(addr.Address, 10)), []byte("last " + addr.Address)} {
+			n, er := gr.Append(ctx, "", graph.NodeData{Branch: "main", Data: data})
+			Expect(er).To(BeNil())
+			for _, key := range append([]string{n.Key}, n.DataChunks...) {
+				if !slices.Contains(keys, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+		return addr, keys
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		store = datastore.NewLocalFileStore()
+		pinner = store.(datastore.Pinner)
+		res = resolver.NewLocalResolver()
+		da = dag.NewDag("test-pin", store, res, dag.WithMaxInlineDataSize(100), dag.WithDataChunkSize(200))
+	})
+
+	It("Should pin tracked graphs and unpin orphans", func() {
+		addr, keys := newGraph()
+		other, otherKeys := newGraph()
+		foreign, _, er := store.Put(ctx, []byte("foreign"), nil)
+		Expect(er).To(BeNil())
+		Expect(pinner.Pin(ctx, foreign)).To(BeNil())
+
+		m := pin.NewManager(da, pinner)
+		m.TrackAddress(addr.Address)
+		unknown, _ := address.NewAddressWithKeys()
+		m.TrackAddress(unknown.Address)
+
+		report, er := m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Pinned).To(ContainElements(keys))
+		Expect(report.Pinned).NotTo(ContainElements(otherKeys[0]))
+		Expect(report.Unpinned).To(BeEmpty())
+		Expect(report.Usage).To(HaveLen(1))
+		Expect(report.Usage[addr.Address]).To(BeNumerically(">", 500))
+		Expect(m.Usage()).To(Equal(report.Usage))
+
+		report, er = m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Pinned).To(BeEmpty())
+		Expect(report.Unpinned).To(BeEmpty())
+
+		_, otherRootKey, er := da.GetRoot(ctx, other.Address)
+		Expect(er).To(BeNil())
+		m.TrackRoot(otherRootKey)
+		m.UntrackAddress(addr.Address)
+		report, er = m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Pinned).To(ContainElements(otherKeys))
+		Expect(report.Unpinned).To(BeEmpty())
+		Expect(report.Usage).To(HaveKey(other.Address))
+
+		report, er = m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Unpinned).To(ContainElements(keys))
+		pins, er := pinner.Pins(ctx)
+		Expect(er).To(BeNil())
+		Expect(pins).To(ConsistOf(append(pinnedKeys(ctx, da, otherRootKey), foreign)))
+	})
+
+	It("Should unlink nodes no branch references", func() {
+		addr, _ := newGraph()
+		root, rootKey, er := da.GetRoot(ctx, addr.Address)
+		Expect(er).To(BeNil())
+
+		// A replica sharing the data store stores a node no branch of the
+		// graph references, as an append losing a race does.
+		replicaRes := resolver.NewLocalResolver()
+		Expect(replicaRes.Manage(addr)).To(BeNil())
+		replica := dag.NewDag("test-pin", store, replicaRes)
+		_, er = replica.SetRoot(ctx, root)
+		Expect(er).To(BeNil())
+		orphan, er := graph.New(addr, replica, nil).Append(ctx, rootKey, graph.NodeData{Branch: "main", Data: []byte("orphan")})
+		Expect(er).To(BeNil())
+
+		linked := func() []string {
+			var keys []string
+			for link, er := range da.NodeLinks(ctx, addr.Address) {
+				Expect(er).To(BeNil())
+				keys = append(keys, link.Key)
+			}
+			return keys
+		}
+		Expect(linked()).To(ContainElement(orphan.Key))
+
+		m := pin.NewManager(da, pinner)
+		m.TrackAddress(addr.Address)
+		report, er := m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Unlinked).To(BeEmpty())
+		report, er = m.Sync(ctx)
+		Expect(er).To(BeNil())
+		Expect(report.Unlinked).To(HaveLen(1))
+		Expect(linked()).NotTo(ContainElement(orphan.Key))
+		Expect(linked()).To(ConsistOf(nodeKeys(ctx, da, rootKey)))
+	})
+})
+
+func nodeKeys(ctx context.Context, da *dag.Dag, rootKey string) []string {
+	root, er := da.Get(ctx, rootKey)
+	Expect(er).To(BeNil())
+	var keys []string
+	Expect(da.WalkAddress(ctx, root.Address, func(key string, node *dag.Node) error {
+		keys = append(keys, key)
+		return nil
+	})).To(BeNil())
+	return keys
+}
+
+func pinnedKeys(ctx context.Context, da *dag.Dag, rootKey string) []string {
+	var keys []string
+	Expect(da.WalkKeys(ctx, rootKey, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})).To(BeNil())
+	return keys
+}
@@ -0,0 +1,13 @@
+package pin_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pin Suite")
+}
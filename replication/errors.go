@@ -0,0 +1,7 @@
+package replication
+
+import "errors"
+
+var (
+	ErrInvalidResponse = errors.New("invalid replication response")
+)
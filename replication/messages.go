@@ -0,0 +1,55 @@
+package replication
+
+import "encoding/json"
+
+const (
+	// HeadsEvent carries a HeadsRequest: a peer announcing the heads it knows
+	// for an address and asking for the nodes it lacks.
+	HeadsEvent = "replication-heads"
+	// NodesEvent carries a NodesResponse: a batch of the nodes a peer lacks.
+	NodesEvent = "replication-nodes"
+)
+
+// HeadsRequest asks the peers of a topic for the nodes of Address that are not
+// ancestors of Heads. ID identifies the request in the responses.
+type HeadsRequest struct {
+	ID      string   `json:"id"`
+	Address string   `json:"address"`
+	Heads   []string `json:"heads,omitempty"`
+}
+
+// NodesResponse is one of the batches answering the HeadsRequest referenced by
+// Reference. Batches of a response are numbered from zero by Seq and their
+// nodes sorted so every node comes after the nodes it references. The last
+// batch sets Last and carries the Heads of the responder.
+type NodesResponse struct {
+	Reference string       `json:"reference"`
+	Responder string       `json:"responder"`
+	Address   string       `json:"address"`
+	Seq       int          `json:"seq"`
+	Nodes     []NodeRecord `json:"nodes,omitempty"`
+	Heads     []string     `json:"heads,omitempty"`
+	Last      bool         `json:"last,omitempty"`
+}
+
+// NodeRecord is a node as stored by the responder, under Key.
+type NodeRecord struct {
+	Key  string `json:"key"`
+	Data []byte `json:"data"`
+}
+
+func (r *HeadsRequest) ToJson() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *HeadsRequest) FromJson(js []byte) error {
+	return json.Unmarshal(js, r)
+}
+
+func (r *NodesResponse) ToJson() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *NodesResponse) FromJson(js []byte) error {
+	return json.Unmarshal(js, r)
+}
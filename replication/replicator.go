@@ -0,0 +1,320 @@
+package replication
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/cache"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/event"
+)
+
+// DefaultMaxBatchSize is the default limit, in bytes of node data, of the
+// batches a response is split into.
+const DefaultMaxBatchSize = 256 * 1024
+
+// seenRequests is how many request IDs are remembered to drop duplicates.
+const seenRequests = 1024
+
+// Replicator keeps copies of remote DAGs up to date by exchanging events with
+// the peers of a topic. Sync announces the heads known for an address and
+// stores the nodes peers send back, after verifying each of them with
+// dag.Dag.VerifyNode. Meanwhile, the Replicator answers the requests of other
+// peers for the addresses its own DAG has, sending only the nodes they lack.
+// Requests already seen, and requests for an address a response is being sent
+// for, are dropped, so peers can't make it answer the same work repeatedly;
+// a requester whose request was dropped gets no answer and may sync again.
+//
+// Nodes are stored as the responder stored them, so peers must use the same
+// kind of data store. Payload chunks are not sent; they are fetched from the
+// data store when opened.
+type Replicator struct {
+	id           string
+	da           dag.DagInterface
+	evm          event.Manager
+	logger       *zap.Logger
+	maxBatchSize int
+
+	mtx        sync.Mutex
+	heads      map[string][]string
+	pending    map[string]*pendingSync
+	seen       cache.Cache[bool]
+	responding map[string]bool
+	subHeads   *event.Subscription
+	subNodes   *event.Subscription
+}
+
+// Result describes the outcome of a Sync.
+type Result struct {
+	// Received lists the keys of the nodes received and stored, in order.
+	Received []string
+	// Heads lists the heads of the responder, now known locally.
+	Heads []string
+}
+
+type pendingSync struct {
+	responder string
+	responses chan NodesResponse
+	done      chan struct{}
+}
+
+// Option configures optional behaviour of a Replicator.
+type Option func(*Replicator)
+
+// WithLogger sets the logger of the Replicator.
+func WithLogger(logger *zap.Logger) Option {
+	return func(r *Replicator) {
+		r.logger = logger.Named("Replicator")
+	}
+}
+
+// WithMaxBatchSize limits the node data, in bytes, sent in a single event. A
+// node larger than the limit is sent alone.
+func WithMaxBatchSize(size int) Option {
+	return func(r *Replicator) {
+		if size > 0 {
+			r.maxBatchSize = size
+		}
+	}
+}
+
+// NewReplicator creates a Replicator storing nodes in da and exchanging
+// events through evm, and starts answering the requests of other peers.
+func NewReplicator(da dag.DagInterface, evm event.Manager, options ...Option) *Replicator {
+	r := &Replicator{
+		id:           uuid.New().String(),
+		da:           da,
+		evm:          evm,
+		logger:       zap.NewNop(),
+		maxBatchSize: DefaultMaxBatchSize,
+		heads:        map[string][]string{},
+		pending:      map[string]*pendingSync{},
+		seen:         cache.NewLRUCache[bool](seenRequests, 0),
+		responding:   map[string]bool{},
+	}
+	for _, option := range options {
+		option(r)
+	}
+	r.subHeads = evm.On(HeadsEvent, r.handleHeads)
+	r.subNodes = evm.On(NodesEvent, r.handleNodes)
+	return r
+}
+
+// Close stops answering requests and receiving responses.
+func (r *Replicator) Close() {
+	r.subHeads.Unsubscribe()
+	r.subNodes.Unsubscribe()
+}
+
+// Heads returns the heads known for addr, as left by the last Sync or set with
+// SetHeads.
+func (r *Replicator) Heads(addr string) []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string(nil), r.heads[addr]...)
+}
+
+// SetHeads sets the heads known for addr, e.g. the ones of a DAG restored
+// from an archive, so the next Sync only asks for the nodes that follow them.
+func (r *Replicator) SetHeads(addr string, heads []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.heads[addr] = append([]string(nil), heads...)
+}
+
+// Sync asks the peers of the topic for the nodes of addr missing locally and
+// stores them, in the order they are sent, until the first peer answering
+// finishes its response or ctx is done. The heads announced are the ones
+// known for addr, or, if none are, the heads of the local DAG. Peers without a DAG for addr do not
+// answer, so ctx should carry a deadline. Nodes stored before an error are
+// listed in the returned Result and kept.
+func (r *Replicator) Sync(ctx context.Context, addr string) (*Result, error) {
+	id := uuid.New().String()
+	p := &pendingSync{
+		responses: make(chan NodesResponse, 16),
+		done:      make(chan struct{}),
+	}
+	r.mtx.Lock()
+	r.pending[id] = p
+	r.mtx.Unlock()
+	defer func() {
+		r.mtx.Lock()
+		delete(r.pending, id)
+		r.mtx.Unlock()
+		close(p.done)
+	}()
+
+	req := HeadsRequest{ID: id, Address: addr, Heads: r.knownHeads(ctx, addr)}
+	data, er := req.ToJson()
+	if er != nil {
+		return nil, er
+	}
+	if er := r.evm.Emit(HeadsEvent, data); er != nil {
+		return nil, er
+	}
+
+	result := &Result{}
+	for seq := 0; ; seq++ {
+		var resp NodesResponse
+		select {
+		case resp = <-p.responses:
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+		if resp.Seq != seq || resp.Address != addr {
+			return result, ErrInvalidResponse
+		}
+		for _, rec := range resp.Nodes {
+			if er := r.da.PutNodeBytes(ctx, rec.Key, rec.Data); er != nil {
+				return result, er
+			}
+			result.Received = append(result.Received, rec.Key)
+		}
+		if !resp.Last {
+			continue
+		}
+		for _, head := range resp.Heads {
+			if _, er := r.da.Get(ctx, head); er != nil {
+				return result, ErrInvalidResponse
+			}
+		}
+		r.SetHeads(addr, resp.Heads)
+		result.Heads = resp.Heads
+		return result, nil
+	}
+}
+
+// knownHeads returns the heads known for addr, falling back to the heads of
+// the local DAG, e.g. after a restart. Nil is returned if there are none.
+func (r *Replicator) knownHeads(ctx context.Context, addr string) []string {
+	if heads := r.Heads(addr); len(heads) > 0 {
+		return heads
+	}
+	heads, er := r.da.Heads(ctx, addr)
+	if er != nil {
+		return nil
+	}
+	return heads
+}
+
+func (r *Replicator) handleHeads(ev event.Event) {
+	req := HeadsRequest{}
+	if er := req.FromJson(ev.Data()); er != nil {
+		r.logger.Error("Invalid heads request", zap.Error(er))
+		return
+	}
+	if !r.startResponse(req) {
+		r.logger.Debug("Dropping heads request", zap.String("address", req.Address), zap.String("id", req.ID))
+		return
+	}
+	go func() {
+		defer r.endResponse(req)
+		r.respond(context.Background(), req)
+	}()
+}
+
+// startResponse tells whether req must be answered: it was not seen before
+// and no response is being sent for its address.
+func (r *Replicator) startResponse(req HeadsRequest) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, seen, _ := r.seen.Get(req.ID); seen {
+		return false
+	}
+	_ = r.seen.Add(req.ID, true)
+	if r.responding[req.Address] {
+		return false
+	}
+	r.responding[req.Address] = true
+	return true
+}
+
+func (r *Replicator) endResponse(req HeadsRequest) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.responding, req.Address)
+}
+
+// respond sends the nodes the requester lacks, if the DAG of the requested
+// address is known. Only the nodes following the requester heads are read.
+func (r *Replicator) respond(ctx context.Context, req HeadsRequest) {
+	logger := r.logger.With(zap.String("address", req.Address), zap.String("id", req.ID))
+	root, _, er := r.da.GetRoot(ctx, req.Address)
+	if er != nil || root == nil {
+		logger.Debug("Not answering heads request for unknown address")
+		return
+	}
+	missing, er := r.da.MissingNodes(ctx, req.Address, req.Heads)
+	if er != nil {
+		logger.Error("Failed to find missing nodes", zap.Error(er))
+		return
+	}
+	heads, er := r.da.Heads(ctx, req.Address)
+	if er != nil {
+		logger.Error("Failed to find heads", zap.Error(er))
+		return
+	}
+
+	resp := NodesResponse{Reference: req.ID, Responder: r.id, Address: req.Address}
+	size := 0
+	for _, key := range missing {
+		data, er := r.da.GetNodeBytes(ctx, key)
+		if er != nil {
+			logger.Error("Failed to read node", zap.String("key", key), zap.Error(er))
+			return
+		}
+		if size > 0 && size+len(data) > r.maxBatchSize {
+			if er := r.send(resp); er != nil {
+				logger.Error("Failed to send nodes", zap.Error(er))
+				return
+			}
+			resp.Seq++
+			resp.Nodes = nil
+			size = 0
+		}
+		resp.Nodes = append(resp.Nodes, NodeRecord{Key: key, Data: data})
+		size += len(data)
+	}
+	resp.Heads = heads
+	resp.Last = true
+	if er := r.send(resp); er != nil {
+		logger.Error("Failed to send nodes", zap.Error(er))
+		return
+	}
+	logger.Debug("Heads request answered", zap.Int("nodes", len(missing)))
+}
+
+func (r *Replicator) send(resp NodesResponse) error {
+	data, er := resp.ToJson()
+	if er != nil {
+		return er
+	}
+	return r.evm.Emit(NodesEvent, data)
+}
+
+// handleNodes hands a response batch to the Sync waiting for it. Only the
+// batches of the first responder are accepted.
+func (r *Replicator) handleNodes(ev event.Event) {
+	resp := NodesResponse{}
+	if er := resp.FromJson(ev.Data()); er != nil {
+		r.logger.Error("Invalid nodes response", zap.Error(er))
+		return
+	}
+	r.mtx.Lock()
+	p, found := r.pending[resp.Reference]
+	if found && p.responder == "" {
+		p.responder = resp.Responder
+	}
+	accepted := found && p.responder == resp.Responder
+	r.mtx.Unlock()
+	if !accepted {
+		return
+	}
+	select {
+	case p.responses <- resp:
+	case <-p.done:
+	}
+}
@@ -0,0 +1,264 @@
+package replication_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/dag"
+	"github.com/msaldanha/setinstone/datastore"
+	"github.com/msaldanha/setinstone/event"
+	"github.com/msaldanha/setinstone/graph"
+	"github.com/msaldanha/setinstone/replication"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+var _ = Describe("Replicator", func() {
+	var ctx context.Context
+	var bus *event.MemoryBus
+	var addr *address.Address
+	var source *dag.Dag
+	var sourceRes resolver.Resolver
+	var gr *graph.Graph
+
+	newDag := func(managed *address.Address) *dag.Dag {
+		res := resolver.NewLocalResolver()
+		if managed != nil {
+			_ = res.Manage(managed)
+		}
+		return dag.NewDag("test-replication", datastore.NewLocalFileStore(), res)
+	}
+
+	appendNodes := func(branch string, count int) {
+		for i := 0; i < count; i++ {
+			_, er := gr.Append(ctx, "", graph.NodeData{Branch: branch, Data: []byte(branch)})
+			Expect(er).To(BeNil())
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		bus = event.NewMemoryBus()
+		addr, _ = address.NewAddressWithKeys()
+		sourceRes = resolver.NewLocalResolver()
+		Expect(sourceRes.Manage(addr)).To(BeNil())
+		source = dag.NewDag("test-replication", datastore.NewLocalFileStore(), sourceRes)
+		gr = graph.New(addr, source, nil)
+		_, er := gr.Append(ctx, "", graph.NodeData{Branch: "main", Branches: []string{"main", "drafts"}})
+		Expect(er).To(BeNil())
+		appendNodes("main", 3)
+		appendNodes("drafts", 2)
+	})
+
+	AfterEach(func() {
+		bus.Close()
+	})
+
+	It("Should send only the nodes the requester lacks", func() {
+		replication.NewReplicator(source, bus.Manager(), replication.WithMaxBatchSize(1))
+		target := newDag(nil)
+		r := replication.NewReplicator(target, bus.Manager())
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		result, er := r.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(HaveLen(6))
+		heads, er := source.Heads(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(heads).To(HaveLen(2))
+		Expect(result.Heads).To(Equal(heads))
+		Expect(r.Heads(addr.Address)).To(Equal(heads))
+		for _, key := range result.Received {
+			node, er := target.Get(ctx, key)
+			Expect(er).To(BeNil())
+			Expect(node.Address).To(Equal(addr.Address))
+		}
+
+		appendNodes("drafts", 2)
+		result, er = r.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(HaveLen(2))
+
+		result, er = r.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(BeEmpty())
+	})
+
+	It("Should announce the heads of the local DAG after a restart", func() {
+		replication.NewReplicator(source, bus.Manager())
+		target := newDag(addr)
+		r := replication.NewReplicator(target, bus.Manager())
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		result, er := r.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(HaveLen(6))
+		r.Close()
+
+		restarted := replication.NewReplicator(target, bus.Manager())
+		Expect(restarted.Heads(addr.Address)).To(BeEmpty())
+		result, er = restarted.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(BeEmpty())
+	})
+
+	It("Should sync a followed address without resolving names its owner lacks", func() {
+		replication.NewReplicator(source, bus.Manager())
+		remote := &remoteResolver{Resolver: resolver.NewLocalResolver(), owner: sourceRes}
+		target := dag.NewDag("test-replication", datastore.NewLocalFileStore(), remote)
+		r := replication.NewReplicator(target, bus.Manager())
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		result, er := r.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(HaveLen(6))
+		r.Close()
+
+		restarted := replication.NewReplicator(target, bus.Manager())
+		result, er = restarted.Sync(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		Expect(result.Received).To(BeEmpty())
+		Expect(remote.unanswered).To(BeZero())
+	})
+
+	It("Should answer a request only once", func() {
+		replication.NewReplicator(source, bus.Manager())
+		evm := bus.Manager()
+		var mtx sync.Mutex
+		answers := 0
+		evm.On(replication.NodesEvent, func(ev event.Event) {
+			resp := replication.NodesResponse{}
+			Expect(resp.FromJson(ev.Data())).To(BeNil())
+			if resp.Last {
+				mtx.Lock()
+				answers++
+				mtx.Unlock()
+			}
+		})
+		req := replication.HeadsRequest{ID: "request", Address: addr.Address}
+		data, er := req.ToJson()
+		Expect(er).To(BeNil())
+		Expect(evm.Emit(replication.HeadsEvent, data)).To(BeNil())
+		Expect(evm.Emit(replication.HeadsEvent, data)).To(BeNil())
+
+		count := func() int {
+			mtx.Lock()
+			defer mtx.Unlock()
+			return answers
+		}
+		Eventually(count).Should(Equal(1))
+		Expect(evm.Emit(replication.HeadsEvent, data)).To(BeNil())
+		Consistently(count, 200*time.Millisecond).Should(Equal(1))
+	})
+
+	It("Should read only the nodes following the requester heads", func() {
+		counting := &countingStore{DataStore: datastore.NewLocalFileStore()}
+		res := resolver.NewLocalResolver()
+		Expect(res.Manage(addr)).To(BeNil())
+		da := dag.NewDag("test-replication", counting, res)
+		g := graph.New(addr, da, nil)
+		_, er := g.Append(ctx, "", graph.NodeData{Branch: "main", Branches: []string{"main"}})
+		Expect(er).To(BeNil())
+		for i := 0; i < 50; i++ {
+			_, er = g.Append(ctx, "", graph.NodeData{Branch: "main", Data: []byte("main")})
+			Expect(er).To(BeNil())
+		}
+		heads, er := da.Heads(ctx, addr.Address)
+		Expect(er).To(BeNil())
+		last, er := g.Append(ctx, "", graph.NodeData{Branch: "main", Data: []byte("last")})
+		Expect(er).To(BeNil())
+
+		counting.gets = 0
+		missing, er := da.MissingNodes(ctx, addr.Address, heads)
+		Expect(er).To(BeNil())
+		Expect(missing).To(Equal([]string{last.Key}))
+		Expect(counting.gets).To(BeNumerically("<", 10))
+	})
+
+	It("Should NOT get answers for unknown addresses", func() {
+		replication.NewReplicator(source, bus.Manager())
+		r := replication.NewReplicator(newDag(nil), bus.Manager())
+		unknown, _ := address.NewAddressWithKeys()
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, er := r.Sync(ctx, unknown.Address)
+		Expect(er).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("Should NOT store nodes that do not verify", func() {
+		evm := bus.Manager()
+		evm.On(replication.HeadsEvent, func(ev event.Event) {
+			req := replication.HeadsRequest{}
+			Expect(req.FromJson(ev.Data())).To(BeNil())
+			missing, er := source.MissingNodes(ctx, req.Address, req.Heads)
+			Expect(er).To(BeNil())
+			resp := replication.NodesResponse{Reference: req.ID, Responder: "evil", Address: req.Address, Last: true}
+			for _, key := range missing {
+				data, er := source.GetNodeBytes(ctx, key)
+				Expect(er).To(BeNil())
+				resp.Nodes = append(resp.Nodes, replication.NodeRecord{Key: key, Data: data})
+			}
+			node := &dag.Node{}
+			Expect(node.FromCbor(resp.Nodes[2].Data)).To(BeNil())
+			node.Data = []byte("tampered")
+			resp.Nodes[2].Data, er = node.ToCbor()
+			Expect(er).To(BeNil())
+			data, er := resp.ToJson()
+			Expect(er).To(BeNil())
+			Expect(evm.Emit(replication.NodesEvent, data)).To(BeNil())
+		})
+		target := newDag(nil)
+		r := replication.NewReplicator(target, bus.Manager())
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		result, er := r.Sync(ctx, addr.Address)
+		Expect(er).To(Equal(dag.ErrNodeSignatureDoesNotMatch))
+		Expect(result.Received).To(HaveLen(2))
+		Expect(r.Heads(addr.Address)).To(BeEmpty())
+	})
+})
+
+type countingStore struct {
+	datastore.DataStore
+	gets int
+}
+
+func (c *countingStore) Get(ctx context.Context, key string) (io.Reader, error) {
+	c.gets++
+	return c.DataStore.Get(ctx, key)
+}
+
+// remoteResolver resolves the names of the addresses it doesn't manage as the
+// IPFS resolver does: names the owner has are answered, and queries for other
+// names go unanswered until they time out.
+type remoteResolver struct {
+	resolver.Resolver
+	owner      resolver.Resolver
+	unanswered int
+}
+
+func (r *remoteResolver) Resolve(ctx context.Context, name string) (string, error) {
+	if r.IsManaged(strings.Split(name, "/")[1]) {
+		return r.Resolver.Resolve(ctx, name)
+	}
+	value, er := r.owner.Resolve(ctx, name)
+	if er == nil {
+		return value, nil
+	}
+	r.unanswered++
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	return "", ctx.Err()
+}
@@ -7,4 +7,8 @@ import (
 type Backend interface {
 	Add(ctx context.Context, name, value string) error
 	Resolve(ctx context.Context, name string) (string, error)
+	// CompareAndSwap atomically sets name to value only if it currently
+	// resolves to expected. An empty expected means name must not exist.
+	// Returns ErrValueChanged otherwise.
+	CompareAndSwap(ctx context.Context, name, expected, value string) error
 }
@@ -81,3 +81,20 @@ func (r *BoltBackend) Resolve(ctx context.Context, name string) (string, error)
 
 	return value, nil
 }
+
+// CompareAndSwap associates `name` with `value` only if `name` currently resolves to `expected`.
+// An empty `expected` means `name` must not be set yet. The check and the update run in a single transaction.
+func (r *BoltBackend) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(namesBucket))
+		if b == nil {
+			return nil
+		}
+
+		if string(b.Get([]byte(name))) != expected {
+			return ErrValueChanged
+		}
+
+		return b.Put([]byte(name), []byte(value))
+	})
+}
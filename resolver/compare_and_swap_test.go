@@ -0,0 +1,173 @@
+package resolver_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/resolver"
+)
+
+// casBackend is what the CompareAndSwap behaviour is checked against: every
+// Backend, and the local Resolver.
+type casBackend interface {
+	Resolve(ctx context.Context, name string) (string, error)
+	CompareAndSwap(ctx context.Context, name, expected, value string) error
+}
+
+var _ = Describe("CompareAndSwap", func() {
+	var ctx context.Context
+	var addr *address.Address
+	var name string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		addr, _ = address.NewAddressWithKeys()
+		name = "/" + addr.Address + "/test/dag/main"
+	})
+
+	behaves := func(newBackend func() casBackend, values func(n int) []string) {
+		var backend casBackend
+		var v []string
+
+		BeforeEach(func() {
+			backend = newBackend()
+			v = values(3)
+		})
+
+		It("Should set an absent name when expecting it to be absent", func() {
+			Expect(backend.CompareAndSwap(ctx, name, "", v[0])).To(BeNil())
+			Expect(backend.Resolve(ctx, name)).To(Equal(v[0]))
+		})
+
+		It("Should swap when the current value matches", func() {
+			Expect(backend.CompareAndSwap(ctx, name, "", v[0])).To(BeNil())
+			Expect(backend.CompareAndSwap(ctx, name, v[0], v[1])).To(BeNil())
+			Expect(backend.Resolve(ctx, name)).To(Equal(v[1]))
+		})
+
+		It("Should NOT swap when the current value does not match", func() {
+			Expect(backend.CompareAndSwap(ctx, name, "", v[0])).To(BeNil())
+			Expect(backend.CompareAndSwap(ctx, name, v[1], v[2])).To(Equal(resolver.ErrValueChanged))
+			Expect(backend.CompareAndSwap(ctx, name, "", v[2])).To(Equal(resolver.ErrValueChanged))
+			Expect(backend.Resolve(ctx, name)).To(Equal(v[0]))
+		})
+
+		It("Should NOT swap an absent name when expecting a value", func() {
+			Expect(backend.CompareAndSwap(ctx, name, v[0], v[1])).To(Equal(resolver.ErrValueChanged))
+			_, err := backend.Resolve(ctx, name)
+			Expect(err).To(Equal(resolver.ErrNotFound))
+		})
+
+		It("Should let a single one of concurrent swaps win", func() {
+			Expect(backend.CompareAndSwap(ctx, name, "", v[0])).To(BeNil())
+			var wg sync.WaitGroup
+			var mtx sync.Mutex
+			won := []string{}
+			for _, value := range v[1:] {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					err := backend.CompareAndSwap(ctx, name, v[0], value)
+					if err == nil {
+						mtx.Lock()
+						won = append(won, value)
+						mtx.Unlock()
+						return
+					}
+					Expect(err).To(Equal(resolver.ErrValueChanged))
+				}()
+			}
+			wg.Wait()
+			Expect(won).To(HaveLen(1))
+			Expect(backend.Resolve(ctx, name)).To(Equal(won[0]))
+		})
+	}
+
+	plainValues := func(n int) []string {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = fmt.Sprintf("value-%d", i)
+		}
+		return values
+	}
+
+	Context("MemoryBackend", func() {
+		behaves(func() casBackend {
+			return resolver.NewMemoryBackend()
+		}, plainValues)
+	})
+
+	Context("BoltBackend", func() {
+		var dir string
+		var db *bbolt.DB
+
+		AfterEach(func() {
+			_ = db.Close()
+			_ = os.RemoveAll(dir)
+		})
+
+		behaves(func() casBackend {
+			var err error
+			dir, err = os.MkdirTemp("", "bolt-backend")
+			Expect(err).To(BeNil())
+			db, err = bbolt.Open(filepath.Join(dir, "names.db"), 0600, nil)
+			Expect(err).To(BeNil())
+			backend, err := resolver.NewBoltBackend(db)
+			Expect(err).To(BeNil())
+			return backend
+		}, plainValues)
+	})
+
+	Context("Local resolver", func() {
+		behaves(func() casBackend {
+			r := resolver.NewLocalResolver()
+			Expect(r.Manage(addr)).To(BeNil())
+			return r
+		}, plainValues)
+	})
+
+	Context("IpfsBackend", func() {
+		var values func(n int) []string
+		var node *core.IpfsNode
+
+		AfterEach(func() {
+			_ = node.Close()
+		})
+
+		behaves(func() casBackend {
+			var err error
+			node, err = core.NewNode(ctx, &core.BuildCfg{})
+			Expect(err).To(BeNil())
+			api, err := coreapi.NewCoreAPI(node)
+			Expect(err).To(BeNil())
+			// IPFS links names to content, which must exist.
+			values = func(n int) []string {
+				keys := make([]string, n)
+				for i := range keys {
+					p, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte(fmt.Sprintf("value-%d", i))))
+					Expect(err).To(BeNil())
+					keys[i] = p.RootCid().String()
+				}
+				return keys
+			}
+			backend, err := resolver.NewIpfsBackend(node, addr, zap.NewNop())
+			Expect(err).To(BeNil())
+			return backend
+		}, func(n int) []string {
+			return values(n)
+		})
+	})
+})
@@ -8,4 +8,5 @@ var (
 	ErrNoPrivateKey         = errors.New("no private key")
 	ErrUnmanagedAddress     = errors.New("unmanaged address")
 	ErrNotFound             = errors.New("not found")
+	ErrValueChanged         = errors.New("value changed")
 )
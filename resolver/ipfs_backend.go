@@ -2,12 +2,17 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	gopath "path"
+	"sync"
 
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 	"github.com/ipfs/boxo/mfs"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
 	icore "github.com/ipfs/kubo/core/coreiface"
@@ -20,6 +25,7 @@ type IpfsBackend struct {
 	ipfs     icore.CoreAPI
 	ipfsNode *core.IpfsNode
 	logger   *zap.Logger
+	mtx      sync.Mutex
 }
 
 func NewIpfsBackend(node *core.IpfsNode, signerAddr *address.Address, logger *zap.Logger) (*IpfsBackend, error) {
@@ -40,6 +46,32 @@ func NewIpfsBackend(node *core.IpfsNode, signerAddr *address.Address, logger *za
 }
 
 func (r *IpfsBackend) Add(ctx context.Context, name, value string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.add(ctx, name, value)
+}
+
+// CompareAndSwap links value under name only if name currently links to
+// expected, or does not exist when expected is empty. MFS has no conditional
+// update, so the check and the update are serialized within this backend.
+func (r *IpfsBackend) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	current := ""
+	c, er := r.lookupLink(ctx, name)
+	switch {
+	case er == nil:
+		current = c.String()
+	case !errors.Is(er, ErrNotFound):
+		return er
+	}
+	if current != expected {
+		return ErrValueChanged
+	}
+	return r.add(ctx, name, value)
+}
+
+func (r *IpfsBackend) add(ctx context.Context, name, value string) error {
 	logger := r.logger.With(zap.String("name", name), zap.String("value", value))
 	logger.Debug("Adding resolution")
 
@@ -104,13 +136,49 @@ func (r *IpfsBackend) Resolve(ctx context.Context, name string) (string, error)
 		return "", err
 	}
 
-	node, er := mfs.Lookup(r.ipfsNode.FilesRoot, name)
+	c, er := r.lookupLink(ctx, name)
 	if er != nil {
 		return "", er
 	}
-	n, er := node.GetNode()
+	return c.String(), nil
+}
+
+// lookupLink returns the CID linked under name by reading the link from its
+// parent directory. Unlike mfs.Lookup it does not load the linked node, which
+// MFS cannot do for non UnixFS nodes such as DAG-CBOR blocks.
+func (r *IpfsBackend) lookupLink(ctx context.Context, name string) (cid.Cid, error) {
+	dirName, file := gopath.Split(name)
+	parent, er := mfs.Lookup(r.ipfsNode.FilesRoot, dirName)
+	if errors.Is(er, os.ErrNotExist) {
+		return cid.Undef, ErrNotFound
+	}
 	if er != nil {
-		return "", er
+		return cid.Undef, er
+	}
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return cid.Undef, fmt.Errorf("no such file or directory: %s", dirName)
+	}
+	nd, er := pdir.GetNode()
+	if er != nil {
+		return cid.Undef, er
+	}
+	dir, er := uio.NewDirectoryFromNode(r.ipfs.Dag(), nd)
+	if er != nil {
+		return cid.Undef, er
+	}
+	found := cid.Undef
+	er = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		if l.Name == file {
+			found = l.Cid
+		}
+		return nil
+	})
+	if er != nil {
+		return cid.Undef, er
+	}
+	if !found.Defined() {
+		return cid.Undef, ErrNotFound
 	}
-	return n.Cid().String(), nil
+	return found, nil
 }
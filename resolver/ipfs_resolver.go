@@ -110,6 +110,25 @@ func (r *IpfsResolver) Add(ctx context.Context, name, value string) error {
 	return r.backend.Add(ctx, name, value)
 }
 
+// CompareAndSwap updates the resolution of name to value only if it currently
+// resolves to expected, see Backend.CompareAndSwap. Only names of managed
+// addresses can be updated.
+func (r *IpfsResolver) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	logger := r.logger.With(zap.String("name", name), zap.String("expected", expected), zap.String("value", value))
+	logger.Debug("Swapping resolution")
+	rec, er := getQueryNameRequestFromName(name)
+	if er != nil {
+		return er
+	}
+	if !r.isManaged(rec) {
+		er = ErrUnmanagedAddress
+		logger.Error("Cannot swap resolution", zap.Error(er))
+		return er
+	}
+
+	return r.backend.CompareAndSwap(ctx, name, expected, value)
+}
+
 func (r *IpfsResolver) Resolve(ctx context.Context, name string) (string, error) {
 	logger := r.logger.With(zap.String("name", name))
 	logger.Debug("Resolve")
@@ -200,13 +219,19 @@ func (r *IpfsResolver) query(ctx context.Context, rec message.Message) (message.
 	}
 }
 
-func (r *IpfsResolver) isManaged(rec message.Message) bool {
-	if res, exists, _ := r.resourceCache.Get(rec.Address); exists {
+// IsManaged tells whether addr was passed to Manage. Names of other addresses
+// are resolved by querying the network.
+func (r *IpfsResolver) IsManaged(addr string) bool {
+	if res, exists, _ := r.resourceCache.Get(addr); exists {
 		return res.addr.HasKeys()
 	}
 	return false
 }
 
+func (r *IpfsResolver) isManaged(rec message.Message) bool {
+	return r.IsManaged(rec.Address)
+}
+
 func (r *IpfsResolver) getFromCache(ctx context.Context, name string) (message.Message, error) {
 	v, ok, er := r.resolutionCache.Get(name)
 	if !ok {
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"sync"
 
 	"github.com/msaldanha/setinstone/address"
 )
@@ -9,6 +10,7 @@ import (
 type localResolver struct {
 	names     map[string]string
 	addresses map[string]*address.Address
+	mtx       sync.RWMutex
 }
 
 var _ Resolver = (*localResolver)(nil)
@@ -25,6 +27,8 @@ func (r *localResolver) Add(ctx context.Context, name, value string) error {
 	if er != nil {
 		return er
 	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 	_, found := r.addresses[rec.Address]
 	if !found {
 		return ErrUnmanagedAddress
@@ -33,11 +37,31 @@ func (r *localResolver) Add(ctx context.Context, name, value string) error {
 	return nil
 }
 
+func (r *localResolver) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	rec, er := getQueryNameRequestFromName(name)
+	if er != nil {
+		return er
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, found := r.addresses[rec.Address]
+	if !found {
+		return ErrUnmanagedAddress
+	}
+	if r.names[name] != expected {
+		return ErrValueChanged
+	}
+	r.names[name] = value
+	return nil
+}
+
 func (r *localResolver) Resolve(ctx context.Context, name string) (string, error) {
 	_, er := getQueryNameRequestFromName(name)
 	if er != nil {
 		return "", er
 	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
 	res, found := r.names[name]
 	if !found {
 		return "", ErrNotFound
@@ -49,6 +73,15 @@ func (r *localResolver) Manage(addr *address.Address) error {
 	if addr.Keys.PrivateKey == "" {
 		return ErrNoPrivateKey
 	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 	r.addresses[addr.Address] = addr
 	return nil
 }
+
+func (r *localResolver) IsManaged(addr string) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	_, found := r.addresses[addr]
+	return found
+}
@@ -2,12 +2,14 @@ package resolver
 
 import (
 	"context"
+	"sync"
 
 	"github.com/msaldanha/setinstone/cache"
 )
 
 type MemoryBackend struct {
 	cache cache.Cache[string]
+	mtx   sync.Mutex
 }
 
 var _ Backend = (*MemoryBackend)(nil)
@@ -21,6 +23,8 @@ func NewMemoryBackend() *MemoryBackend {
 
 // Add associates a provided `name` with a `value` in the database if the `name` resolves to a managed address.
 func (r *MemoryBackend) Add(ctx context.Context, name, value string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 	// Store the name-value mapping
 	return r.cache.Add(name, value)
 }
@@ -38,3 +42,21 @@ func (r *MemoryBackend) Resolve(ctx context.Context, name string) (string, error
 
 	return value, nil
 }
+
+// CompareAndSwap associates `name` with `value` only if `name` currently resolves to `expected`.
+// An empty `expected` means `name` must not be set yet.
+func (r *MemoryBackend) CompareAndSwap(ctx context.Context, name, expected, value string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	current, found, err := r.cache.Get(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		current = ""
+	}
+	if current != expected {
+		return ErrValueChanged
+	}
+	return r.cache.Add(name, value)
+}
@@ -11,7 +11,11 @@ import (
 type Resolver interface {
 	Resolve(ctx context.Context, name string) (string, error)
 	Add(ctx context.Context, name, value string) error
+	CompareAndSwap(ctx context.Context, name, expected, value string) error
 	Manage(addr *address.Address) error
+	// IsManaged tells whether the names of addr are managed, and so resolved,
+	// locally. Names of other addresses may need a network round trip.
+	IsManaged(addr string) bool
 }
 
 func getQueryNameRequestFromName(name string) (message.Message, error) {
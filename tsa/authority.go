@@ -0,0 +1,64 @@
+package tsa
+
+import (
+	"context"
+	"time"
+
+	"github.com/msaldanha/setinstone/address"
+)
+
+// Authority countersigns subjects with the current time.
+type Authority interface {
+	// Stamp returns a token attesting that subject exists now.
+	Stamp(ctx context.Context, subject string) (*Token, error)
+	// PubKey returns the hex encoded public key tokens are signed with.
+	PubKey() string
+}
+
+// LocalAuthority is an Authority signing tokens in process with its own key
+// pair, using the local clock.
+type LocalAuthority struct {
+	keys *address.KeyPair
+	now  func() time.Time
+}
+
+var _ Authority = (*LocalAuthority)(nil)
+
+// Option configures optional behaviour of a LocalAuthority.
+type Option func(*LocalAuthority)
+
+// WithClock sets the clock tokens are dated with. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(a *LocalAuthority) {
+		a.now = now
+	}
+}
+
+// NewLocalAuthority creates an authority signing tokens with keys.
+func NewLocalAuthority(keys *address.KeyPair, options ...Option) *LocalAuthority {
+	a := &LocalAuthority{keys: keys, now: time.Now}
+	for _, option := range options {
+		option(a)
+	}
+	return a
+}
+
+func (a *LocalAuthority) Stamp(ctx context.Context, subject string) (*Token, error) {
+	if subject == "" {
+		return nil, ErrInvalidSubject
+	}
+	t := &Token{
+		Subject: subject,
+		Time:    a.now().UTC().Format(time.RFC3339),
+		PubKey:  a.keys.PublicKey,
+	}
+	er := t.Sign(a.keys.ToEcdsaPrivateKey())
+	if er != nil {
+		return nil, er
+	}
+	return t, nil
+}
+
+func (a *LocalAuthority) PubKey() string {
+	return a.keys.PublicKey
+}
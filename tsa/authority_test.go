@@ -0,0 +1,62 @@
+package tsa_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/msaldanha/setinstone/address"
+	"github.com/msaldanha/setinstone/tsa"
+)
+
+var _ = Describe("LocalAuthority", func() {
+	var authority *tsa.LocalAuthority
+	var ctx context.Context
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		keys, err := address.NewKeyPair()
+		Expect(err).To(BeNil())
+		authority = tsa.NewLocalAuthority(keys, tsa.WithClock(func() time.Time { return now }))
+	})
+
+	It("Should issue verifiable tokens", func() {
+		token, err := authority.Stamp(ctx, "some-key")
+		Expect(err).To(BeNil())
+		Expect(token.Subject).To(Equal("some-key"))
+		Expect(token.PubKey).To(Equal(authority.PubKey()))
+		Expect(token.Verify()).To(BeNil())
+		t, err := token.GetTime()
+		Expect(err).To(BeNil())
+		Expect(t).To(Equal(now))
+
+		js, err := token.ToJson()
+		Expect(err).To(BeNil())
+		decoded := &tsa.Token{}
+		Expect(decoded.FromJson(js)).To(BeNil())
+		Expect(decoded.Verify()).To(BeNil())
+	})
+
+	It("Should reject tampered tokens", func() {
+		token, err := authority.Stamp(ctx, "some-key")
+		Expect(err).To(BeNil())
+
+		tampered := *token
+		tampered.Time = now.Add(-time.Hour).Format(time.RFC3339)
+		Expect(tampered.Verify()).To(Equal(tsa.ErrSignatureDoesNotMatch))
+
+		tampered = *token
+		tampered.Subject = "other-key"
+		Expect(tampered.Verify()).To(Equal(tsa.ErrSignatureDoesNotMatch))
+
+		tampered = *token
+		tampered.Signature = ""
+		Expect(tampered.Verify()).To(Equal(tsa.ErrInvalidToken))
+
+		_, err = authority.Stamp(ctx, "")
+		Expect(err).To(Equal(tsa.ErrInvalidSubject))
+	})
+})
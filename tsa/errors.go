@@ -0,0 +1,9 @@
+package tsa
+
+import "errors"
+
+var (
+	ErrInvalidToken          = errors.New("invalid timestamp token")
+	ErrSignatureDoesNotMatch = errors.New("timestamp token signature does not match")
+	ErrInvalidSubject        = errors.New("invalid timestamp subject")
+)
@@ -0,0 +1,81 @@
+package tsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/msaldanha/setinstone/crypto"
+)
+
+// Token is the countersignature of a timestamp authority, attesting that
+// Subject, e.g. the key of a node, existed at Time.
+type Token struct {
+	Subject   string `json:"subject,omitempty"`
+	Time      string `json:"time,omitempty"`
+	PubKey    string `json:"pubKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Bytes returns the bytes covered by the token signature. Every field is
+// length prefixed, so distinct tokens never produce the same bytes.
+func (t *Token) Bytes() []byte {
+	var data []byte
+	for _, field := range []string{t.Subject, t.Time, t.PubKey} {
+		data = binary.AppendUvarint(data, uint64(len(field)))
+		data = append(data, field...)
+	}
+	return data
+}
+
+// Sign signs the token with the authority private key. PubKey must be set to
+// the matching public key before.
+func (t *Token) Sign(privateKey *ecdsa.PrivateKey) error {
+	hash := sha256.Sum256(t.Bytes())
+	s, er := crypto.Sign(hash[:], privateKey)
+	if er != nil {
+		return er
+	}
+	t.Signature = hex.EncodeToString(s)
+	return nil
+}
+
+// Verify checks that the token is well formed and signed by PubKey. Whether
+// PubKey belongs to a trusted authority is up to the caller.
+func (t *Token) Verify() error {
+	if t.Subject == "" {
+		return ErrInvalidToken
+	}
+	if _, er := t.GetTime(); er != nil {
+		return ErrInvalidToken
+	}
+	sign, er := hex.DecodeString(t.Signature)
+	if er != nil || len(sign) == 0 {
+		return ErrInvalidToken
+	}
+	pubKey, er := hex.DecodeString(t.PubKey)
+	if er != nil || len(pubKey) == 0 {
+		return ErrInvalidToken
+	}
+	hash := sha256.Sum256(t.Bytes())
+	if !crypto.VerifySignature(sign, pubKey, hash[:]) {
+		return ErrSignatureDoesNotMatch
+	}
+	return nil
+}
+
+// GetTime returns the time attested by the token.
+func (t *Token) GetTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, t.Time)
+}
+
+func (t *Token) ToJson() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *Token) FromJson(js []byte) error {
+	return json.Unmarshal(js, t)
+}
@@ -0,0 +1,13 @@
+package tsa_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTsa(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tsa Suite")
+}